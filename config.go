@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read from the home directory when -config isn't
+// given.
+const defaultConfigFile = ".hostinfo.yaml"
+
+// loadConfig applies a YAML file of flag defaults, keyed by flag name:
+//
+//	r: 1.1.1.1
+//	concurrency: 20
+//	timeout: 5s
+//	ipinfo-token: abc123
+//	format: csv
+//
+// Flags given on the command line take precedence. Lists may be written as
+// YAML sequences. A missing file is only an error when path was given
+// explicitly.
+func loadConfig(path string) error {
+	explicit := path != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, defaultConfigFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	// Keyed by value rather than name so aliases such as -c and
+	// -concurrency count as one flag.
+	setOnCommandLine := map[flag.Value]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Value] = true
+	})
+
+	for name, value := range values {
+		f := flag.Lookup(name)
+		if name == "config" || f == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if setOnCommandLine[f.Value] {
+			continue
+		}
+		if err := flag.Set(name, configValue(value)); err != nil {
+			return fmt.Errorf("%s: invalid value for %q: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+func configValue(value any) string {
+	items, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, ",")
+}
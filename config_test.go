@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// configFlags swaps in a command line with a few flags like hostinfo's,
+// parsed from args, until the test ends.
+func configFlags(t *testing.T, args ...string) (concurrency *int, timeout *time.Duration, fields, format *string) {
+	t.Helper()
+	fs := flag.NewFlagSet("hostinfo", flag.ContinueOnError)
+	concurrency = fs.Int("concurrency", 10, "")
+	fs.IntVar(concurrency, "c", 10, "")
+	timeout = fs.Duration("timeout", time.Second, "")
+	fields = fs.String("select", "", "")
+	format = fs.String("format", "json", "")
+	fs.String("config", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	setArg(t, &flag.CommandLine, fs)
+	return concurrency, timeout, fields, format
+}
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, defaultConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	const config = "concurrency: 20\ntimeout: 5s\nselect: [ip, country]\nformat: csv\n"
+	tests := []struct {
+		name            string
+		args            []string
+		wantConcurrency int
+		wantTimeout     time.Duration
+		wantFormat      string
+	}{
+		{name: "defaults from the file", wantConcurrency: 20, wantTimeout: 5 * time.Second, wantFormat: "csv"},
+		{name: "command line wins", args: []string{"-format", "yaml", "-timeout", "2s"}, wantConcurrency: 20, wantTimeout: 2 * time.Second, wantFormat: "yaml"},
+		// -c and -concurrency are one flag, so either overrides the file.
+		{name: "alias on the command line", args: []string{"-c", "3"}, wantConcurrency: 3, wantTimeout: 5 * time.Second, wantFormat: "csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			concurrency, timeout, fields, format := configFlags(t, tt.args...)
+			if err := loadConfig(writeConfig(t, t.TempDir(), config)); err != nil {
+				t.Fatal(err)
+			}
+			if *concurrency != tt.wantConcurrency || *timeout != tt.wantTimeout || *format != tt.wantFormat {
+				t.Errorf("got concurrency %d, timeout %s and format %s, want %d, %s and %s",
+					*concurrency, *timeout, *format, tt.wantConcurrency, tt.wantTimeout, tt.wantFormat)
+			}
+			if *fields != "ip,country" {
+				t.Errorf("got select %q, want the list joined", *fields)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+		wantErr string
+	}{
+		{name: "missing explicit file", missing: true, wantErr: "no such file"},
+		{name: "invalid YAML", content: "concurrency: [\n", wantErr: "parsing"},
+		{name: "unknown option", content: "colour: always\n", wantErr: `unknown option "colour"`},
+		{name: "config itself", content: "config: other.yaml\n", wantErr: `unknown option "config"`},
+		{name: "invalid value", content: "concurrency: many\n", wantErr: `invalid value for "concurrency"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFlags(t)
+			path := filepath.Join(t.TempDir(), defaultConfigFile)
+			if !tt.missing {
+				path = writeConfig(t, filepath.Dir(path), tt.content)
+			}
+			err := loadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want error %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHome(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		wantConcurrency int
+	}{
+		{name: "home file", content: "concurrency: 7\n", wantConcurrency: 7},
+		{name: "no home file", wantConcurrency: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			if tt.content != "" {
+				writeConfig(t, home, tt.content)
+			}
+			concurrency, _, _, _ := configFlags(t)
+			if err := loadConfig(""); err != nil {
+				t.Fatal(err)
+			}
+			if *concurrency != tt.wantConcurrency {
+				t.Errorf("got concurrency %d, want %d", *concurrency, tt.wantConcurrency)
+			}
+		})
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	dir := t.TempDir()
+	writeConfig(t, dir, "select: [ip, country]\ncompact: true\nshodan-url: "+shodan.URL+"\nipinfo-url: "+ipinfo.URL+"\n")
+
+	status, stdout, stderr := runHostinfoStreams(t, dir, "-config", defaultConfigFile, "192.0.2.1")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := `{"ip":"192.0.2.1","country":"US"}` + "\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
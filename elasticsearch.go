@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// esBatchSize is the number of documents sent per _bulk request.
+const esBatchSize = 500
+
+// esRetryDelay is the delay before the first retry of rejected documents;
+// it doubles with every further attempt.
+var esRetryDelay = time.Second
+
+// esDocument is a record waiting to be indexed.
+type esDocument struct {
+	id     string
+	source []byte
+}
+
+// esBulkResponse is the part of a _bulk reply needed to find rejected
+// documents.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// esSink indexes written records into -es-index through the _bulk API of
+// -es-url, using the IP as the document ID so reruns overwrite instead of
+// duplicating. Documents rejected with 429 or a 5xx status are retried up
+// to -retries times, until ctx is done. A nil *esSink is a no-op.
+type esSink struct {
+	ctx     context.Context
+	bulkURL string
+	index   string
+	retries int
+	client  *http.Client
+
+	pending []esDocument
+}
+
+func newESSink(ctx context.Context, client *http.Client) *esSink {
+	if argESURL == "" {
+		return nil
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &esSink{
+		ctx:     ctx,
+		bulkURL: strings.TrimRight(argESURL, "/") + "/_bulk",
+		index:   argESIndex,
+		retries: argRetries,
+		client:  client,
+	}
+}
+
+// Add queues a record, indexing the batch once it is full.
+func (s *esSink) Add(combined hostinfo.CombinedResponse) error {
+	if s == nil {
+		return nil
+	}
+	source, err := json.Marshal(combined)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, esDocument{id: combined.IP, source: source})
+	if len(s.pending) >= esBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// Close indexes the last partial batch.
+func (s *esSink) Close() error {
+	if s == nil || len(s.pending) == 0 {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *esSink) flush() error {
+	docs := s.pending
+	s.pending = nil
+
+	delay := esRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.bulk(docs)
+		if err != nil && attempt < s.retries {
+			// The whole request failed, so every document is retried.
+			retry = docs
+		} else if err != nil {
+			return err
+		}
+		if len(retry) == 0 {
+			return nil
+		}
+		if attempt >= s.retries {
+			return fmt.Errorf("elasticsearch rejected %d documents", len(retry))
+		}
+		slog.Debug("retrying elasticsearch documents", "attempt", attempt+1, "documents", len(retry))
+		if err := waitRetry(s.ctx, delay); err != nil {
+			return fmt.Errorf("elasticsearch rejected %d documents: %w", len(retry), err)
+		}
+		delay *= 2
+		docs = retry
+	}
+}
+
+// bulk sends docs in a single _bulk request and returns those rejected
+// with a retryable status. Documents rejected for any other reason are
+// logged and dropped.
+func (s *esSink) bulk(docs []esDocument) ([]esDocument, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]any{"index": map[string]string{"_index": s.index, "_id": doc.id}})
+		if err != nil {
+			return nil, err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.source)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.bulkURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", argUserAgent)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("elasticsearch returned %s", resp.Status)
+	}
+
+	var reply esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("decoding _bulk response: %w", err)
+	}
+	if !reply.Errors {
+		return nil, nil
+	}
+
+	var retry []esDocument
+	for i, item := range reply.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status < 300:
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				retry = append(retry, docs[i])
+			default:
+				slog.Error("indexing document failed", "id", docs[i].id, "status", result.Status, "err", string(result.Error))
+			}
+		}
+	}
+	return retry, nil
+}
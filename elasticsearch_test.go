@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// esStub is a _bulk endpoint recording the documents of every request and
+// answering each with the next of replies, if any, or success.
+type esStub struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests [][]string
+}
+
+func newESStub(t *testing.T, replies ...func(w http.ResponseWriter, ids []string)) *esStub {
+	t.Helper()
+	stub := &esStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("got request for %s with Content-Type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var ids []string
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var action struct {
+				Index struct {
+					Index string `json:"_index"`
+					ID    string `json:"_id"`
+				} `json:"index"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || action.Index.ID == "" {
+				t.Errorf("bad action line %q", scanner.Text())
+			}
+			if !scanner.Scan() {
+				t.Error("action line without a document")
+				break
+			}
+			var doc hostinfo.CombinedResponse
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil || doc.IP != action.Index.ID {
+				t.Errorf("document %q doesn't match _id %s", scanner.Text(), action.Index.ID)
+			}
+			ids = append(ids, action.Index.Index+"/"+action.Index.ID)
+		}
+
+		stub.mu.Lock()
+		attempt := len(stub.requests)
+		stub.requests = append(stub.requests, ids)
+		stub.mu.Unlock()
+		if attempt < len(replies) {
+			replies[attempt](w, ids)
+			return
+		}
+		io.WriteString(w, `{"errors":false,"items":[]}`)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *esStub) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.requests...)
+}
+
+// itemStatuses answers a _bulk request with one status per document.
+func itemStatuses(statuses ...int) func(w http.ResponseWriter, ids []string) {
+	return func(w http.ResponseWriter, ids []string) {
+		items := make([]string, len(statuses))
+		for i, status := range statuses {
+			items[i] = fmt.Sprintf(`{"index":{"_id":%q,"status":%d,"error":{"type":"x"}}}`, ids[i], status)
+		}
+		fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}
+}
+
+func failRequest(w http.ResponseWriter, ids []string) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func esRecords(ips ...string) []hostinfo.CombinedResponse {
+	records := make([]hostinfo.CombinedResponse, len(ips))
+	for i, ip := range ips {
+		records[i] = sampleRecord()
+		records[i].IP = ip
+	}
+	return records
+}
+
+func TestESSink(t *testing.T) {
+	setArg(t, &esRetryDelay, time.Millisecond)
+	tests := []struct {
+		name    string
+		replies []func(http.ResponseWriter, []string)
+		retries int
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "indexed",
+			want: [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}},
+		},
+		{
+			name:    "rejected documents retried",
+			replies: []func(http.ResponseWriter, []string){itemStatuses(201, 429, 503)},
+			retries: 1,
+			want:    [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}, {"hosts/192.0.2.2", "hosts/192.0.2.3"}},
+		},
+		{
+			name:    "invalid documents dropped",
+			replies: []func(http.ResponseWriter, []string){itemStatuses(201, 400, 201)},
+			retries: 1,
+			want:    [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}},
+		},
+		{
+			name:    "failed request retried",
+			replies: []func(http.ResponseWriter, []string){failRequest},
+			retries: 1,
+			want:    [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}, {"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}},
+		},
+		{
+			name:    "retries exhausted",
+			replies: []func(http.ResponseWriter, []string){itemStatuses(429, 201, 201), itemStatuses(429)},
+			retries: 1,
+			want:    [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}, {"hosts/192.0.2.1"}},
+			wantErr: true,
+		},
+		{
+			name:    "request failed without retries",
+			replies: []func(http.ResponseWriter, []string){failRequest},
+			want:    [][]string{{"hosts/192.0.2.1", "hosts/192.0.2.2", "hosts/192.0.2.3"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newESStub(t, tt.replies...)
+			setArg(t, &argESURL, stub.URL+"/")
+			setArg(t, &argESIndex, "hosts")
+			setArg(t, &argRetries, tt.retries)
+			sink := newESSink(context.Background(), nil)
+			for _, record := range esRecords("192.0.2.1", "192.0.2.2", "192.0.2.3") {
+				if err := sink.Add(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Close(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			got := stub.received()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got requests %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestESSinkCancel(t *testing.T) {
+	setArg(t, &esRetryDelay, time.Minute)
+	stub := newESStub(t, itemStatuses(429))
+	setArg(t, &argESURL, stub.URL)
+	setArg(t, &argESIndex, "hosts")
+	setArg(t, &argRetries, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink := newESSink(ctx, nil)
+	if err := sink.Add(sampleRecord()); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := sink.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the retries abandoned", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close waited %s for the backoff", elapsed)
+	}
+	// The batch is still sent once.
+	if got := len(stub.received()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestESSinkBatches(t *testing.T) {
+	stub := newESStub(t)
+	setArg(t, &argESURL, stub.URL)
+	setArg(t, &argESIndex, "hosts")
+	sink := newESSink(context.Background(), nil)
+	for i := range esBatchSize + 1 {
+		record := sampleRecord()
+		record.IP = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		if err := sink.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(stub.received()); got != 1 {
+		t.Errorf("got %d requests before Close, want the full batch sent", got)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := stub.received()
+	if len(got) != 2 || len(got[0]) != esBatchSize || len(got[1]) != 1 {
+		t.Errorf("got batches of %d and %d documents", len(got[0]), len(got[len(got)-1]))
+	}
+}
+
+func TestESFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	stub := newESStub(t)
+	status, _, stderr := runHostinfoStreams(t, t.TempDir(), "-es-url", stub.URL, "-es-index", "scan",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if got := fmt.Sprint(stub.received()); got != "[[scan/192.0.2.1]]" {
+		t.Errorf("got requests %s, want one document in scan", got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// facetFields maps each -facet field to the values it takes in a record.
+var facetFields = map[string]func(hostinfo.CombinedResponse) []string{
+	"ports": func(combined hostinfo.CombinedResponse) []string {
+		ports := make([]string, len(combined.Ports))
+		for i, port := range combined.Ports {
+			ports[i] = strconv.Itoa(port)
+		}
+		return ports
+	},
+	"country": func(combined hostinfo.CombinedResponse) []string {
+		return []string{cmp.Or(combined.Country, "unknown")}
+	},
+	"org": func(combined hostinfo.CombinedResponse) []string {
+		return []string{cmp.Or(combined.Org, "unknown")}
+	},
+	"asn": func(combined hostinfo.CombinedResponse) []string {
+		return []string{cmp.Or(combined.ASN, "unknown")}
+	},
+	"tags": func(combined hostinfo.CombinedResponse) []string {
+		return combined.Tags
+	},
+	"cpes": func(combined hostinfo.CombinedResponse) []string {
+		return combined.CPEs
+	},
+	"vulns": func(combined hostinfo.CombinedResponse) []string {
+		return hostinfo.VulnIDs(combined.Vulns)
+	},
+}
+
+// facetFieldNames returns the valid -facet fields, sorted.
+func facetFieldNames() []string {
+	names := make([]string, 0, len(facetFields))
+	for name := range facetFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// facetResultWriter counts the values of one field across every written
+// record, once per unique IP, and prints them as a VALUE/COUNT table on
+// Close instead of writing the records themselves.
+type facetResultWriter struct {
+	w      io.Writer
+	values func(hostinfo.CombinedResponse) []string
+	ips    map[string]bool
+	counts map[string]int
+}
+
+func newFacetResultWriter(w io.Writer, field string) (*facetResultWriter, error) {
+	values, ok := facetFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown facet %q", field)
+	}
+	return &facetResultWriter{w: w, values: values, ips: map[string]bool{}, counts: map[string]int{}}, nil
+}
+
+func (fw *facetResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	if fw.ips[combined.IP] {
+		return nil
+	}
+	fw.ips[combined.IP] = true
+	for _, value := range fw.values(combined) {
+		fw.counts[value]++
+	}
+	return nil
+}
+
+// WriteError is never called, since run rejects -errors-inline with -facet.
+func (fw *facetResultWriter) WriteError(target string, err error) error {
+	return nil
+}
+
+// Close prints the values by descending count, then by value, comparing
+// numerically when both values are numbers.
+func (fw *facetResultWriter) Close() error {
+	values := make([]string, 0, len(fw.counts))
+	for value := range fw.counts {
+		values = append(values, value)
+	}
+	slices.SortFunc(values, func(a, b string) int {
+		if c := cmp.Compare(fw.counts[b], fw.counts[a]); c != 0 {
+			return c
+		}
+		numA, errA := strconv.Atoi(a)
+		numB, errB := strconv.Atoi(b)
+		if errA == nil && errB == nil {
+			return cmp.Compare(numA, numB)
+		}
+		return cmp.Compare(a, b)
+	})
+
+	tw := tabwriter.NewWriter(fw.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VALUE\tCOUNT")
+	for _, value := range values {
+		fmt.Fprintf(tw, "%s\t%d\n", value, fw.counts[value])
+	}
+	return tw.Flush()
+}
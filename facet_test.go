@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+func TestFacetResultWriter(t *testing.T) {
+	withTags := summaryHost("192.0.2.4", "FR", []int{8080}, "CVE-2021-44228")
+	withTags.Tags = []string{"cloud"}
+	records := []hostinfo.CombinedResponse{
+		summaryHost("192.0.2.1", "US", []int{22, 443}, "CVE-2021-44228"),
+		// A second record of an IP is counted once.
+		summaryHost("192.0.2.1", "US", []int{22, 443}, "CVE-2021-44228"),
+		summaryHost("192.0.2.2", "DE", []int{443, 80}),
+		summaryHost("192.0.2.3", "", []int{443, 22}),
+		withTags,
+	}
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "ports", want: "VALUE  COUNT\n443    3\n22     2\n80     1\n8080   1\n"},
+		{field: "country", want: "VALUE    COUNT\nDE       1\nFR       1\nUS       1\nunknown  1\n"},
+		{field: "vulns", want: "VALUE           COUNT\nCVE-2021-44228  2\n"},
+		{field: "tags", want: "VALUE  COUNT\ncloud  1\n"},
+		{field: "org", want: "VALUE    COUNT\nunknown  4\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			var buf strings.Builder
+			fw, err := newFacetResultWriter(&buf, tt.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records {
+				if err := fw.WriteResult(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fw.WriteError("bad.example", fmt.Errorf("lookup failed"))
+			if err := fw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFacetResultWriterUnknown(t *testing.T) {
+	if _, err := newFacetResultWriter(&strings.Builder{}, "city"); err == nil {
+		t.Error("got no error for an unknown field")
+	}
+}
+
+func TestFacetFlag(t *testing.T) {
+	hosts := map[string]string{
+		"192.0.2.1": `{"ip":"192.0.2.1","ports":[22,443]}`,
+		"192.0.2.2": `{"ip":"192.0.2.2","ports":[443]}`,
+		"192.0.2.3": `{"ip":"192.0.2.3","ports":[80,443]}`,
+	}
+	countries := map[string]string{"192.0.2.1": "US", "192.0.2.2": "US", "192.0.2.3": "DE"}
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, hosts[strings.TrimPrefix(r.URL.Path, "/")])
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+		fmt.Fprintf(w, `{"ip":%q,"country":%q}`, ip, countries[ip])
+	}))
+	defer ipinfo.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "ports", args: []string{"-facet", "ports"}, want: "VALUE  COUNT\n443    3\n22     1\n80     1\n"},
+		{name: "country", args: []string{"-facet", "country"}, want: "VALUE  COUNT\nUS     2\nDE     1\n"},
+		{name: "filtered", args: []string{"-facet", "ports", "-country", "US"}, want: "VALUE  COUNT\n443    2\n22     1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "-log-level", "error", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL,
+				"192.0.2.1", "192.0.2.2", "192.0.2.3")
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", stdout, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// resultFilter reports whether a record should be written.
+type resultFilter func(combined hostinfo.CombinedResponse) bool
+
+// activeFilters holds the filters built from the command line.
+var activeFilters []resultFilter
+
+// buildFilters returns the filters selected on the command line.
+func buildFilters() ([]resultFilter, error) {
+	var filters []resultFilter
+	if argMinCVSS > 0 {
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return maxCVSS(combined.Vulns) >= argMinCVSS
+		})
+	}
+
+	if argHasPort != "" {
+		ports, err := parsePortList(argHasPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -has-port: %w", err)
+		}
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return hasAnyPort(combined.Ports, ports)
+		})
+	}
+	if argNotPort != "" {
+		ports, err := parsePortList(argNotPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -not-port: %w", err)
+		}
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return !hasAnyPort(combined.Ports, ports)
+		})
+	}
+	if argCountry != "" {
+		countries := splitList(strings.ToUpper(argCountry))
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return combined.Country != "" && slices.Contains(countries, strings.ToUpper(combined.Country))
+		})
+	}
+	if argExcludeCountry != "" {
+		countries := splitList(strings.ToUpper(argExcludeCountry))
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return !slices.Contains(countries, strings.ToUpper(combined.Country))
+		})
+	}
+	if argTags != "" {
+		tags := splitList(argTags)
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return hasAnyTag(combined.Tags, tags)
+		})
+	}
+	if argExcludeTags != "" {
+		tags := splitList(argExcludeTags)
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return !hasAnyTag(combined.Tags, tags)
+		})
+	}
+	if len(argCPE) > 0 {
+		prefixes := argCPE
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			return hasCPEPrefix(combined.CPEs, prefixes)
+		})
+	}
+	if argOnlyWithData {
+		filters = append(filters, hasData)
+	}
+	if argNear != "" || argRadiusKm != 0 {
+		if argNear == "" || argRadiusKm <= 0 {
+			return nil, fmt.Errorf("-near and a positive -radius-km must be given together")
+		}
+		lat, lng, err := parseCoordinates(argNear)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -near: %w", err)
+		}
+		filters = append(filters, func(combined hostinfo.CombinedResponse) bool {
+			if combined.Latitude == 0 && combined.Longitude == 0 {
+				return false
+			}
+			return distanceKm(lat, lng, combined.Latitude, combined.Longitude) <= argRadiusKm
+		})
+	}
+	return filters, nil
+}
+
+// parseCoordinates parses a "lat,lng" pair in decimal degrees.
+func parseCoordinates(value string) (float64, float64, error) {
+	latValue, lngValue, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not a lat,lng pair", value)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latValue), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("bad latitude %q", latValue)
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(lngValue), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, fmt.Errorf("bad longitude %q", lngValue)
+	}
+	return lat, lng, nil
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0
+
+// distanceKm returns the great-circle distance between two coordinates
+// with the haversine formula.
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// hasData reports whether a record carries any Shodan data or an ipinfo
+// country or org.
+func hasData(combined hostinfo.CombinedResponse) bool {
+	return len(combined.Ports) > 0 || len(combined.CPEs) > 0 || len(combined.Vulns) > 0 || len(combined.Tags) > 0 ||
+		combined.Country != "" || combined.Org != ""
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func keepResult(filters []resultFilter, combined hostinfo.CombinedResponse) bool {
+	for _, filter := range filters {
+		if !filter(combined) {
+			return false
+		}
+	}
+	return true
+}
+
+func maxCVSS(vulns []hostinfo.Vuln) float64 {
+	highest := 0.0
+	for _, vuln := range vulns {
+		highest = max(highest, vuln.CVSS)
+	}
+	return highest
+}
+
+// parsePortList parses a comma-separated list of ports such as "22,3389".
+func parsePortList(value string) ([]int, error) {
+	var ports []int
+	for _, field := range splitList(value) {
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("bad port %q", field)
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	return ports, nil
+}
+
+func hasAnyPort(open, wanted []int) bool {
+	for _, port := range wanted {
+		if slices.Contains(open, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyTag reports whether any of wanted is in tags, ignoring case.
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		if slices.ContainsFunc(wanted, func(want string) bool { return strings.EqualFold(tag, want) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCPEPrefix reports whether any of cpes starts with one of prefixes,
+// ignoring case.
+func hasCPEPrefix(cpes, prefixes []string) bool {
+	for _, cpe := range cpes {
+		for _, prefix := range prefixes {
+			if len(cpe) >= len(prefix) && strings.EqualFold(cpe[:len(prefix)], prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
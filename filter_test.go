@@ -0,0 +1,497 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// keptTargets builds the filters from the current flags and returns the
+// targets of the records they keep.
+func keptTargets(t *testing.T, records []hostinfo.CombinedResponse) []string {
+	t.Helper()
+	filters, err := buildFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, record := range records {
+		if keepResult(filters, record) {
+			kept = append(kept, record.Target)
+		}
+	}
+	return kept
+}
+
+func vulnHost(target string, scores ...float64) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target = target
+	for i, score := range scores {
+		r.Vulns = append(r.Vulns, hostinfo.Vuln{ID: fmt.Sprintf("CVE-2024-%04d", i), CVSS: score})
+	}
+	return r
+}
+
+func TestMinCVSSFilter(t *testing.T) {
+	records := []hostinfo.CombinedResponse{
+		vulnHost("critical", 9.8),
+		vulnHost("mixed", 3.1, 7.5, 5.0),
+		vulnHost("medium", 5.0, 6.9),
+		vulnHost("unscored", 0),
+		vulnHost("no vulns"),
+	}
+	tests := []struct {
+		minCVSS float64
+		want    []string
+	}{
+		{minCVSS: 0, want: []string{"critical", "mixed", "medium", "unscored", "no vulns"}},
+		{minCVSS: 7, want: []string{"critical", "mixed"}},
+		{minCVSS: 7.5, want: []string{"critical", "mixed"}},
+		{minCVSS: 9, want: []string{"critical"}},
+		{minCVSS: 0.1, want: []string{"critical", "mixed", "medium"}},
+		{minCVSS: 10, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.minCVSS), func(t *testing.T) {
+			setArg(t, &argMinCVSS, tt.minCVSS)
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func portHost(target string, ports ...int) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target, r.Ports = target, ports
+	return r
+}
+
+func TestPortFilters(t *testing.T) {
+	records := []hostinfo.CombinedResponse{
+		portHost("rdp", 443, 3389),
+		portHost("vnc", 5900),
+		portHost("web", 80, 443),
+		portHost("closed"),
+	}
+	tests := []struct {
+		name    string
+		hasPort string
+		notPort string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filter", want: []string{"rdp", "vnc", "web", "closed"}},
+		{name: "has one port", hasPort: "3389", want: []string{"rdp"}},
+		{name: "has any port", hasPort: "3389, 5900", want: []string{"rdp", "vnc"}},
+		{name: "no match", hasPort: "22", want: nil},
+		{name: "not port", notPort: "443", want: []string{"vnc", "closed"}},
+		{name: "has and not", hasPort: "443", notPort: "3389", want: []string{"web"}},
+		{name: "bad port", hasPort: "ssh", wantErr: true},
+		{name: "port out of range", notPort: "70000", wantErr: true},
+		{name: "empty list", hasPort: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argHasPort, tt.hasPort)
+			setArg(t, &argNotPort, tt.notPort)
+			if tt.wantErr {
+				if _, err := buildFilters(); err == nil {
+					t.Fatal("got filters, want an error")
+				}
+				return
+			}
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func countryHost(target, country string) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target, r.Country = target, country
+	return r
+}
+
+func TestCountryFilters(t *testing.T) {
+	records := []hostinfo.CombinedResponse{
+		countryHost("us", "US"),
+		countryHost("ca", "CA"),
+		countryHost("de", "DE"),
+		countryHost("lower", "ca"),
+		countryHost("unknown", ""),
+	}
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    []string
+	}{
+		{name: "no filter", want: []string{"us", "ca", "de", "lower", "unknown"}},
+		{name: "include", include: "US,CA", want: []string{"us", "ca", "lower"}},
+		{name: "include ignores case and spaces", include: " us , ca ", want: []string{"us", "ca", "lower"}},
+		{name: "exclude", exclude: "CA", want: []string{"us", "de", "unknown"}},
+		{name: "include and exclude", include: "US,CA", exclude: "us", want: []string{"ca", "lower"}},
+		{name: "no match", include: "JP", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argCountry, tt.include)
+			setArg(t, &argExcludeCountry, tt.exclude)
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryFlag(t *testing.T) {
+	countries := map[string]string{"192.0.2.1": "US", "192.0.2.2": "DE", "192.0.2.3": ""}
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+		fmt.Fprintf(w, `{"ip":%q,"country":%q}`, ip, countries[ip])
+	}))
+	defer ipinfo.Close()
+
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-no-shodan", "-select", "ip",
+		"-ipinfo-url", ipinfo.URL, "-country", "us,ca", "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := `{"ip":"192.0.2.1"}` + "\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestUniqueIPFlag(t *testing.T) {
+	resolver := stubResolver(t, map[string]string{
+		"a.cdn.test.": "192.0.2.1",
+		"b.cdn.test.": "192.0.2.1",
+		"c.cdn.test.": "192.0.2.1",
+		"other.test.": "192.0.2.2",
+	})
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	tests := []struct {
+		name   string
+		unique bool
+		want   []string
+	}{
+		{name: "every record", want: []string{"a.cdn.test 192.0.2.1", "b.cdn.test 192.0.2.1", "other.test 192.0.2.2", "c.cdn.test 192.0.2.1"}},
+		{name: "one per IP", unique: true, want: []string{"a.cdn.test 192.0.2.1", "other.test 192.0.2.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"-ordered", "-r", resolver, "-template", "{{.Target}} {{.IP}}", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}
+			if tt.unique {
+				args = append(args, "-unique-ip")
+			}
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(args, "a.cdn.test", "b.cdn.test", "other.test", "c.cdn.test")...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if got := strings.Split(strings.TrimSpace(stdout), "\n"); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyWithDataFilter(t *testing.T) {
+	cpes, tags, org, empty := countryHost("cpes", ""), countryHost("tags", ""), countryHost("org", ""), countryHost("empty", "")
+	cpes.CPEs = []string{"cpe:/a:openbsd:openssh"}
+	tags.Tags = []string{"cloud"}
+	org.Org = "AS64500 Example"
+	empty.Hostname, empty.City = "empty.test", "Springfield"
+	records := []hostinfo.CombinedResponse{
+		portHost("ports", 22),
+		vulnHost("vulns", 9.8),
+		cpes,
+		tags,
+		countryHost("country", "US"),
+		org,
+		empty,
+	}
+	tests := []struct {
+		name         string
+		onlyWithData bool
+		country      string
+		want         []string
+	}{
+		{name: "disabled", want: []string{"ports", "vulns", "cpes", "tags", "country", "org", "empty"}},
+		{name: "enabled", onlyWithData: true, want: []string{"ports", "vulns", "cpes", "tags", "country", "org"}},
+		{name: "with another filter", onlyWithData: true, country: "US", want: []string{"country"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argOnlyWithData, tt.onlyWithData)
+			setArg(t, &argCountry, tt.country)
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyWithDataFlag(t *testing.T) {
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/192.0.2.1" {
+			http.Error(w, `{"detail":"No information available"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"ip":"192.0.2.1","ports":[443]}`)
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ip":%q}`, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json"))
+	}))
+	defer ipinfo.Close()
+
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-only-with-data", "-select", "ip", "-log-level", "error",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := `{"ip":"192.0.2.1"}` + "\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+	}{
+		{name: "same point", lat1: 48.8566, lng1: 2.3522, lat2: 48.8566, lng2: 2.3522, want: 0},
+		{name: "Paris to London", lat1: 48.8566, lng1: 2.3522, lat2: 51.5074, lng2: -0.1278, want: 343.5},
+		{name: "Paris to New York", lat1: 48.8566, lng1: 2.3522, lat2: 40.7128, lng2: -74.0060, want: 5837.2},
+		{name: "one degree of longitude on the equator", lat2: 0, lng2: 1, want: 111.2},
+		{name: "antipodes", lat1: 0, lng1: 0, lat2: 0, lng2: 180, want: 20015.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := distanceKm(tt.lat1, tt.lng1, tt.lat2, tt.lng2); math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("got %.1f km, want %.1f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCoordinates(t *testing.T) {
+	tests := []struct {
+		value    string
+		lat, lng float64
+		wantErr  bool
+	}{
+		{value: "48.8566,2.3522", lat: 48.8566, lng: 2.3522},
+		{value: " -33.9 , 151.2 ", lat: -33.9, lng: 151.2},
+		{value: "48.8566", wantErr: true},
+		{value: "north,2.3522", wantErr: true},
+		{value: "91,0", wantErr: true},
+		{value: "0,-181", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			lat, lng, err := parseCoordinates(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if lat != tt.lat || lng != tt.lng {
+				t.Errorf("got %v,%v, want %v,%v", lat, lng, tt.lat, tt.lng)
+			}
+		})
+	}
+}
+
+func locatedHost(target string, lat, lng float64) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target, r.Latitude, r.Longitude = target, lat, lng
+	return r
+}
+
+func TestNearFilter(t *testing.T) {
+	// Distances from central Paris.
+	records := []hostinfo.CombinedResponse{
+		locatedHost("paris", 48.8566, 2.3522),
+		locatedHost("versailles", 48.8049, 2.1204), // 17.9 km
+		locatedHost("reims", 49.2583, 4.0317),      // 129.5 km
+		locatedHost("london", 51.5074, -0.1278),    // 343.5 km
+		locatedHost("unknown", 0, 0),
+	}
+	reims := distanceKm(48.8566, 2.3522, 49.2583, 4.0317)
+	tests := []struct {
+		name    string
+		near    string
+		radius  float64
+		want    []string
+		wantErr bool
+	}{
+		{name: "disabled", want: []string{"paris", "versailles", "reims", "london", "unknown"}},
+		{name: "100 km", near: "48.8566,2.3522", radius: 100, want: []string{"paris", "versailles"}},
+		{name: "on the boundary", near: "48.8566,2.3522", radius: reims, want: []string{"paris", "versailles", "reims"}},
+		{name: "just outside the boundary", near: "48.8566,2.3522", radius: reims - 0.01, want: []string{"paris", "versailles"}},
+		{name: "London", near: "51.5074,-0.1278", radius: 350, want: []string{"paris", "versailles", "london"}},
+		{name: "no radius", near: "48.8566,2.3522", wantErr: true},
+		{name: "no point", radius: 100, wantErr: true},
+		{name: "bad point", near: "paris", radius: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argNear, tt.near)
+			setArg(t, &argRadiusKm, tt.radius)
+			if tt.wantErr {
+				if _, err := buildFilters(); err == nil {
+					t.Error("got no error")
+				}
+				return
+			}
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func taggedHost(target string, tags ...string) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target, r.Tags = target, tags
+	return r
+}
+
+func TestTagFilters(t *testing.T) {
+	records := []hostinfo.CombinedResponse{
+		taggedHost("cdn", "cdn"),
+		taggedHost("cloud", "cloud", "self-signed"),
+		taggedHost("honeypot", "honeypot", "cloud"),
+		taggedHost("upper", "CDN"),
+		taggedHost("untagged"),
+	}
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    []string
+	}{
+		{name: "no filter", want: []string{"cdn", "cloud", "honeypot", "upper", "untagged"}},
+		{name: "include", include: "cdn,cloud", want: []string{"cdn", "cloud", "honeypot", "upper"}},
+		{name: "include ignores case and spaces", include: " Cdn ", want: []string{"cdn", "upper"}},
+		{name: "exclude", exclude: "honeypot", want: []string{"cdn", "cloud", "upper", "untagged"}},
+		{name: "exclude ignores case", exclude: "HONEYPOT,cdn", want: []string{"cloud", "untagged"}},
+		{name: "include and exclude", include: "cloud", exclude: "honeypot", want: []string{"cloud"}},
+		{name: "no match", include: "vpn", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argTags, tt.include)
+			setArg(t, &argExcludeTags, tt.exclude)
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludeTagsFlag(t *testing.T) {
+	tags := map[string]string{"192.0.2.1": `["cloud"]`, "192.0.2.2": `["honeypot"]`, "192.0.2.3": `[]`}
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `{"ip":%q,"tags":%s}`, ip, tags[ip])
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-exclude-tags", "Honeypot", "-ordered", "-template", "{{.IP}}",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := "192.0.2.1\n192.0.2.3\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var list stringList
+	for _, value := range []string{"cpe:/a:apache", " cpe:/a:nginx , cpe:/o:linux ", ""} {
+		if err := list.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"cpe:/a:apache", "cpe:/a:nginx", "cpe:/o:linux"}; !slices.Equal(list, want) {
+		t.Errorf("got %q, want %q", list, want)
+	}
+	if got, want := list.String(), "cpe:/a:apache,cpe:/a:nginx,cpe:/o:linux"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func cpeHost(target string, cpes ...string) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target, r.CPEs = target, cpes
+	return r
+}
+
+func TestCPEFilter(t *testing.T) {
+	records := []hostinfo.CombinedResponse{
+		cpeHost("apache", "cpe:/a:apache:http_server:2.4.41", "cpe:/o:canonical:ubuntu_linux"),
+		cpeHost("tomcat", "cpe:/a:apache:tomcat"),
+		cpeHost("nginx", "cpe:/a:nginx:nginx", "cpe:/o:linux:linux_kernel"),
+		cpeHost("upper", "CPE:/A:APACHE:HTTP_SERVER"),
+		cpeHost("none"),
+	}
+	tests := []struct {
+		name     string
+		prefixes stringList
+		want     []string
+	}{
+		{name: "no filter", want: []string{"apache", "tomcat", "nginx", "upper", "none"}},
+		{name: "vendor prefix", prefixes: stringList{"cpe:/a:apache"}, want: []string{"apache", "tomcat", "upper"}},
+		{name: "product prefix", prefixes: stringList{"cpe:/a:apache:http_server"}, want: []string{"apache", "upper"}},
+		{name: "any of several", prefixes: stringList{"cpe:/a:nginx", "cpe:/a:apache:tomcat"}, want: []string{"tomcat", "nginx"}},
+		{name: "not a substring match", prefixes: stringList{"apache"}, want: nil},
+		{name: "longer than every CPE", prefixes: stringList{"cpe:/a:apache:tomcat:9.0.1:extra"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argCPE, tt.prefixes)
+			if got := keptTargets(t, records); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCPEFlag(t *testing.T) {
+	cpes := map[string]string{
+		"192.0.2.1": `["cpe:/a:apache:http_server"]`,
+		"192.0.2.2": `["cpe:/a:nginx:nginx"]`,
+		"192.0.2.3": `["cpe:/a:microsoft:iis"]`,
+	}
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `{"ip":%q,"cpes":%s}`, ip, cpes[ip])
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-cpe", "cpe:/a:apache", "-cpe", "cpe:/a:nginx",
+		"-ordered", "-template", "{{.IP}}", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := "192.0.2.1\n192.0.2.2\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
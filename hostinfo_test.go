@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// newStub starts a server answering every request with handler and stops it
+// when the test ends.
+func newStub(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// respond returns a handler answering with status and body.
+func respond(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+// echoIPInfo answers ipinfo.io requests with the requested IP.
+func echoIPInfo(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+	respond(http.StatusOK, fmt.Sprintf(`{"ip":%q,"country":"US"}`, ip))(w, r)
+}
+
+// stubTransport sends the requests for each API host to the stub server
+// standing in for it.
+type stubTransport map[string]*httptest.Server
+
+func (st stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	srv, ok := st[r.URL.Hostname()]
+	if !ok {
+		return nil, fmt.Errorf("no stub for %s", r.URL.Host)
+	}
+	r = r.Clone(r.Context())
+	r.URL.Scheme = "http"
+	r.URL.Host = srv.Listener.Addr().String()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// stubClient returns a client querying shodan for InternetDB and ipinfo for
+// ipinfo.io.
+func stubClient(t *testing.T, shodan, ipinfo http.HandlerFunc) *hostinfo.Client {
+	t.Helper()
+	return &hostinfo.Client{HTTPClient: &http.Client{Transport: stubTransport{
+		"internetdb.shodan.io": newStub(t, shodan),
+		"ipinfo.io":            newStub(t, ipinfo),
+	}}}
+}
+
+// runTargets returns what processTargets writes for targets.
+func runTargets(client *hostinfo.Client, targets ...string) string {
+	var out strings.Builder
+	processTargets(context.Background(), client, sendTargets(context.Background(), targets), len(targets), false, &out)
+	return out.String()
+}
+
+const (
+	shodanBody = `{"ip":"192.0.2.1","ports":[22,443],"vulns":["CVE-2021-44228"]}`
+	ipinfoBody = `{"ip":"192.0.2.1","country":"US","org":"AS64500 Example","loc":"37.4,-122.1"}`
+)
+
+func TestProcessTargetsErrorsInline(t *testing.T) {
+	tests := []struct {
+		name   string
+		inline bool
+		format string
+		want   string
+	}{
+		{name: "default", format: "json"},
+		{name: "inline json", inline: true, format: "json", want: `{"target":"192.0.2.1","error":"`},
+		{name: "inline csv", inline: true, format: "csv", want: strings.Join(csvHeader, ",") + "\n192.0.2.1,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, respond(http.StatusForbidden, `{}`), respond(http.StatusForbidden, `{}`))
+			setArg(t, &argErrorsInline, tt.inline)
+			setArg(t, &argFormat, tt.format)
+			output := runTargets(client, "192.0.2.1")
+			if tt.want == "" && output != "" {
+				t.Errorf("got output %q, want none", output)
+			}
+			if !strings.HasPrefix(output, tt.want) {
+				t.Errorf("got output %q, want it to start with %q", output, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// runMainEnv makes the test binary run main itself, so tests can check the
+// exit status and side effects of whole runs.
+const runMainEnv = "HOSTINFO_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// runHostinfo runs hostinfo with args in dir, with an empty stdin, and
+// returns its exit status and output.
+func runHostinfo(t *testing.T, dir string, args ...string) (int, string) {
+	t.Helper()
+	status, stdout, stderr := runHostinfoStreams(t, dir, args...)
+	return status, stdout + stderr
+}
+
+// runHostinfoStreams is runHostinfo returning stdout and stderr apart.
+func runHostinfoStreams(t *testing.T, dir string, args ...string) (int, string, string) {
+	t.Helper()
+	return runCommand(t, hostinfoCommand(t, dir, args...))
+}
+
+// runCommand runs cmd and returns its exit status, stdout and stderr.
+func runCommand(t *testing.T, cmd *exec.Cmd) (int, string, string) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stdout.String(), stderr.String()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0, stdout.String(), stderr.String()
+}
+
+// hostinfoCommand returns the command runHostinfoStreams runs.
+func hostinfoCommand(t *testing.T, dir string, args ...string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", "HTTPS_PROXY=", "HTTP_PROXY=",
+		"SHODAN_API_KEY=", "IPINFO_TOKEN=", "IPINFO_URL=", "SHODAN_API_URL=", "NVD_API_KEY=")
+	return cmd
+}
+
+// nxdomainResolver starts a DNS server on 127.0.0.1 answering NXDOMAIN to
+// every UDP query and returns its address.
+func nxdomainResolver(t *testing.T) string {
+	t.Helper()
+	return stubResolver(t, nil)
+}
+
+// stubResolver starts a DNS server on 127.0.0.1 answering UDP queries for
+// the names in hosts, e.g. "example.test." to "192.0.2.1", with their
+// comma-separated IPv4 addresses and NXDOMAIN for every other name. It
+// returns its address.
+func stubResolver(t *testing.T, hosts map[string]string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) != 1 {
+				continue
+			}
+			msg.Response, msg.RecursionAvailable = true, true
+			q := msg.Questions[0]
+			ips, ok := hosts[q.Name.String()]
+			switch {
+			case !ok:
+				msg.RCode = dnsmessage.RCodeNameError
+			case q.Type == dnsmessage.TypeA:
+				for _, ip := range strings.Split(ips, ",") {
+					msg.Answers = append(msg.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()},
+					})
+				}
+			}
+			if reply, err := msg.Pack(); err == nil {
+				conn.WriteTo(reply, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// setArg sets the flag variable p to value until the test ends.
+func setArg[T any](t *testing.T, p *T, value T) {
+	t.Helper()
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// countingStub starts a server answering every request with body and
+// counts the requests it receives.
+func countingStub(t *testing.T, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// slowServer answers every request after delay.
+func slowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		delay   time.Duration
+		wantErr bool
+	}{
+		{name: "no timeout", timeout: 0, delay: 10 * time.Millisecond},
+		{name: "within timeout", timeout: time.Second, delay: 10 * time.Millisecond},
+		{name: "timed out", timeout: 50 * time.Millisecond, delay: time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argTimeout, tt.timeout)
+			client, err := newHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Timeout != tt.timeout {
+				t.Errorf("got client timeout %s, want %s", client.Timeout, tt.timeout)
+			}
+			resp, err := client.Get(slowServer(t, tt.delay).URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientIdleConns(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		wantPerHost int
+	}{
+		{concurrency: 1, wantPerHost: idleConnsPerHost},
+		{concurrency: 50, wantPerHost: 50},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.concurrency), func(t *testing.T) {
+			setArg(t, &argConcurrency, tt.concurrency)
+			client, err := newHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			transport := client.Transport.(*http.Transport)
+			if transport.MaxIdleConnsPerHost != tt.wantPerHost || transport.MaxIdleConns != 2*tt.wantPerHost || transport.IdleConnTimeout == 0 {
+				t.Errorf("got %d idle connections per host, %d in all and an idle timeout of %s",
+					transport.MaxIdleConnsPerHost, transport.MaxIdleConns, transport.IdleConnTimeout)
+			}
+		})
+	}
+}
+
+// stalledTLSServer accepts TCP connections but never answers the TLS
+// handshake, and returns its https URL.
+func stalledTLSServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	return "https://" + listener.Addr().String()
+}
+
+func TestNewHTTPClientTimeouts(t *testing.T) {
+	// delayed waits headerDelay before the response headers and bodyDelay
+	// before the body.
+	delayed := func(headerDelay, bodyDelay time.Duration) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wait := func(d time.Duration) bool {
+				select {
+				case <-time.After(d):
+					return true
+				case <-r.Context().Done():
+					return false
+				}
+			}
+			if !wait(headerDelay) {
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			if wait(bodyDelay) {
+				io.WriteString(w, "{}")
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	tests := []struct {
+		name    string
+		url     string
+		timeout time.Duration
+		connect time.Duration
+		read    time.Duration
+		wantErr string
+	}{
+		{name: "connect timeout", url: stalledTLSServer(t), timeout: time.Minute, connect: 50 * time.Millisecond, wantErr: "TLS handshake timeout"},
+		{name: "read timeout", url: delayed(time.Minute, 0), timeout: time.Minute, read: 50 * time.Millisecond, wantErr: "timeout awaiting response headers"},
+		{name: "slow headers within the read timeout", url: delayed(100*time.Millisecond, 0), timeout: time.Minute, read: 2 * time.Second},
+		{name: "read timeout spares the body", url: delayed(0, 200*time.Millisecond), timeout: time.Minute, read: 50 * time.Millisecond},
+		{name: "connect timeout spares the headers", url: delayed(200*time.Millisecond, 0), timeout: time.Minute, connect: 50 * time.Millisecond},
+		{name: "overall timeout", url: delayed(time.Minute, 0), timeout: 50 * time.Millisecond, wantErr: "Client.Timeout exceeded"},
+		{name: "overall timeout covers the body", url: delayed(0, time.Minute), timeout: 50 * time.Millisecond, read: time.Minute, wantErr: "Client.Timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argTimeout, tt.timeout)
+			setArg(t, &argConnectTimeout, tt.connect)
+			setArg(t, &argReadTimeout, tt.read)
+			client, err := newHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := client.Get(tt.url)
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("timed out after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "both address families", args: []string{"-4", "-6", "192.0.2.1"}, want: "-4 and -6 are mutually exclusive"},
+		{name: "invalid proxy", args: []string{"-proxy", "http://", "192.0.2.1"}, want: `invalid proxy "http://"`},
+		{name: "invalid template", args: []string{"-template", "{{.IP", "192.0.2.1"}, want: "Invalid -template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stdout, stderr := runHostinfoStreams(t, t.TempDir(), tt.args...)
+			if stdout != "" || !strings.Contains(stderr, tt.want) {
+				t.Errorf("got stdout %q and stderr %q, want only an error mentioning %q", stdout, stderr, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	badConfig := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(badConfig, []byte("concurrency: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := stubResolver(t, map[string]string{"found.test.": "192.0.2.1"})
+	// Without sources, resolving a target is all it takes to succeed.
+	offline := []string{"-r", resolver, "-no-shodan", "-no-ipinfo"}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "version", args: []string{"-version"}, want: 0},
+		{name: "dry run", args: []string{"-dry-run", "192.0.2.1"}, want: 0},
+		{name: "every target succeeded", args: append(offline, "found.test"), want: 0},
+		{name: "some targets failed", args: append(offline, "found.test", "missing.test"), want: exitSomeFailed},
+		{name: "every target failed", args: append(offline, "missing.test"), want: exitAllFailed},
+		{name: "invalid config", args: []string{"-config", badConfig, "192.0.2.1"}, want: exitUsage},
+		{name: "missing config", args: []string{"-config", filepath.Join(dir, "missing.yaml"), "192.0.2.1"}, want: exitUsage},
+		{name: "unknown log level", args: []string{"-log-level", "loud", "192.0.2.1"}, want: exitUsage},
+		{name: "invalid input URL", args: []string{"-input-url", "ftp://example.com/targets.txt"}, want: exitUsage},
+		{name: "unknown input format", args: []string{"-input-format", "xml", "192.0.2.1"}, want: exitUsage},
+		{name: "bad resolver", args: []string{"-r", "8.8.8.8:dns", "192.0.2.1"}, want: exitUsage},
+		{name: "bad secondary resolver", args: []string{"-r2", "8.8.8.8:dns", "192.0.2.1"}, want: exitUsage},
+		{name: "bad proxy", args: []string{"-proxy", "://", "192.0.2.1"}, want: exitUsage},
+		{name: "unknown format", args: []string{"-format", "xml", "192.0.2.1"}, want: exitUsage},
+		{name: "unknown color mode", args: []string{"-color", "sometimes", "192.0.2.1"}, want: exitUsage},
+		{name: "unknown facet", args: []string{"-facet", "city", "192.0.2.1"}, want: exitUsage},
+		{name: "invalid webhook URL", args: []string{"-webhook", "not a url", "192.0.2.1"}, want: exitUsage},
+		{name: "invalid Elasticsearch URL", args: []string{"-es-url", "localhost", "192.0.2.1"}, want: exitUsage},
+		{name: "invalid template", args: []string{"-template", "{{.IP", "192.0.2.1"}, want: exitUsage},
+		{name: "-only-ip with -template", args: []string{"-only-ip", "-template", "{{.IP}}", "192.0.2.1"}, want: exitUsage},
+		{name: "-errors-inline with -facet", args: []string{"-errors-inline", "-facet", "country", "192.0.2.1"}, want: exitUsage},
+		{name: "-errors-inline with -q", args: []string{"-errors-inline", "-q", ".ip", "192.0.2.1"}, want: exitUsage},
+		{name: "-errors-inline with -only-ip", args: []string{"-errors-inline", "-only-ip", "192.0.2.1"}, want: exitUsage},
+		{name: "-stream with -format table", args: []string{"-stream", "-format", "table"}, want: exitUsage},
+		{name: "-skip-private with -mark-private", args: []string{"-skip-private", "-mark-private", "192.0.2.1"}, want: exitUsage},
+		{name: "invalid query", args: []string{"-q", "[", "192.0.2.1"}, want: exitUsage},
+		{name: "-select with csv", args: []string{"-select", "ip", "-format", "csv", "192.0.2.1"}, want: exitUsage},
+		{name: "-near without -radius-km", args: []string{"-near", "48.8566,2.3522", "192.0.2.1"}, want: exitUsage},
+		{name: "unknown record type", args: []string{"-records", "mx,srv", "example.test"}, want: exitUsage},
+		{name: "both address families", args: []string{"-4", "-6", "192.0.2.1"}, want: exitUsage},
+		{name: "conflicting flags", args: []string{"-pretty", "-compact", "192.0.2.1"}, want: exitUsage},
+		{name: "unknown geolocation provider", args: []string{"-geo-provider", "maxmind", "192.0.2.1"}, want: exitUsage},
+		{name: "no targets", args: nil, want: exitUsage},
+		{name: "unreadable exclude file", args: []string{"-exclude-file", filepath.Join(dir, "missing.txt"), "192.0.2.1"}, want: exitError},
+		{name: "unreadable cache file", args: []string{"-cache-file", dir, "192.0.2.1"}, want: exitError},
+		{name: "unreadable MaxMind database", args: []string{"-mmdb", filepath.Join(dir, "missing.mmdb"), "192.0.2.1"}, want: exitError},
+		{name: "unwritable output file", args: []string{"-o", filepath.Join(dir, "missing", "out.json"), "192.0.2.1"}, want: exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, output := runHostinfo(t, dir, tt.args...)
+			if got != tt.want {
+				t.Errorf("got exit status %d, want %d; output:\n%s", got, tt.want, output)
+			}
+		})
+	}
+}
+
+func TestDryRunHasNoSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	// A busy address makes the run fail if the metrics server is started.
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	var requests atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer stub.Close()
+
+	status, output := runHostinfo(t, dir, "-dry-run",
+		"-o", "out.json",
+		"-cache-file", "cache.json",
+		"-sqlite", "hosts.db",
+		"-webhook", stub.URL,
+		"-es-url", stub.URL,
+		"-mmdb", "missing.mmdb",
+		"-metrics-addr", busy.Addr().String(),
+		"192.0.2.0/30")
+	if status != 0 {
+		t.Fatalf("got exit status %d; output:\n%s", status, output)
+	}
+	if output != "192.0.2.1\n192.0.2.2\n" {
+		t.Errorf("got output %q", output)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("-dry-run created %s", entry.Name())
+	}
+	if n := requests.Load(); n > 0 {
+		t.Errorf("-dry-run sent %d requests", n)
+	}
+}
+
+// proxyStub is a forward proxy answering every request itself with body,
+// recording the URL and Proxy-Authorization header of the last request.
+type proxyStub struct {
+	*httptest.Server
+	requests atomic.Int32
+	url      atomic.Value
+	auth     atomic.Value
+}
+
+func newProxyStub(t *testing.T, body string) *proxyStub {
+	t.Helper()
+	proxy := &proxyStub{}
+	proxy.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.requests.Add(1)
+		proxy.url.Store(r.URL.String())
+		proxy.auth.Store(r.Header.Get("Proxy-Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	proxy := newProxyStub(t, "{}")
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		proxy    string
+		wantAuth string
+		wantErr  bool
+	}{
+		{name: "proxy", proxy: proxy.URL},
+		{name: "authenticated proxy", proxy: "http://user:secret@" + proxyURL.Host, wantAuth: "Basic dXNlcjpzZWNyZXQ="},
+		{name: "no host", proxy: "http://", wantErr: true},
+		{name: "malformed", proxy: "://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argProxy, tt.proxy)
+			client, err := newHTTPClient()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got a client, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get("http://api.example.test/192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := proxy.url.Load(); got != "http://api.example.test/192.0.2.1" {
+				t.Errorf("proxy got request for %v", got)
+			}
+			if got := proxy.auth.Load(); got != tt.wantAuth {
+				t.Errorf("got Proxy-Authorization %q, want %q", got, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestProxyFlag(t *testing.T) {
+	proxy := newProxyStub(t, `{"ip":"192.0.2.1","ports":[443],"country":"US"}`)
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-compact", "-proxy", proxy.URL,
+		"-shodan-url", "http://internetdb.example.test", "-ipinfo-url", "http://ipinfo.example.test", "192.0.2.1")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if n := proxy.requests.Load(); n != 2 {
+		t.Errorf("proxy got %d requests, want both API requests", n)
+	}
+	if !strings.Contains(stdout, `"country":"US"`) {
+		t.Errorf("got %q, want the record built from the proxied responses", stdout)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	dir := t.TempDir()
+	// The second target hangs until its request is cancelled, so the run is
+	// interrupted with one target done and one in flight.
+	reached := make(chan struct{})
+	var once sync.Once
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		if ip == "192.0.2.2" {
+			once.Do(func() { close(reached) })
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, ip)
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	var stdout, stderr strings.Builder
+	cmd := hostinfoCommand(t, dir, "-compact", "-concurrency", "1", "-retries", "0", "-cache-file", "cache.json",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reached:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatalf("second target never started; stderr:\n%s", stderr.String())
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("hostinfo did not exit after the interrupt")
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Errorf("got %v, want exit status 130", err)
+	}
+	if !strings.Contains(stderr.String(), "[!] Interrupted") {
+		t.Errorf("got stderr %q, want the interruption reported", stderr.String())
+	}
+	if want := `{"ip":"192.0.2.1","ports":[443]}` + "\n"; stdout.String() != want {
+		t.Errorf("got stdout %q, want only the finished target %q", stdout.String(), want)
+	}
+
+	cache, err := os.ReadFile(filepath.Join(dir, "cache.json"))
+	if err != nil {
+		t.Fatalf("cache not saved: %v", err)
+	}
+	if !strings.Contains(string(cache), "192.0.2.1") || strings.Contains(string(cache), "192.0.2.3") {
+		t.Errorf("got cache %s, want only the finished target", cache)
+	}
+}
+
+func TestAPIURLFlags(t *testing.T) {
+	shodan, shodanRequests := countingStub(t, `{"ip":"192.0.2.1","ports":[443]}`)
+	flagIPInfo, flagRequests := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	envIPInfo, envRequests := countingStub(t, `{"ip":"192.0.2.1","country":"CA"}`)
+	tests := []struct {
+		name        string
+		args        []string
+		env         string
+		wantCountry string
+		wantFlag    int32
+		wantEnv     int32
+	}{
+		{name: "flags", args: []string{"-ipinfo-url", flagIPInfo.URL}, wantCountry: "US", wantFlag: 1},
+		{name: "environment", env: envIPInfo.URL, wantCountry: "CA", wantEnv: 1},
+		{name: "flag over environment", args: []string{"-ipinfo-url", flagIPInfo.URL}, env: envIPInfo.URL, wantCountry: "US", wantFlag: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodanBefore, flagBefore, envBefore := shodanRequests.Load(), flagRequests.Load(), envRequests.Load()
+			var stdout, stderr strings.Builder
+			args := append([]string{"-compact", "-shodan-url", shodan.URL}, tt.args...)
+			cmd := hostinfoCommand(t, t.TempDir(), append(args, "192.0.2.1")...)
+			cmd.Env = append(cmd.Env, "IPINFO_URL="+tt.env)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("%v; stderr:\n%s", err, stderr.String())
+			}
+			if n := shodanRequests.Load() - shodanBefore; n != 1 {
+				t.Errorf("Shodan stub got %d requests, want 1", n)
+			}
+			if n := flagRequests.Load() - flagBefore; n != tt.wantFlag {
+				t.Errorf("-ipinfo-url stub got %d requests, want %d", n, tt.wantFlag)
+			}
+			if n := envRequests.Load() - envBefore; n != tt.wantEnv {
+				t.Errorf("$IPINFO_URL stub got %d requests, want %d", n, tt.wantEnv)
+			}
+			if want := fmt.Sprintf(`"country":%q`, tt.wantCountry); !strings.Contains(stdout.String(), want) {
+				t.Errorf("got %q, want %s", stdout.String(), want)
+			}
+		})
+	}
+}
+
+// shodanAPIStub serves the Shodan host API and /api-info, reporting
+// credits query credits left, and records the paths requested.
+func shodanAPIStub(t *testing.T, credits int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/api-info" {
+			fmt.Fprintf(w, `{"plan":"dev","query_credits":%d}`, credits)
+			return
+		}
+		fmt.Fprint(w, `{"ip_str":"192.0.2.1","ports":[22],"os":"Linux"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestShodanAPIURLFlag(t *testing.T) {
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	tests := []struct {
+		name    string
+		flag    bool
+		env     bool
+		credits int
+		args    []string
+		want    []string
+		wantOS  bool
+		status  int
+	}{
+		{name: "flag", flag: true, credits: 10, want: []string{"/api-info", "/shodan/host/192.0.2.1"}, wantOS: true},
+		{name: "environment", env: true, credits: 10, want: []string{"/api-info", "/shodan/host/192.0.2.1"}, wantOS: true},
+		{name: "out of credits", flag: true, args: []string{"-stop-on-credits"}, want: []string{"/api-info"}, status: exitNoCredits},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, paths := shodanAPIStub(t, tt.credits)
+			args := append([]string{"-compact", "-shodan-key", "key", "-ipinfo-url", ipinfo.URL}, tt.args...)
+			if tt.flag {
+				args = append(args, "-shodan-api-url", srv.URL)
+			}
+			cmd := hostinfoCommand(t, t.TempDir(), append(args, "192.0.2.1")...)
+			if tt.env {
+				cmd.Env = append(cmd.Env, "SHODAN_API_URL="+srv.URL)
+			}
+			status, stdout, stderr := runCommand(t, cmd)
+			if status != tt.status {
+				t.Fatalf("exit status %d, want %d; stderr:\n%s", status, tt.status, stderr)
+			}
+			if got := paths(); !slices.Equal(got, tt.want) {
+				t.Errorf("got requests for %q, want %q", got, tt.want)
+			}
+			if got := strings.Contains(stdout, `"os":"Linux"`); got != tt.wantOS {
+				t.Errorf("got %q, want host API data %v", stdout, tt.wantOS)
+			}
+		})
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		perSecond float64
+		wantNil   bool
+	}{
+		{perSecond: 0, wantNil: true},
+		{perSecond: -1, wantNil: true},
+		{perSecond: 0.5},
+		{perSecond: 10},
+	}
+	for _, tt := range tests {
+		limiter := newLimiter(tt.perSecond)
+		if (limiter == nil) != tt.wantNil {
+			t.Errorf("newLimiter(%v) = %v, want nil %v", tt.perSecond, limiter, tt.wantNil)
+			continue
+		}
+		if limiter != nil && (float64(limiter.Limit()) != tt.perSecond || limiter.Burst() != 1) {
+			t.Errorf("newLimiter(%v) allows %v/s with burst %d", tt.perSecond, limiter.Limit(), limiter.Burst())
+		}
+	}
+}
+
+func TestLogLevelFlag(t *testing.T) {
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ip":"192.0.2.1","ports":[443]}`)
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ip":"192.0.2.1","country":"US"}`)
+	}))
+	defer ipinfo.Close()
+
+	tests := []struct {
+		level     string
+		debugHTTP bool
+		want      []string
+		notWant   []string
+	}{
+		{level: "debug", want: []string{"level=DEBUG", `msg="http request"`, `msg="processed target"`}},
+		{level: "info", want: []string{"level=INFO", `msg="processed target"`}, notWant: []string{"level=DEBUG"}},
+		{level: "error", notWant: []string{"level=DEBUG", "level=INFO"}},
+		// -debug-http lowers any level to debug.
+		{level: "error", debugHTTP: true, want: []string{`msg="http response body"`, `\"country\":\"US\"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			args := []string{"-compact", "-log-level", tt.level, "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}
+			if tt.debugHTTP {
+				args = append(args, "-debug-http")
+			}
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(args, "192.0.2.1")...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			// Logs never reach stdout, which holds the results alone.
+			if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], "{") {
+				t.Errorf("got stdout %q, want one JSON record", stdout)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stderr, want) {
+					t.Errorf("stderr is missing %q:\n%s", want, stderr)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(stderr, notWant) {
+					t.Errorf("stderr contains %q:\n%s", notWant, stderr)
+				}
+			}
+		})
+	}
+}
+
+func TestReorderResults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []int
+		want []int
+	}{
+		{name: "in order", in: []int{0, 1, 2}, want: []int{0, 1, 2}},
+		{name: "reversed", in: []int{2, 1, 0}, want: []int{0, 1, 2}},
+		{name: "shuffled", in: []int{1, 3, 0, 2}, want: []int{0, 1, 2, 3}},
+		// Targets that never ran after an interrupt leave gaps; the rest
+		// is still flushed in order.
+		{name: "gaps", in: []int{4, 0, 2}, want: []int{0, 2, 4}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan hostinfo.Result)
+			go func() {
+				defer close(in)
+				for _, index := range tt.in {
+					in <- hostinfo.Result{Index: index}
+				}
+			}()
+			var got []int
+			for result := range reorderResults(in) {
+				got = append(got, result.Index)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderedFlag(t *testing.T) {
+	const n = 16
+	var targets []string
+	for i := 1; i <= n; i++ {
+		targets = append(targets, fmt.Sprintf("192.0.2.%d", i))
+	}
+	// Earlier targets answer later, so they complete in reverse.
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		last, _ := strconv.Atoi(ip[strings.LastIndex(ip, ".")+1:])
+		time.Sleep(time.Duration(n-last) * 5 * time.Millisecond)
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443],"hostnames":[%q]}`, ip, strings.Repeat("x", 4096))
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	tests := []struct {
+		name    string
+		ordered bool
+	}{
+		{name: "completion order"},
+		{name: "input order", ordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"-concurrency", strconv.Itoa(n), "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}
+			if tt.ordered {
+				args = append(args, "-ordered")
+			}
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(args, targets...)...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+
+			// Every line is a whole record, however many workers wrote.
+			var got []string
+			for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+				var record hostinfo.CombinedResponse
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("line %q is not a record: %v", line, err)
+				}
+				got = append(got, record.IP)
+			}
+			sorted := slices.Clone(got)
+			slices.SortFunc(sorted, func(a, b string) int { return slices.Index(targets, a) - slices.Index(targets, b) })
+			if !slices.Equal(sorted, targets) {
+				t.Fatalf("got records for %q, want one per target", got)
+			}
+			if tt.ordered && !slices.Equal(got, targets) {
+				t.Errorf("got %q, want input order", got)
+			}
+		})
+	}
+}
+
+func TestResolveOnly(t *testing.T) {
+	resolver := stubResolver(t, map[string]string{"a.example.test.": "192.0.2.1", "b.example.test.": "192.0.2.2"})
+	shodan, shodanRequests := countingStub(t, `{"ports":[443]}`)
+	ipinfo, ipinfoRequests := countingStub(t, `{"country":"US"}`)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "JSON",
+			want: []string{`{"target":"a.example.test","ip":"192.0.2.1"}`, `{"target":"b.example.test","ip":"192.0.2.2"}`},
+		},
+		{name: "selected fields", args: []string{"-select", "ip"}, want: []string{`{"ip":"192.0.2.1"}`, `{"ip":"192.0.2.2"}`}},
+		{name: "template", args: []string{"-template", "{{.Target}} {{.IP}}"}, want: []string{"a.example.test 192.0.2.1", "b.example.test 192.0.2.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-resolve-only", "-compact", "-ordered", "-r", resolver, "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(args, "a.example.test", "b.example.test")...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if got := strings.Split(strings.TrimSpace(stdout), "\n"); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if n, m := shodanRequests.Load(), ipinfoRequests.Load(); n != 0 || m != 0 {
+		t.Errorf("got %d Shodan and %d ipinfo requests, want none", n, m)
+	}
+}
+
+func TestOnlyIP(t *testing.T) {
+	resolver := stubResolver(t, map[string]string{
+		"a.example.test.":   "192.0.2.1",
+		"b.example.test.":   "192.0.2.2",
+		"cdn.example.test.": "192.0.2.1",
+		"multi.test.":       "192.0.2.3,192.0.2.4",
+	})
+	shodan, shodanRequests := countingStub(t, `{"ports":[443]}`)
+	ipinfo, ipinfoRequests := countingStub(t, `{"country":"US"}`)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "first IP of each target", want: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+		{name: "all IPs", args: []string{"-all-ips"}, want: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-only-ip", "-ordered", "-r", resolver, "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(),
+				append(args, "a.example.test", "b.example.test", "cdn.example.test", "192.0.2.2", "multi.test")...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			got := strings.Split(strings.TrimSpace(stdout), "\n")
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if n, m := shodanRequests.Load(), ipinfoRequests.Load(); n != 0 || m != 0 {
+		t.Errorf("got %d Shodan and %d ipinfo requests, want none", n, m)
+	}
+}
+
+func TestPrivateFlags(t *testing.T) {
+	shodan, shodanRequests := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, "{}")
+	tests := []struct {
+		name         string
+		flag         string
+		want         []string
+		wantRequests int32
+	}{
+		{name: "skip", flag: "-skip-private", want: []string{`{"ip":"8.8.8.8","ports":[443]}`}, wantRequests: 1},
+		{
+			name:         "mark",
+			flag:         "-mark-private",
+			want:         []string{`{"ip":"10.0.0.1","private":true}`, `{"ip":"127.0.0.1","private":true}`, `{"ip":"8.8.8.8","ports":[443]}`},
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodanRequests.Store(0)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), tt.flag, "-compact", "-ordered", "-select", "ip,ports,private",
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "10.0.0.1", "127.0.0.1", "8.8.8.8")
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if got := strings.Split(strings.TrimSpace(stdout), "\n"); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if n := shodanRequests.Load(); n != tt.wantRequests {
+				t.Errorf("got %d Shodan requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestUserAgentFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want func(ua string) bool
+	}{
+		{name: "default", want: func(ua string) bool { return strings.HasPrefix(ua, "hostinfo/") }},
+		{name: "custom", args: []string{"-user-agent", "scanner/1.0"}, want: func(ua string) bool { return ua == "scanner/1.0" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			agents := map[string]string{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				agents[r.Method+" "+r.URL.Path] = r.Header.Get("User-Agent")
+				mu.Unlock()
+				fmt.Fprint(w, `{"ip":"192.0.2.1","ports":[443]}`)
+			}))
+			defer srv.Close()
+
+			args := append(tt.args, "-shodan-url", srv.URL, "-ipinfo-url", srv.URL+"/ipinfo",
+				"-webhook", srv.URL+"/hook", "-es-url", srv.URL, "192.0.2.1")
+			status, _, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, endpoint := range []string{"GET /192.0.2.1", "GET /ipinfo/192.0.2.1/json", "POST /hook", "POST /_bulk"} {
+				if ua, ok := agents[endpoint]; !ok || !tt.want(ua) {
+					t.Errorf("%s got User-Agent %q (requested %v)", endpoint, ua, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendSourceFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "default"},
+		{name: "enabled", args: []string{"-append-source"}, want: map[string]string{"geo": hostinfo.GeoProviderIPInfo, "ports": hostinfo.SourceInternetDB}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			var got hostinfo.CombinedResponse
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("%v in %q", err, stdout)
+			}
+			if !maps.Equal(got.Sources, tt.want) {
+				t.Errorf("got sources %v, want %v", got.Sources, tt.want)
+			}
+		})
+	}
+}
+
+// captureLog sends the default logger's output to the returned buffer
+// until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestCheckShodanCredits(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		stop    bool
+		wantLog string
+		wantErr error
+	}{
+		{name: "enough credits", status: http.StatusOK, body: `{"plan":"dev","query_credits":100}`},
+		{name: "low credits", status: http.StatusOK, body: `{"plan":"dev","query_credits":2}`, wantLog: "Shodan query credits low"},
+		{name: "exhausted", status: http.StatusOK, body: `{"plan":"dev","query_credits":0}`, wantLog: "Shodan query credits exhausted"},
+		{name: "exhausted with -stop-on-credits", status: http.StatusOK, body: `{"plan":"dev","query_credits":0}`, stop: true, wantLog: "stopping", wantErr: hostinfo.ErrNoCredits},
+		{name: "low with -stop-on-credits", status: http.StatusOK, body: `{"plan":"dev","query_credits":2}`, stop: true, wantLog: "Shodan query credits low"},
+		{name: "check failed", status: http.StatusUnauthorized, body: `{"error":"invalid key"}`, stop: true, wantLog: "checking Shodan credits failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argStopOnCredits, tt.stop)
+			logs := captureLog(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			client := &hostinfo.Client{ShodanAPIURL: srv.URL, ShodanAPIKey: "key"}
+			if err := checkShodanCredits(context.Background(), client, 10); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := logs.String(); (tt.wantLog == "" && got != "") || !strings.Contains(got, tt.wantLog) {
+				t.Errorf("got log %q, want %q", got, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestStopOnCredits(t *testing.T) {
+	const total = 20
+	tests := []struct {
+		name        string
+		stop        bool
+		wantTargets func(n int) bool
+	}{
+		{name: "every target processed", wantTargets: func(n int) bool { return n == total }},
+		{name: "stopped", stop: true, wantTargets: func(n int) bool { return n < total }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argStopOnCredits, tt.stop)
+			logs := captureLog(t)
+			hostAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusPaymentRequired)
+				fmt.Fprint(w, `{"error":"Insufficient query credits"}`)
+			}))
+			defer hostAPI.Close()
+			ipinfo, _ := countingStub(t, `{"country":"US"}`)
+
+			client := &hostinfo.Client{ShodanAPIURL: hostAPI.URL, ShodanAPIKey: "key", IPInfoURL: ipinfo.URL, Concurrency: 1}
+			targets := make(chan string, total)
+			for i := range total {
+				targets <- fmt.Sprintf("192.0.2.%d", i+1)
+			}
+			close(targets)
+			stats := processTargets(context.Background(), client, targets, total, false, io.Discard)
+			if !tt.wantTargets(stats.targets) {
+				t.Errorf("processed %d of %d targets", stats.targets, total)
+			}
+			if got := strings.Count(logs.String(), "Shodan query credits exhausted"); got != 1 {
+				t.Errorf("got %d credit warnings, want 1; log:\n%s", got, logs)
+			}
+		})
+	}
+}
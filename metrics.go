@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsShutdownTimeout bounds how long the metrics server waits for
+// in-flight scrapes when the run ends.
+const metricsShutdownTimeout = 5 * time.Second
+
+// metrics is set when -metrics-addr is given.
+var metrics *scanMetrics
+
+// scanMetrics holds the Prometheus metrics of a run. It implements
+// hostinfo.Observer for the client's requests and cache lookups. A nil
+// *scanMetrics is a no-op.
+type scanMetrics struct {
+	registry *prometheus.Registry
+	targets  *prometheus.CounterVec
+	cache    *prometheus.CounterVec
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+func newScanMetrics() *scanMetrics {
+	m := &scanMetrics{
+		registry: prometheus.NewRegistry(),
+		targets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hostinfo_targets_total",
+			Help: "Targets processed, by result.",
+		}, []string{"result"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hostinfo_cache_lookups_total",
+			Help: "Result cache lookups, by result.",
+		}, []string{"result"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hostinfo_http_requests_total",
+			Help: "Outbound HTTP requests, by provider and status code.",
+		}, []string{"provider", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "hostinfo_http_request_duration_seconds",
+			Help:    "Time until the response headers of outbound HTTP requests arrived, by provider.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider"}),
+	}
+	m.registry.MustRegister(m.targets, m.cache, m.requests, m.latency)
+	return m
+}
+
+// ObserveTarget counts a processed target.
+func (m *scanMetrics) ObserveTarget(failed bool) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if failed {
+		result = "failed"
+	}
+	m.targets.WithLabelValues(result).Inc()
+}
+
+func (m *scanMetrics) ObserveRequest(provider string, status int, duration time.Duration, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(status)
+	}
+	m.requests.WithLabelValues(provider, code).Inc()
+	m.latency.WithLabelValues(provider).Observe(duration.Seconds())
+}
+
+func (m *scanMetrics) ObserveCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cache.WithLabelValues(result).Inc()
+}
+
+// serve exposes the metrics on addr at /metrics until ctx is done or the
+// returned function is called, which waits for the server to stop.
+func (m *scanMetrics) serve(ctx context.Context, addr string) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("serving metrics failed", "addr", addr, "err", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancelShutdown()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	return func() {
+		cancel()
+		<-stopped
+	}, nil
+}
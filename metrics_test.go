@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+func TestScanMetricsRequests(t *testing.T) {
+	tests := []struct {
+		provider string
+		status   int
+		err      error
+		code     string
+	}{
+		{provider: hostinfo.ProviderShodan, status: 200, code: "200"},
+		{provider: hostinfo.ProviderIPInfo, status: 429, code: "429"},
+		{provider: hostinfo.ProviderNVD, err: errors.New("timeout"), code: "error"},
+		{provider: hostinfo.ProviderTarget, status: 200, code: "200"},
+		{provider: hostinfo.ProviderTarget, status: 200, code: "200"},
+	}
+	m := newScanMetrics()
+	for _, tt := range tests {
+		m.ObserveRequest(tt.provider, tt.status, time.Millisecond, tt.err)
+	}
+
+	want := map[string]float64{
+		"shodan 200": 1,
+		"target 200": 2,
+		"ipinfo 429": 1,
+		"nvd error":  1,
+	}
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	latencySeries := 0
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			switch family.GetName() {
+			case "hostinfo_http_requests_total":
+				got[labels["provider"]+" "+labels["code"]] = metric.GetCounter().GetValue()
+			case "hostinfo_http_request_duration_seconds":
+				latencySeries++
+			}
+		}
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got requests %v, want %v", got, want)
+	}
+	if latencySeries != 4 {
+		t.Errorf("got %d latency series, want one per provider", latencySeries)
+	}
+}
+
+func TestScanMetricsNil(t *testing.T) {
+	var m *scanMetrics
+	m.ObserveTarget(true)
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorRecord is written in place of a hostinfo.CombinedResponse for failed
+// targets when -errors-inline is set.
+type ErrorRecord struct {
+	Target string `json:"target" yaml:"target"`
+	Error  string `json:"error" yaml:"error"`
+}
+
+// selectedFields holds the parsed -select value.
+var selectedFields []string
+
+var outputFormats = []string{"json", "json-array", "csv", "yaml", "table", "pretty"}
+
+// isJSONFormat reports whether format writes JSON records.
+func isJSONFormat(format string) bool {
+	return format == "json" || format == "json-array"
+}
+
+// csvListSeparator joins list fields such as ports into a single CSV cell.
+const csvListSeparator = "|"
+
+var csvHeader = []string{
+	"target", "ip", "hostname", "city", "region", "country", "loc", "org", "postal", "timezone",
+	"hostnames", "ports", "cpes", "tags", "vulns", "error",
+}
+
+type resultWriter interface {
+	WriteResult(combined hostinfo.CombinedResponse) error
+	WriteError(target string, err error) error
+	// Close writes anything the format buffers or appends after the last
+	// record.
+	Close() error
+}
+
+// jsonResultWriter writes one JSON object per line or, with array set, a
+// single JSON array streamed one element at a time.
+type jsonResultWriter struct {
+	w       io.Writer
+	indent  bool
+	fields  []string
+	array   bool
+	started bool
+}
+
+func (jw *jsonResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	jsonData, err := json.Marshal(combined)
+	if err != nil {
+		return err
+	}
+	if len(jw.fields) > 0 {
+		jsonData, err = selectFields(jsonData, jw.fields)
+		if err != nil {
+			return err
+		}
+	}
+	return jw.write(jsonData)
+}
+
+func (jw *jsonResultWriter) WriteError(target string, err error) error {
+	jsonData, err := json.Marshal(ErrorRecord{Target: target, Error: err.Error()})
+	if err != nil {
+		return err
+	}
+	return jw.write(jsonData)
+}
+
+func (jw *jsonResultWriter) Close() error {
+	if !jw.array {
+		return nil
+	}
+	closing := "\n]\n"
+	if !jw.started {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, closing)
+	return err
+}
+
+func (jw *jsonResultWriter) write(jsonData []byte) error {
+	prefix := ""
+	if jw.array {
+		prefix = "  "
+	}
+	if jw.indent {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, jsonData, prefix, "  "); err != nil {
+			return err
+		}
+		jsonData = indented.Bytes()
+	}
+
+	if !jw.array {
+		_, err := fmt.Fprintln(jw.w, string(jsonData))
+		return err
+	}
+	separator := ",\n"
+	if !jw.started {
+		separator = "[\n"
+	}
+	jw.started = true
+	_, err := io.WriteString(jw.w, separator+prefix+string(jsonData))
+	return err
+}
+
+// jsonFieldNames lists the JSON keys a value of type t can produce,
+// including those of embedded structs.
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseSelectFields splits a -select value and checks every name against
+// the keys of hostinfo.CombinedResponse.
+func parseSelectFields(value string) ([]string, error) {
+	known := jsonFieldNames(reflect.TypeFor[hostinfo.CombinedResponse]())
+
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(known, field) {
+			return nil, fmt.Errorf("unknown field %q (valid fields: %s)", field, strings.Join(known, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// selectFields reduces a JSON object to the given keys, in the given order.
+// Keys that were omitted from the object are left out.
+func selectFields(jsonData []byte, fields []string) ([]byte, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &values); err != nil {
+		return nil, err
+	}
+
+	var selected bytes.Buffer
+	selected.WriteByte('{')
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+		if selected.Len() > 1 {
+			selected.WriteByte(',')
+		}
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		selected.Write(key)
+		selected.WriteByte(':')
+		selected.Write(value)
+	}
+	selected.WriteByte('}')
+	return selected.Bytes(), nil
+}
+
+type csvResultWriter struct {
+	w *csv.Writer
+}
+
+func newCSVResultWriter(w io.Writer) (*csvResultWriter, error) {
+	cw := &csvResultWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	cw.w.Flush()
+	return cw, cw.w.Error()
+}
+
+func (cw *csvResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	ports := make([]string, len(combined.Ports))
+	for i, port := range combined.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+
+	row := []string{
+		combined.Target,
+		combined.IP,
+		combined.Hostname,
+		combined.City,
+		combined.Region,
+		combined.Country,
+		combined.Loc,
+		combined.Org,
+		combined.Postal,
+		combined.Timezone,
+		strings.Join(combined.Hostnames, csvListSeparator),
+		strings.Join(ports, csvListSeparator),
+		strings.Join(combined.CPEs, csvListSeparator),
+		strings.Join(combined.Tags, csvListSeparator),
+		strings.Join(hostinfo.VulnIDs(combined.Vulns), csvListSeparator),
+		"",
+	}
+	return cw.write(row)
+}
+
+func (cw *csvResultWriter) WriteError(target string, err error) error {
+	row := make([]string, len(csvHeader))
+	row[0] = target
+	row[len(row)-1] = err.Error()
+	return cw.write(row)
+}
+
+func (cw *csvResultWriter) Close() error {
+	return nil
+}
+
+func (cw *csvResultWriter) write(row []string) error {
+	if err := cw.w.Write(row); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// yamlResultWriter writes each record as its own YAML document.
+type yamlResultWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (yw *yamlResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	return yw.write(combined)
+}
+
+func (yw *yamlResultWriter) WriteError(target string, err error) error {
+	return yw.write(ErrorRecord{Target: target, Error: err.Error()})
+}
+
+func (yw *yamlResultWriter) Close() error {
+	return nil
+}
+
+func (yw *yamlResultWriter) write(record any) error {
+	yamlData, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if yw.started {
+		if _, err := io.WriteString(yw.w, "---\n"); err != nil {
+			return err
+		}
+	}
+	yw.started = true
+
+	_, err = yw.w.Write(yamlData)
+	return err
+}
+
+// tableColumnWidth is the width long table cells are truncated to unless
+// -wide is set.
+const tableColumnWidth = 32
+
+// tableResultWriter prints an aligned table. Column widths depend on every
+// row, so the table is only written out on Close.
+type tableResultWriter struct {
+	w *tabwriter.Writer
+}
+
+func newTableResultWriter(w io.Writer) (*tableResultWriter, error) {
+	tw := &tableResultWriter{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	return tw, tw.writeRow("TARGET", "IP", "COUNTRY", "ORG", "PORTS", "VULNS")
+}
+
+func (tw *tableResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	target := combined.Target
+	if target == "" {
+		target = combined.IP
+	}
+	return tw.writeRow(
+		target,
+		combined.IP,
+		combined.Country,
+		combined.Org,
+		strconv.Itoa(len(combined.Ports)),
+		strconv.Itoa(len(combined.Vulns)),
+	)
+}
+
+func (tw *tableResultWriter) WriteError(target string, err error) error {
+	return tw.writeRow(target, "error: "+err.Error())
+}
+
+func (tw *tableResultWriter) Close() error {
+	return tw.w.Flush()
+}
+
+func (tw *tableResultWriter) writeRow(cells ...string) error {
+	for i, cell := range cells {
+		cell = strings.ReplaceAll(cell, "\t", " ")
+		if !argWide {
+			cell = truncate(cell, tableColumnWidth)
+		}
+		cells[i] = cell
+	}
+	_, err := fmt.Fprintln(tw.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func truncate(value string, width int) string {
+	runes := []rune(value)
+	if len(runes) <= width {
+		return value
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// colorOutput is set when the pretty format may emit ANSI colors, as
+// decided from -color and whether stdout is a terminal.
+var colorOutput bool
+
+var colorModes = []string{"auto", "always", "never"}
+
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiCyan  = "\033[36m"
+)
+
+// prettyResultWriter prints a compact block per record meant for reading in
+// a terminal, with the IP and vulns highlighted when colors are on.
+type prettyResultWriter struct {
+	w     io.Writer
+	color bool
+}
+
+func (pw *prettyResultWriter) paint(code, text string) string {
+	if !pw.color {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+func (pw *prettyResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	var block strings.Builder
+	block.WriteString(pw.paint(ansiBold+ansiCyan, combined.IP))
+	if combined.Hostname != "" {
+		fmt.Fprintf(&block, " (%s)", combined.Hostname)
+	}
+	if combined.Target != "" && combined.Target != combined.IP {
+		fmt.Fprintf(&block, " [%s]", combined.Target)
+	}
+	block.WriteByte('\n')
+
+	if combined.Org != "" {
+		fmt.Fprintf(&block, "  org:   %s\n", combined.Org)
+	}
+	var location []string
+	for _, part := range []string{combined.City, combined.Region, combined.Country} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	if len(location) > 0 {
+		fmt.Fprintf(&block, "  loc:   %s\n", strings.Join(location, ", "))
+	}
+	if len(combined.Ports) > 0 {
+		ports := make([]string, len(combined.Ports))
+		for i, port := range combined.Ports {
+			ports[i] = strconv.Itoa(port)
+		}
+		fmt.Fprintf(&block, "  ports: %s\n", strings.Join(ports, ", "))
+	}
+	if len(combined.Vulns) > 0 {
+		vulns := make([]string, len(combined.Vulns))
+		for i, vuln := range combined.Vulns {
+			vulns[i] = vuln.ID
+			if vuln.CVSS > 0 {
+				vulns[i] += fmt.Sprintf(" (%.1f)", vuln.CVSS)
+			}
+		}
+		fmt.Fprintf(&block, "  vulns: %s\n", pw.paint(ansiBold+ansiRed, strings.Join(vulns, ", ")))
+	}
+	block.WriteByte('\n')
+
+	_, err := io.WriteString(pw.w, block.String())
+	return err
+}
+
+func (pw *prettyResultWriter) WriteError(target string, err error) error {
+	_, werr := fmt.Fprintf(pw.w, "%s\n  %s\n\n", pw.paint(ansiBold, target), pw.paint(ansiRed, "error: "+err.Error()))
+	return werr
+}
+
+func (pw *prettyResultWriter) Close() error {
+	return nil
+}
+
+// outputTemplate holds the compiled -template value.
+var outputTemplate *template.Template
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+func parseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(templateFuncs).Parse(text)
+}
+
+// templateResultWriter renders each record with the -template value, one
+// line per record.
+type templateResultWriter struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+func (tw *templateResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	var rendered bytes.Buffer
+	if err := tw.tmpl.Execute(&rendered, combined); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(rendered.Bytes(), []byte("\n")) {
+		rendered.WriteByte('\n')
+	}
+	_, err := tw.w.Write(rendered.Bytes())
+	return err
+}
+
+func (tw *templateResultWriter) WriteError(target string, err error) error {
+	_, werr := fmt.Fprintf(tw.w, "%s error: %v\n", target, err)
+	return werr
+}
+
+func (tw *templateResultWriter) Close() error {
+	return nil
+}
+
+func newResultWriter(w io.Writer, indent bool) (resultWriter, error) {
+	if argFacet != "" {
+		return newFacetResultWriter(w, argFacet)
+	}
+	if queryPath != nil {
+		return &queryResultWriter{w: w, path: queryPath}, nil
+	}
+	if outputTemplate != nil {
+		return &templateResultWriter{w: w, tmpl: outputTemplate}, nil
+	}
+
+	switch argFormat {
+	case "json":
+		return &jsonResultWriter{w: w, indent: indent, fields: selectedFields}, nil
+	case "json-array":
+		return &jsonResultWriter{w: w, indent: indent, fields: selectedFields, array: true}, nil
+	case "csv":
+		return newCSVResultWriter(w)
+	case "yaml":
+		return &yamlResultWriter{w: w}, nil
+	case "table":
+		return newTableResultWriter(w)
+	case "pretty":
+		return &prettyResultWriter{w: w, color: colorOutput}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", argFormat)
+	}
+}
@@ -0,0 +1,746 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+	"gopkg.in/yaml.v3"
+)
+
+// sampleRecord returns a record with every commonly written field set.
+func sampleRecord() hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.Target = "example.test"
+	r.IP = "192.0.2.1"
+	r.Hostname = "host.example.test"
+	r.City = "Mountain View"
+	r.Region = "California"
+	r.Country = "US"
+	r.Loc = "37.4056,-122.0775"
+	r.Org = "AS64500 Example, Inc."
+	r.Postal = "94043"
+	r.Timezone = "America/Los_Angeles"
+	r.Hostnames = []string{"a.example.test", "b.example.test"}
+	r.Ports = []int{22, 443}
+	r.CPEs = []string{"cpe:/a:openbsd:openssh"}
+	r.Tags = []string{"cloud"}
+	r.Vulns = []hostinfo.Vuln{{ID: "CVE-2021-44228"}}
+	return r
+}
+
+func TestCSVResultWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(rw resultWriter) error
+		want  []string
+	}{
+		{
+			name:  "record",
+			write: func(rw resultWriter) error { return rw.WriteResult(sampleRecord()) },
+			want: []string{
+				"example.test", "192.0.2.1", "host.example.test", "Mountain View", "California", "US",
+				"37.4056,-122.0775", "AS64500 Example, Inc.", "94043", "America/Los_Angeles",
+				"a.example.test|b.example.test", "22|443", "cpe:/a:openbsd:openssh", "cloud", "CVE-2021-44228", "",
+			},
+		},
+		{
+			name:  "empty record",
+			write: func(rw resultWriter) error { return rw.WriteResult(hostinfo.CombinedResponse{}) },
+			want:  make([]string, len(csvHeader)),
+		},
+		{
+			name:  "error",
+			write: func(rw resultWriter) error { return rw.WriteError("bad.test", errors.New("no such host")) },
+			want:  append(append([]string{"bad.test"}, make([]string, len(csvHeader)-2)...), "no such host"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			rw, err := newCSVResultWriter(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(rw); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+			if err != nil {
+				t.Fatalf("output is not valid CSV: %v\n%s", err, out.String())
+			}
+			if len(rows) != 2 {
+				t.Fatalf("got %d rows, want the header and one record", len(rows))
+			}
+			if !slices.Equal(rows[0], csvHeader) {
+				t.Errorf("got header %q, want %q", rows[0], csvHeader)
+			}
+			if !slices.Equal(rows[1], tt.want) {
+				t.Errorf("got row %q, want %q", rows[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	// The target fails to resolve, so the only record is its inline error.
+	const record = "{\n  \"target\": \"missing.test\",\n  \"error\": "
+	resolver := nxdomainResolver(t)
+	tests := []struct {
+		name     string
+		existing string
+		append   bool
+		want     string
+	}{
+		{name: "new file", want: record},
+		{name: "truncated", existing: "old\n", want: record},
+		{name: "appended", existing: "old\n", append: true, want: "old\n" + record},
+		{name: "append to new file", append: true, want: record},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "out.json")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := []string{"-errors-inline", "-r", resolver, "-o", "out.json"}
+			if tt.append {
+				args = append(args, "-append")
+			}
+			status, stdout, stderr := runHostinfoStreams(t, dir, append(args, "missing.test")...)
+			if status != exitAllFailed {
+				t.Fatalf("got exit status %d, want %d; stderr:\n%s", status, exitAllFailed, stderr)
+			}
+			if stdout != "" {
+				t.Errorf("got stdout %q, want the records in the file only", stdout)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(got), tt.want) || strings.Count(string(got), "{") != 1 {
+				t.Errorf("got file %q, want it to start with %q and hold one record", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelectFields(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "ip,ports", want: []string{"ip", "ports"}},
+		{value: " ip , country ,, ports ", want: []string{"ip", "country", "ports"}},
+		{value: "target,hostnames,vulns", want: []string{"target", "hostnames", "vulns"}},
+		{value: "ip,Ports", wantErr: true},
+		{value: "ip,nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelectFields(tt.value)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("parseSelectFields(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestJSONResultWriterSelect(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{name: "ip and ports", fields: []string{"ip", "ports"}, want: `{"ip":"192.0.2.1","ports":[22,443]}`},
+		{name: "field order", fields: []string{"ports", "ip"}, want: `{"ports":[22,443],"ip":"192.0.2.1"}`},
+		{name: "omitted field", fields: []string{"ip", "port"}, want: `{"ip":"192.0.2.1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			rw := &jsonResultWriter{w: &out, fields: tt.fields}
+			if err := rw.WriteResult(sampleRecord()); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(out.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "unknown field", args: []string{"-select", "ip,nope"}, want: `unknown field "nope"`},
+		{name: "csv output", args: []string{"-select", "ip", "-format", "csv"}, want: "-select is only supported with JSON output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(tt.args, "192.0.2.1")...)
+			if stdout != "" || !strings.Contains(stderr, tt.want) {
+				t.Errorf("got stdout %q and stderr %q, want only an error mentioning %q", stdout, stderr, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLResultWriter(t *testing.T) {
+	second := sampleRecord()
+	second.Target, second.IP, second.Ports = "192.0.2.2", "192.0.2.2", []int{80}
+	tests := []struct {
+		name    string
+		records []hostinfo.CombinedResponse
+	}{
+		{name: "one record", records: []hostinfo.CombinedResponse{sampleRecord()}},
+		{name: "two records", records: []hostinfo.CombinedResponse{sampleRecord(), second}},
+		{name: "empty record", records: []hostinfo.CombinedResponse{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			rw := &yamlResultWriter{w: &out}
+			for _, record := range tt.records {
+				if err := rw.WriteResult(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.Count(out.String(), "---\n"), len(tt.records)-1; got != want {
+				t.Errorf("got %d document separators, want %d:\n%s", got, want, out.String())
+			}
+
+			decoder := yaml.NewDecoder(strings.NewReader(out.String()))
+			for i, want := range tt.records {
+				var got hostinfo.CombinedResponse
+				if err := decoder.Decode(&got); err != nil {
+					t.Fatalf("document %d: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("document %d: got %+v, want %+v", i, got, want)
+				}
+			}
+			var extra any
+			if err := decoder.Decode(&extra); err != io.EOF {
+				t.Errorf("got an extra document %v (%v)", extra, err)
+			}
+		})
+	}
+}
+
+func TestYAMLResultWriterError(t *testing.T) {
+	var out strings.Builder
+	rw := &yamlResultWriter{w: &out}
+	if err := rw.WriteResult(sampleRecord()); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.WriteError("bad.test", errors.New("no such host")); err != nil {
+		t.Fatal(err)
+	}
+	documents := strings.Split(out.String(), "---\n")
+	if len(documents) != 2 {
+		t.Fatalf("got %d documents, want 2:\n%s", len(documents), out.String())
+	}
+	var got ErrorRecord
+	if err := yaml.Unmarshal([]byte(documents[1]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (ErrorRecord{Target: "bad.test", Error: "no such host"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestTableResultWriter(t *testing.T) {
+	longOrg := "AS64500 A Very Long Organization Name Incorporated"
+	tests := []struct {
+		name    string
+		wide    bool
+		wantOrg string
+	}{
+		{name: "truncated", wantOrg: "AS64500 A Very Long Organizat..."},
+		{name: "wide", wide: true, wantOrg: longOrg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argWide, tt.wide)
+			record := sampleRecord()
+			record.Org = longOrg
+			noTarget := sampleRecord()
+			noTarget.Target, noTarget.IP, noTarget.Org, noTarget.Ports, noTarget.Vulns = "", "198.51.100.7", "Ex", nil, nil
+
+			var out strings.Builder
+			rw, err := newTableResultWriter(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range []hostinfo.CombinedResponse{record, noTarget} {
+				if err := rw.WriteResult(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rw.WriteError("bad.test", errors.New("no such host")); err != nil {
+				t.Fatal(err)
+			}
+			if out.Len() != 0 {
+				t.Fatal("table written before Close")
+			}
+			if err := rw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			want := [][]string{
+				{"TARGET", "IP", "COUNTRY", "ORG", "PORTS", "VULNS"},
+				{"example.test", "192.0.2.1", "US", tt.wantOrg, "2", "1"},
+				{"198.51.100.7", "198.51.100.7", "US", "Ex", "0", "0"},
+				{"bad.test", "error: no such host"},
+			}
+			if len(lines) != len(want) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), out.String())
+			}
+			// Cells hold single spaces at most, and columns are padded with two.
+			columnGap := regexp.MustCompile(` {2,}`)
+			for i, line := range lines {
+				if got := columnGap.Split(strings.TrimSpace(line), -1); !slices.Equal(got, want[i]) {
+					t.Errorf("line %d: got %q, want %q", i, got, want[i])
+				}
+			}
+			// Every column starts where the header's does.
+			header := lines[0]
+			for _, line := range lines[1:3] {
+				for _, column := range []string{"IP", "COUNTRY", "ORG", "PORTS", "VULNS"} {
+					at := strings.Index(header, column)
+					if at == 0 || line[at-1] != ' ' || line[at] == ' ' {
+						t.Errorf("column %s misaligned in %q under %q", column, line, header)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value string
+		width int
+		want  string
+	}{
+		{value: "short", width: 10, want: "short"},
+		{value: "exactly10!", width: 10, want: "exactly10!"},
+		{value: "eleven char", width: 10, want: "eleven ..."},
+		{value: "ünïcödé strïng", width: 10, want: "ünïcödé..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.value, tt.width); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateResultWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "fields", template: "{{.IP}} {{.Country}} {{len .Ports}}", want: "192.0.2.1 US 2\n"},
+		{name: "nested and lists", template: "{{.Target}}: {{join .Hostnames \",\"}} {{range .Vulns}}{{.ID}}{{end}}", want: "example.test: a.example.test,b.example.test CVE-2021-44228\n"},
+		{name: "own newline", template: "{{.IP}}\n", want: "192.0.2.1\n"},
+		{name: "unknown field", template: "{{.Nope}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseOutputTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			rw := &templateResultWriter{w: &out, tmpl: tmpl}
+			err = rw.WriteResult(sampleRecord())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	for _, text := range []string{"{{.IP", "{{nope .IP}}", "{{end}}"} {
+		if _, err := parseOutputTemplate(text); err == nil {
+			t.Errorf("parseOutputTemplate(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+// gunzip decompresses data, failing the test unless it is a complete gzip
+// stream.
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not gzip data: %v", err)
+	}
+	plain, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("truncated gzip data: %v", err)
+	}
+	return string(plain)
+}
+
+func TestGzipOutput(t *testing.T) {
+	const record = `{"ip":"192.0.2.1","country":"US","ports":[22,443]}` + "\n"
+	tests := []struct {
+		name     string
+		args     []string
+		file     string
+		wantGzip bool
+	}{
+		{name: ".gz file", args: []string{"-o", "out.json.gz"}, file: "out.json.gz", wantGzip: true},
+		{name: "-gzip file", args: []string{"-gzip", "-o", "out.json"}, file: "out.json", wantGzip: true},
+		{name: "-gzip stdout", args: []string{"-gzip"}, wantGzip: true},
+		{name: "plain file", args: []string{"-o", "out.json"}, file: "out.json"},
+	}
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[22,443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args := append([]string{"-compact", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, dir, append(args, "192.0.2.1")...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			got := []byte(stdout)
+			if tt.file != "" {
+				var err error
+				if got, err = os.ReadFile(filepath.Join(dir, tt.file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			plain := string(got)
+			if tt.wantGzip {
+				plain = gunzip(t, got)
+			}
+			if plain != record {
+				t.Errorf("got %q, want %q", plain, record)
+			}
+		})
+	}
+}
+
+func TestGzipOutputInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	// The second target hangs until the run is interrupted.
+	reached := make(chan struct{})
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		if ip == "192.0.2.2" {
+			close(reached)
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, ip)
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	var stderr strings.Builder
+	cmd := hostinfoCommand(t, dir, "-compact", "-concurrency", "1", "-retries", "0", "-o", "out.json.gz",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2")
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reached:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatalf("second target never started; stderr:\n%s", stderr.String())
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	if got := cmd.ProcessState.ExitCode(); got != 130 {
+		t.Errorf("got exit status %d, want 130; stderr:\n%s", got, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The gzip stream is closed on the interrupt path, so the record
+	// written before it reads back whole.
+	if got, want := gunzip(t, data), `{"ip":"192.0.2.1","ports":[443]}`+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPrettyResultWriter(t *testing.T) {
+	record := sampleRecord()
+	record.Vulns = []hostinfo.Vuln{{ID: "CVE-2021-44228", CVSS: 10}, {ID: "CVE-2023-0001"}}
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{
+			name: "plain",
+			want: "192.0.2.1 (host.example.test) [example.test]\n" +
+				"  org:   AS64500 Example, Inc.\n" +
+				"  loc:   Mountain View, California, US\n" +
+				"  ports: 22, 443\n" +
+				"  vulns: CVE-2021-44228 (10.0), CVE-2023-0001\n\n" +
+				"bad.test\n  error: no such host\n\n",
+		},
+		{
+			name:  "colored",
+			color: true,
+			want: "\033[1m\033[36m192.0.2.1\033[0m (host.example.test) [example.test]\n" +
+				"  org:   AS64500 Example, Inc.\n" +
+				"  loc:   Mountain View, California, US\n" +
+				"  ports: 22, 443\n" +
+				"  vulns: \033[1m\033[31mCVE-2021-44228 (10.0), CVE-2023-0001\033[0m\n\n" +
+				"\033[1mbad.test\033[0m\n  \033[31merror: no such host\033[0m\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			rw := &prettyResultWriter{w: &out, color: tt.color}
+			if err := rw.WriteResult(record); err != nil {
+				t.Fatal(err)
+			}
+			if err := rw.WriteError("bad.test", errors.New("no such host")); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443],"vulns":["CVE-2021-44228"]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","org":"AS64500 Example"}`)
+	tests := []struct {
+		color     string
+		wantColor bool
+	}{
+		{color: "always", wantColor: true},
+		{color: "never"},
+		// Stdout is a pipe here, not a terminal.
+		{color: "auto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-format", "pretty", "-color", tt.color,
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if !strings.Contains(stdout, "CVE-2021-44228") {
+				t.Errorf("got %q, want the vuln listed", stdout)
+			}
+			if got := strings.Contains(stdout, "\033["); got != tt.wantColor {
+				t.Errorf("got ANSI codes %v, want %v in %q", got, tt.wantColor, stdout)
+			}
+		})
+	}
+}
+
+func TestIndentFlags(t *testing.T) {
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "one.txt"), []byte("192.0.2.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		records    int
+		wantIndent bool
+	}{
+		{name: "single target", args: []string{"192.0.2.1"}, records: 1, wantIndent: true},
+		{name: "single target compact", args: []string{"-compact", "192.0.2.1"}, records: 1},
+		{name: "one-line file", args: []string{"one.txt"}, records: 1},
+		{name: "one-line file pretty", args: []string{"-pretty", "one.txt"}, records: 1, wantIndent: true},
+		{name: "several targets", args: []string{"192.0.2.1", "192.0.2.2"}, records: 2},
+		{name: "several targets pretty", args: []string{"-pretty", "192.0.2.1", "192.0.2.2"}, records: 2, wantIndent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, dir, args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			decoder := json.NewDecoder(strings.NewReader(stdout))
+			records := 0
+			for decoder.More() {
+				var record map[string]any
+				if err := decoder.Decode(&record); err != nil {
+					t.Fatalf("%v in %q", err, stdout)
+				}
+				records++
+			}
+			if records != tt.records {
+				t.Errorf("got %d records, want %d", records, tt.records)
+			}
+			lines := strings.Count(stdout, "\n")
+			if indented := lines > records; indented != tt.wantIndent {
+				t.Errorf("got indented %v, want %v:\n%s", indented, tt.wantIndent, stdout)
+			}
+		})
+	}
+}
+
+func TestShodanExtraOutput(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443],"last_seen":"2024-05-01"}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "json", want: `"extra":{"last_seen":"2024-05-01"}`},
+		{format: "yaml", want: "extra:\n    last_seen: \"2024-05-01\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-format", tt.format, "-compact",
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if !strings.Contains(stdout, tt.want) {
+				t.Errorf("got\n%s\nwant it to contain %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONArrayResultWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		records int
+		errors  int
+		indent  bool
+	}{
+		{name: "empty"},
+		{name: "one record", records: 1},
+		{name: "several records", records: 3},
+		{name: "records and errors", records: 2, errors: 2},
+		{name: "errors only", errors: 1},
+		{name: "indented", records: 2, errors: 1, indent: true},
+		{name: "indented empty", indent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			rw := &jsonResultWriter{w: &out, indent: tt.indent, array: true}
+			for range tt.records {
+				if err := rw.WriteResult(sampleRecord()); err != nil {
+					t.Fatal(err)
+				}
+				// Records are written as they arrive rather than held
+				// until Close.
+				if !bytes.HasSuffix(out.Bytes(), []byte("}")) {
+					t.Fatalf("record not written yet: %q", out.String())
+				}
+			}
+			for range tt.errors {
+				if err := rw.WriteError("bad.example", errors.New("lookup failed")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []map[string]any
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("output is not a JSON array: %v\n%s", err, out.String())
+			}
+			if len(got) != tt.records+tt.errors {
+				t.Errorf("got %d elements, want %d", len(got), tt.records+tt.errors)
+			}
+			wantLines := 1
+			if n := tt.records + tt.errors; n > 0 {
+				wantLines = n + 2
+			}
+			if lines := strings.Count(out.String(), "\n"); !tt.indent && lines != wantLines {
+				t.Errorf("got %d lines, want one per element plus the brackets:\n%s", lines, out.String())
+			}
+		})
+	}
+}
+
+func TestJSONArrayFormat(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"country":"US"}`)
+	tests := []struct {
+		name    string
+		targets []string
+		want    int
+	}{
+		{name: "no records", targets: []string{"-country", "DE", "192.0.2.1"}},
+		{name: "one record", targets: []string{"192.0.2.1"}, want: 1},
+		{name: "two records", targets: []string{"192.0.2.1", "192.0.2.2"}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-format", "json-array", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.targets...)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			var got []hostinfo.CombinedResponse
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("output is not a JSON array: %v\n%s", err, stdout)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d records, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultRIPEStatURL is the RIPEstat announced-prefixes endpoint used when
+// Client.RIPEStatURL is empty.
+const DefaultRIPEStatURL = "https://stat.ripe.net/data/announced-prefixes/data.json"
+
+type ripeStatPrefixesResponse struct {
+	Data struct {
+		Prefixes []struct {
+			Prefix string `json:"prefix"`
+		} `json:"prefixes"`
+	} `json:"data"`
+}
+
+// LookupASNPrefixes returns the prefixes an autonomous system such as
+// "AS15169" currently announces, according to RIPEstat. Answers are
+// memoized for the lifetime of the Client.
+func (c *Client) LookupASNPrefixes(ctx context.Context, asn string) ([]string, error) {
+	asn = strings.ToUpper(asn)
+
+	c.asnMutex.Lock()
+	prefixes, ok := c.asnPrefixes[asn]
+	c.asnMutex.Unlock()
+	if ok {
+		return prefixes, nil
+	}
+
+	endpoint := c.RIPEStatURL
+	if endpoint == "" {
+		endpoint = DefaultRIPEStatURL
+	}
+
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderRIPEStat), http.MethodGet, endpoint+"?resource="+url.QueryEscape(asn), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doWithRetry(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if err := checkResponse(resp, "stat.ripe.net"); err != nil {
+		return nil, err
+	}
+
+	var ripeData ripeStatPrefixesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ripeData); err != nil {
+		return nil, err
+	}
+	if len(ripeData.Data.Prefixes) == 0 {
+		return nil, fmt.Errorf("stat.ripe.net: no prefixes announced by %s: %w", asn, ErrNoData)
+	}
+
+	prefixes = make([]string, len(ripeData.Data.Prefixes))
+	for i, prefix := range ripeData.Data.Prefixes {
+		prefixes[i] = prefix.Prefix
+	}
+
+	c.asnMutex.Lock()
+	defer c.asnMutex.Unlock()
+	if c.asnPrefixes == nil {
+		c.asnPrefixes = map[string][]string{}
+	}
+	c.asnPrefixes[asn] = prefixes
+	return prefixes, nil
+}
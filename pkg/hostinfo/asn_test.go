@@ -0,0 +1,66 @@
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLookupASNPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		asn     string
+		handler http.HandlerFunc
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "announced",
+			asn:     "as64500",
+			handler: respond(http.StatusOK, `{"data":{"prefixes":[{"prefix":"192.0.2.0/24"},{"prefix":"2001:db8::/32"}]}}`),
+			want:    []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		{name: "nothing announced", asn: "AS64501", handler: respond(http.StatusOK, `{"data":{"prefixes":[]}}`), wantErr: ErrNoData},
+		{name: "rate limited", asn: "AS64502", handler: respond(http.StatusTooManyRequests, "{}"), wantErr: ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var resource string
+			srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				resource = r.URL.Query().Get("resource")
+				tt.handler(w, r)
+			})
+			client := &Client{RIPEStatURL: srv.URL}
+			got, err := client.LookupASNPrefixes(context.Background(), tt.asn)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, %v, want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resource != "AS64500" {
+				t.Errorf("queried resource %q, want AS64500", resource)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			// The mapping is cached for the rest of the run.
+			again, err := client.LookupASNPrefixes(context.Background(), "AS64500")
+			if err != nil || !slices.Equal(again, tt.want) {
+				t.Errorf("second lookup got %q, %v", again, err)
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("got %d requests, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package hostinfo
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestIsBogon(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "10.0.0.1", want: true},
+		{ip: "127.0.0.1", want: true},
+		{ip: "172.31.255.255", want: true},
+		{ip: "172.32.0.1", want: false},
+		{ip: "192.168.1.1", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "100.64.0.1", want: true},
+		{ip: "192.0.2.1", want: true},
+		{ip: "224.0.0.251", want: true},
+		{ip: "::ffff:10.0.0.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "2001:db8::1", want: true},
+		{ip: "8.8.8.8", want: false},
+		{ip: "1.1.1.1", want: false},
+		{ip: "2606:4700:4700::1111", want: false},
+		{ip: "example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IsBogon(tt.ip); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTargetPrivate(t *testing.T) {
+	targets := []string{"10.0.0.1", "127.0.0.1", "8.8.8.8"}
+	tests := []struct {
+		name        string
+		skip        bool
+		mark        bool
+		wantRecords []string
+		wantPrivate []string
+		wantQueried []string
+	}{
+		{
+			name:        "queried by default",
+			wantRecords: targets,
+			wantQueried: []string{"10.0.0.1", "127.0.0.1", "8.8.8.8"},
+		},
+		{name: "skipped", skip: true, wantRecords: []string{"8.8.8.8"}, wantQueried: []string{"8.8.8.8"}},
+		{
+			name:        "marked",
+			mark:        true,
+			wantRecords: targets,
+			wantPrivate: []string{"10.0.0.1", "127.0.0.1"},
+			wantQueried: []string{"8.8.8.8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodan, queried := queriedIPs()
+			client := stubClient(t, shodan, respond(http.StatusOK, "{}"))
+			client.SkipPrivate, client.MarkPrivate = tt.skip, tt.mark
+
+			var records, private []string
+			for _, target := range targets {
+				results, err := client.ProcessTarget(context.Background(), target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, result := range results {
+					records = append(records, result.IP)
+					if result.Private {
+						private = append(private, result.IP)
+						if len(result.Ports) > 0 || result.Country != "" {
+							t.Errorf("private record %+v carries source data", result)
+						}
+					}
+				}
+			}
+			if !slices.Equal(records, tt.wantRecords) {
+				t.Errorf("got records for %q, want %q", records, tt.wantRecords)
+			}
+			if !slices.Equal(private, tt.wantPrivate) {
+				t.Errorf("got private records for %q, want %q", private, tt.wantPrivate)
+			}
+			if got := queried(); !slices.Equal(got, tt.wantQueried) {
+				t.Errorf("Shodan was asked about %q, want %q", got, tt.wantQueried)
+			}
+		})
+	}
+}
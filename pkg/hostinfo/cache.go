@@ -0,0 +1,176 @@
+package hostinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached enrichment result for a single IP.
+type cacheEntry struct {
+	Response  CombinedResponse `json:"response"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// resolutionEntry is a cached DNS resolution for a single hostname.
+type resolutionEntry struct {
+	Addresses []string  `json:"addresses"`
+	Timestamp time.Time `json:"timestamp"`
+	// TTL is the lowest TTL of the answers, after which the resolution
+	// expires whatever the TTL of the Cache. Zero leaves it to the Cache.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// live reports whether the TTL of the answers has not run out yet.
+func (e resolutionEntry) live() bool {
+	return e.TTL <= 0 || time.Since(e.Timestamp) < e.TTL
+}
+
+// cacheFile is the on-disk layout written by Save.
+type cacheFile struct {
+	Entries   map[string]cacheEntry      `json:"entries"`
+	Hostnames map[string]resolutionEntry `json:"hostnames,omitempty"`
+}
+
+// Cache stores enrichment results by IP and DNS resolutions by hostname.
+// The zero value is an empty cache whose entries never expire. It is safe
+// for concurrent use, and must not be copied after first use.
+type Cache struct {
+	// TTL is the maximum age of an entry. Zero never expires.
+	TTL time.Duration
+	// MaxEntries caps the number of results, and separately of
+	// resolutions, held in memory. The least recently used are evicted
+	// first. Zero is unbounded.
+	MaxEntries int
+
+	mu          sync.Mutex
+	entries     lru[cacheEntry]
+	resolutions lru[resolutionEntry]
+}
+
+// NewCache returns an empty cache whose entries expire after ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl}
+}
+
+func (c *Cache) isFresh(timestamp time.Time) bool {
+	return c.TTL <= 0 || time.Since(timestamp) < c.TTL
+}
+
+func (c *Cache) get(ip string) (CombinedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries.get(ip)
+	if !ok || !c.isFresh(entry.Timestamp) {
+		return CombinedResponse{}, false
+	}
+	return entry.Response, true
+}
+
+func (c *Cache) set(ip string, combined CombinedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.set(ip, cacheEntry{Response: combined, Timestamp: time.Now()}, c.MaxEntries)
+}
+
+func (c *Cache) getResolution(hostname string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.resolutions.get(hostname)
+	if !ok || !c.isFresh(entry.Timestamp) || !entry.live() {
+		return nil, false
+	}
+	return entry.Addresses, true
+}
+
+func (c *Cache) setResolution(hostname string, addresses []string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resolutions.set(hostname, resolutionEntry{Addresses: addresses, Timestamp: time.Now(), TTL: ttl}, c.MaxEntries)
+}
+
+// Load reads a cache previously written by Save, skipping expired entries.
+// Entries are added oldest first, so the newest are kept when there are
+// more than MaxEntries. A missing file is not an error, so the first run
+// starts empty.
+func (c *Cache) Load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var saved cacheFile
+	if err := json.NewDecoder(file).Decode(&saved); err != nil {
+		return fmt.Errorf("decoding cache %s: %w", path, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ip := range oldestFirst(saved.Entries, func(entry cacheEntry) time.Time { return entry.Timestamp }) {
+		if entry := saved.Entries[ip]; c.isFresh(entry.Timestamp) {
+			c.entries.set(ip, entry, c.MaxEntries)
+		}
+	}
+	for _, hostname := range oldestFirst(saved.Hostnames, func(entry resolutionEntry) time.Time { return entry.Timestamp }) {
+		if entry := saved.Hostnames[hostname]; c.isFresh(entry.Timestamp) && entry.live() {
+			c.resolutions.set(hostname, entry, c.MaxEntries)
+		}
+	}
+	return nil
+}
+
+// oldestFirst returns the keys of entries sorted by ascending timestamp.
+func oldestFirst[V any](entries map[string]V, timestamp func(V) time.Time) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return timestamp(entries[a]).Compare(timestamp(entries[b]))
+	})
+	return keys
+}
+
+// Save writes the fresh entries to path, going through a temporary file so
+// an interrupted write never leaves a truncated cache.
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	saved := cacheFile{
+		Entries:   make(map[string]cacheEntry, c.entries.len()),
+		Hostnames: make(map[string]resolutionEntry, c.resolutions.len()),
+	}
+	c.entries.each(func(ip string, entry cacheEntry) {
+		if c.isFresh(entry.Timestamp) {
+			saved.Entries[ip] = entry
+		}
+	})
+	c.resolutions.each(func(hostname string, entry resolutionEntry) {
+		if c.isFresh(entry.Timestamp) && entry.live() {
+			saved.Hostnames[hostname] = entry
+		}
+	})
+	c.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
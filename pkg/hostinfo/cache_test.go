@@ -0,0 +1,160 @@
+package hostinfo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCacheZeroValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache *Cache
+	}{
+		{name: "zero value", cache: &Cache{}},
+		{name: "literal with TTL", cache: &Cache{TTL: time.Hour, MaxEntries: 10}},
+		{name: "NewCache", cache: NewCache(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cache
+			if _, ok := c.get("192.0.2.1"); ok {
+				t.Fatal("empty cache has an entry")
+			}
+			if _, ok := c.getResolution("example.com"); ok {
+				t.Fatal("empty cache has a resolution")
+			}
+			c.set("192.0.2.1", CombinedResponse{Target: "192.0.2.1"})
+			c.setResolution("example.com", []string{"192.0.2.1"}, 0)
+			if got, ok := c.get("192.0.2.1"); !ok || got.Target != "192.0.2.1" {
+				t.Errorf("got %+v, %v", got, ok)
+			}
+			if got, ok := c.getResolution("example.com"); !ok || !slices.Equal(got, []string{"192.0.2.1"}) {
+				t.Errorf("got %v, %v", got, ok)
+			}
+
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if err := (&Cache{}).Save(path); err != nil {
+				t.Fatalf("saving an empty zero cache: %v", err)
+			}
+			if err := c.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded := &Cache{}
+			if err := loaded.Load(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := loaded.get("192.0.2.1"); !ok {
+				t.Error("entry lost in Save and Load")
+			}
+		})
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		age  time.Duration
+		want bool
+	}{
+		{name: "no TTL", ttl: 0, age: 1000 * time.Hour, want: true},
+		{name: "fresh", ttl: time.Hour, age: time.Minute, want: true},
+		{name: "expired", ttl: time.Hour, age: 2 * time.Hour, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.ttl)
+			c.entries.set("192.0.2.1", cacheEntry{Timestamp: time.Now().Add(-tt.age)}, 0)
+			if _, ok := c.get("192.0.2.1"); ok != tt.want {
+				t.Errorf("got fresh %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheResolutionTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheTTL  time.Duration
+		recordTTL time.Duration
+		age       time.Duration
+		want      bool
+	}{
+		{name: "no record TTL", cacheTTL: time.Hour, age: time.Minute, want: true},
+		{name: "within both", cacheTTL: time.Hour, recordTTL: 5 * time.Minute, age: time.Minute, want: true},
+		{name: "record expired", cacheTTL: time.Hour, recordTTL: 5 * time.Minute, age: 10 * time.Minute, want: false},
+		{name: "record expired, cache never expires", recordTTL: 5 * time.Minute, age: 10 * time.Minute, want: false},
+		{name: "cache expired", cacheTTL: time.Hour, recordTTL: 24 * time.Hour, age: 2 * time.Hour, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.cacheTTL)
+			c.resolutions.set("example.com", resolutionEntry{
+				Addresses: []string{"192.0.2.1"},
+				Timestamp: time.Now().Add(-tt.age),
+				TTL:       tt.recordTTL,
+			}, 0)
+			if _, ok := c.getResolution("example.com"); ok != tt.want {
+				t.Errorf("got fresh %v, want %v", ok, tt.want)
+			}
+
+			path := filepath.Join(t.TempDir(), "cache.json")
+			if err := c.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded := NewCache(tt.cacheTTL)
+			if err := loaded.Load(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := loaded.getResolution("example.com"); ok != tt.want {
+				t.Errorf("got fresh %v after Save and Load, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := &Cache{MaxEntries: 2}
+	c.set("192.0.2.1", CombinedResponse{})
+	c.set("192.0.2.2", CombinedResponse{})
+	c.get("192.0.2.1")
+	c.set("192.0.2.3", CombinedResponse{})
+
+	for ip, want := range map[string]bool{"192.0.2.1": true, "192.0.2.2": false, "192.0.2.3": true} {
+		if _, ok := c.get(ip); ok != want {
+			t.Errorf("%s cached = %v, want %v", ip, ok, want)
+		}
+	}
+}
+
+func TestCacheLoad(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content *string
+		wantErr bool
+	}{
+		{name: "missing file"},
+		{name: "empty object", content: ptr(`{}`)},
+		{name: "corrupt", content: ptr(`{"entries":`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if tt.content != nil {
+				if err := os.WriteFile(path, []byte(*tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := (&Cache{}).Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,172 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func (c *Client) isDoHResolver() bool {
+	return isDoH(c.Resolver)
+}
+
+func isDoH(resolver string) bool {
+	return strings.HasPrefix(resolver, "https://")
+}
+
+// dohExchange sends a single RFC 8484 query for name to the DoH resolver
+// and returns the answer section of the reply.
+func (c *Client) dohExchange(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	return c.dohExchangeWith(ctx, c.Resolver, name, qtype, true)
+}
+
+// dohExchangeWith is dohExchange against the given DoH resolver. Failure
+// codes are reported as a *net.DNSError, with IsNotFound set for NXDOMAIN
+// and IsTemporary for SERVFAIL. Transient HTTP failures are retried only
+// with retry set; callers retrying whole lookups send a single request.
+func (c *Client) dohExchangeWith(ctx context.Context, resolver, name string, qtype dnsmessage.Type, retry bool) ([]dnsmessage.Resource, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(resolver)
+	if err != nil {
+		return nil, err
+	}
+	params := endpoint.Query()
+	params.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+	endpoint.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderDoH), http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	var resp *http.Response
+	if retry {
+		resp, err = c.doWithRetry(req, nil)
+	} else {
+		resp, err = c.do(c.httpClient(), req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH resolver returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, &net.DNSError{
+			Err:         fmt.Sprintf("DoH query failed: %s", reply.RCode),
+			Name:        name,
+			Server:      resolver,
+			IsNotFound:  reply.RCode == dnsmessage.RCodeNameError,
+			IsTemporary: reply.RCode == dnsmessage.RCodeServerFailure,
+		}
+	}
+	return reply.Answers, nil
+}
+
+// dohLookupIPAddr sends one A and one AAAA query for hostname, leaving the
+// retries to resolveIPAddrWith. It also returns the lowest TTL of the
+// answers.
+func (c *Client) dohLookupIPAddr(ctx context.Context, resolver, hostname string) ([]net.IPAddr, time.Duration, error) {
+	var ips []net.IPAddr
+	ttl := time.Duration(-1)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := c.dohExchangeWith(ctx, resolver, hostname, qtype, false)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, answer := range answers {
+			if answerTTL := time.Duration(answer.Header.TTL) * time.Second; ttl < 0 || answerTTL < ttl {
+				ttl = answerTTL
+			}
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IPAddr{IP: net.IP(body.A[:])})
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IPAddr{IP: net.IP(body.AAAA[:])})
+			}
+		}
+	}
+	return ips, max(ttl, 0), nil
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name used for PTR
+// queries of ip.
+func reverseName(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address %s", ip)
+	}
+
+	if ip4 := parsed.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var name strings.Builder
+	for i := len(parsed) - 1; i >= 0; i-- {
+		name.WriteByte(hexDigits[parsed[i]&0x0f])
+		name.WriteByte('.')
+		name.WriteByte(hexDigits[parsed[i]>>4])
+		name.WriteByte('.')
+	}
+	name.WriteString("ip6.arpa.")
+	return name.String(), nil
+}
+
+func (c *Client) dohLookupAddr(ctx context.Context, ip string) ([]string, error) {
+	name, err := reverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := c.dohExchange(ctx, name, dnsmessage.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, answer := range answers {
+		if body, ok := answer.Body.(*dnsmessage.PTRResource); ok {
+			names = append(names, body.PTR.String())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,223 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDoHServer starts an RFC 8484 resolver answering GET queries from
+// zone. The returned stub's addr is its endpoint.
+func newDoHServer(t *testing.T, zone dnsZone) (*httptest.Server, *dnsStub) {
+	t.Helper()
+	stub := &dnsStub{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/dns-message" {
+			http.Error(w, "bad Accept header", http.StatusNotAcceptable)
+			return
+		}
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply, err := stub.reply(zone, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(reply)
+	}))
+	t.Cleanup(srv.Close)
+	stub.addr = srv.URL + "/dns-query"
+	return srv, stub
+}
+
+// newDoHStub starts a DoH resolver answering from zone, and returns a
+// client using it.
+func newDoHStub(t *testing.T, zone dnsZone) *Client {
+	t.Helper()
+	srv, stub := newDoHServer(t, zone)
+	return &Client{Resolver: stub.addr, HTTPClient: srv.Client()}
+}
+
+func TestResolveHostnameDoH(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "A and AAAA", hostname: "multi.test", want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "A only", hostname: "single.test", want: []string{"192.0.2.9"}},
+		{name: "CNAME", hostname: "alias.test", want: []string{"192.0.2.9"}},
+		{name: "NXDOMAIN", hostname: "missing.test", wantErr: true},
+	}
+	client := newDoHStub(t, multiZone().add(cnameRecord("alias.test", "single.test")))
+	client.AllIPs = true
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.ResolveHostname(context.Background(), tt.hostname)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoHResolverErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "HTTP error", handler: respond(http.StatusBadGateway, "")},
+		{name: "not a DNS message", handler: respond(http.StatusOK, "<html>")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(tt.handler)
+			defer srv.Close()
+			client := &Client{Resolver: srv.URL, HTTPClient: srv.Client()}
+			if got, err := client.ResolveHostname(context.Background(), "single.test"); err == nil {
+				t.Errorf("got %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestLookupPTRDoH(t *testing.T) {
+	client := newDoHStub(t, dnsZone{}.add(ptrRecord("192.0.2.1", "host.example.test")))
+	got, err := client.LookupPTR(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "host.example.test" {
+		t.Errorf("got %q, want host.example.test", got)
+	}
+}
+
+// withTTL returns record with its TTL set to seconds.
+func withTTL(record dnsmessage.Resource, seconds uint32) dnsmessage.Resource {
+	record.Header.TTL = seconds
+	return record
+}
+
+func TestResolveHostnameDoHTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []dnsmessage.Resource
+		want    time.Duration
+	}{
+		{name: "one answer", records: []dnsmessage.Resource{withTTL(ipRecord("ttl.test", "192.0.2.1"), 60)}, want: time.Minute},
+		{name: "lowest answer", records: []dnsmessage.Resource{
+			withTTL(ipRecord("ttl.test", "192.0.2.1"), 600),
+			withTTL(ipRecord("ttl.test", "2001:db8::1"), 30),
+		}, want: 30 * time.Second},
+		{name: "CNAME", records: []dnsmessage.Resource{
+			withTTL(cnameRecord("ttl.test", "target.test"), 10),
+			withTTL(ipRecord("target.test", "192.0.2.1"), 600),
+		}, want: 10 * time.Second},
+		{name: "zero", records: []dnsmessage.Resource{withTTL(ipRecord("ttl.test", "192.0.2.1"), 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newDoHStub(t, dnsZone{}.add(tt.records...))
+			client.Cache = NewCache(24 * time.Hour)
+			if _, err := client.ResolveHostname(context.Background(), "ttl.test"); err != nil {
+				t.Fatal(err)
+			}
+
+			entry, ok := client.Cache.resolutions.get("ttl.test")
+			if ok != (tt.want > 0) {
+				t.Fatalf("cached = %v, want %v", ok, tt.want > 0)
+			}
+			if entry.TTL != tt.want {
+				t.Errorf("got TTL %v, want %v", entry.TTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHostnameSharesInFlight(t *testing.T) {
+	// A zero TTL is not cached, so only sharing the resolution in flight
+	// keeps concurrent lookups from querying again.
+	zone := dnsZone{}.add(withTTL(ipRecord("single.test", "192.0.2.9"), 0))
+	tests := []struct {
+		name  string
+		cache *Cache
+	}{
+		{name: "per client"},
+		{name: "in Cache", cache: &Cache{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			release := make(chan struct{})
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				<-release
+				query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				reply, err := zone.reply(query)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				w.Write(reply)
+			}))
+			defer srv.Close()
+			client := &Client{Resolver: srv.URL, HTTPClient: srv.Client(), Cache: tt.cache}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := client.ResolveHostname(context.Background(), "single.test"); err != nil {
+						errs <- err
+					}
+				}()
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+			if got := requests.Load(); got != 2 {
+				t.Errorf("got %d requests, want one A and one AAAA query", got)
+			}
+
+			if _, err := client.ResolveHostname(context.Background(), "single.test"); err != nil {
+				t.Fatal(err)
+			}
+			if got := requests.Load(); got != 4 {
+				t.Errorf("got %d requests, want the uncached resolution queried again", got)
+			}
+		})
+	}
+}
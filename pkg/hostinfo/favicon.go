@@ -0,0 +1,97 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net/http"
+	"strings"
+)
+
+// maxFaviconSize is the largest favicon hashed. Bigger ones are skipped
+// rather than hashed truncated, which would never match Shodan.
+const maxFaviconSize = 1 << 20
+
+// FaviconHash returns the favicon hash Shodan indexes as http.favicon.hash:
+// the signed 32-bit MurmurHash3 of the base64 encoding of data, wrapped
+// every 76 characters and newline-terminated as Python's
+// base64.encodebytes does.
+func FaviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 0 {
+		line := encoded[:min(len(encoded), 76)]
+		b.WriteString(line)
+		b.WriteByte('\n')
+		encoded = encoded[len(line):]
+	}
+	return int32(murmur3([]byte(b.String()), 0))
+}
+
+// murmur3 is the x86 32-bit variant of MurmurHash3.
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	n := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// grabFavicon fetches /favicon.ico from ip:port and returns its hash. ok
+// is false when the host serves no favicon.
+func (c *Client) grabFavicon(ctx context.Context, ip string, port int, host string) (hash int32, ok bool, err error) {
+	resp, err := c.grab(ctx, ip, port, host, "/favicon.ico")
+	if err != nil {
+		return 0, false, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconSize+1))
+	if err != nil {
+		return 0, false, err
+	}
+	if len(data) == 0 || len(data) > maxFaviconSize {
+		return 0, false, nil
+	}
+	return FaviconHash(data), true, nil
+}
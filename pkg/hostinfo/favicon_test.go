@@ -0,0 +1,111 @@
+package hostinfo
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{data: "", seed: 0, want: 0},
+		{data: "", seed: 1, want: 0x514e28b7},
+		{data: "a", seed: 0x9747b28c, want: 0x7fa09ea6},
+		{data: "ab", seed: 0x9747b28c, want: 0x74875592},
+		{data: "abc", seed: 0x9747b28c, want: 0xc84a62dd},
+		{data: "abcd", seed: 0x9747b28c, want: 0xf0478627},
+		{data: "hello", seed: 0, want: 0x248bfa47},
+		{data: "Hello, world!", seed: 0x9747b28c, want: 0x24884cba},
+		{data: "The quick brown fox jumps over the lazy dog", seed: 0x9747b28c, want: 0x2fa826cd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			if got := murmur3([]byte(tt.data), tt.seed); got != tt.want {
+				t.Errorf("got %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+// allBytes is 256 bytes whose base64 encoding spans several 76-character
+// lines.
+func allBytes() []byte {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestFaviconHash(t *testing.T) {
+	// Expected values are mmh3.hash(base64.encodebytes(data)) in Python.
+	tests := []struct {
+		name string
+		data []byte
+		want int32
+	}{
+		{name: "short", data: []byte("hello"), want: 1155597304},
+		{name: "wrapped", data: allBytes(), want: -757223386},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FaviconHash(tt.data); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrabWebPortsFavicon(t *testing.T) {
+	tests := []struct {
+		name    string
+		favicon http.HandlerFunc
+		enabled bool
+		hashed  bool
+	}{
+		{name: "hashed", favicon: respond(http.StatusOK, string(allBytes())), enabled: true, hashed: true},
+		{name: "disabled", favicon: respond(http.StatusOK, string(allBytes()))},
+		{name: "missing", favicon: http.NotFound, enabled: true},
+		{name: "empty", favicon: respond(http.StatusOK, ""), enabled: true},
+		{name: "too big", favicon: respond(http.StatusOK, string(bytes.Repeat([]byte{1}, maxFaviconSize+1))), enabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var faviconRequests int
+			srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/favicon.ico" {
+					faviconRequests++
+					tt.favicon(w, r)
+					return
+				}
+				w.Write([]byte("<title>Home</title>"))
+			})
+			port := stubPort(t, srv)
+			old := webPorts
+			webPorts = []int{port}
+			t.Cleanup(func() { webPorts = old })
+
+			client := &Client{FaviconHash: tt.enabled}
+			web := client.grabWebPorts(context.Background(), "127.0.0.1", []int{port}, "")
+			info, ok := web[port]
+			if !ok || info.Title != "Home" {
+				t.Fatalf("got %+v, want the page grabbed", web)
+			}
+			if !tt.hashed {
+				if info.FaviconHash != nil {
+					t.Errorf("got favicon hash %d, want none", *info.FaviconHash)
+				}
+			} else if info.FaviconHash == nil || *info.FaviconHash != FaviconHash(allBytes()) {
+				t.Errorf("got favicon hash %v, want %d", info.FaviconHash, FaviconHash(allBytes()))
+			}
+			if (faviconRequests > 0) != tt.enabled {
+				t.Errorf("got %d favicon requests with hashing enabled %v", faviconRequests, tt.enabled)
+			}
+		})
+	}
+}
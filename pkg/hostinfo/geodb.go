@@ -0,0 +1,107 @@
+package hostinfo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoDBRecord holds the fields read from MaxMind City, Country and ASN
+// databases. Each database type fills in its own subset.
+type geoDBRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+
+	ASN    uint   `maxminddb:"autonomous_system_number"`
+	ASNOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// GeoDB looks up geolocation and ASN data in local MaxMind databases such
+// as GeoLite2-City and GeoLite2-ASN. It is safe for concurrent use.
+type GeoDB struct {
+	readers []*maxminddb.Reader
+}
+
+// OpenGeoDB opens every .mmdb file in paths. Their records are merged on
+// lookup, so a City and an ASN database can be combined.
+func OpenGeoDB(paths ...string) (*GeoDB, error) {
+	db := &GeoDB{}
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("opening %s: %w", path, err)
+		}
+		db.readers = append(db.readers, reader)
+	}
+	return db, nil
+}
+
+// Close releases every database.
+func (db *GeoDB) Close() error {
+	var errs []error
+	for _, reader := range db.readers {
+		errs = append(errs, reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Lookup returns what the databases know about ip in the shape of an
+// ipinfo.io answer. It returns ErrNoData when no database has a record.
+func (db *GeoDB) Lookup(ip string) (IPInfoResponse, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return IPInfoResponse{}, fmt.Errorf("invalid IP %q", ip)
+	}
+
+	var record geoDBRecord
+	found := false
+	for _, reader := range db.readers {
+		_, ok, err := reader.LookupNetwork(parsed, &record)
+		if err != nil {
+			return IPInfoResponse{}, err
+		}
+		found = found || ok
+	}
+	if !found {
+		return IPInfoResponse{}, fmt.Errorf("mmdb: %w", ErrNoData)
+	}
+
+	ipInfoData := IPInfoResponse{
+		IP:        ip,
+		City:      record.City.Names["en"],
+		Country:   record.Country.ISOCode,
+		Postal:    record.Postal.Code,
+		Timezone:  record.Location.TimeZone,
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+	}
+	if len(record.Subdivisions) > 0 {
+		ipInfoData.Region = record.Subdivisions[0].Names["en"]
+	}
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		ipInfoData.Loc = formatLoc(record.Location.Latitude, record.Location.Longitude)
+	}
+	if record.ASN != 0 {
+		ipInfoData.Org = "AS" + strconv.FormatUint(uint64(record.ASN), 10) + " " + record.ASNOrg
+	}
+	return ipInfoData, nil
+}
@@ -0,0 +1,233 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// mmdbValue encodes v in the MaxMind DB data format. It supports the types
+// the GeoLite2 databases use: maps, arrays, strings, doubles and unsigned
+// integers.
+func mmdbValue(v any) []byte {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		out := mmdbControl(7, len(v))
+		for _, key := range keys {
+			out = append(out, mmdbValue(key)...)
+			out = append(out, mmdbValue(v[key])...)
+		}
+		return out
+	case []any:
+		out := mmdbControl(11, len(v))
+		for _, item := range v {
+			out = append(out, mmdbValue(item)...)
+		}
+		return out
+	case string:
+		return append(mmdbControl(2, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(mmdbControl(3, 8), math.Float64bits(v))
+	case uint16:
+		return mmdbUint(5, uint64(v))
+	case uint32:
+		return mmdbUint(6, uint64(v))
+	case uint64:
+		return mmdbUint(9, v)
+	}
+	panic("unsupported mmdb value")
+}
+
+// mmdbControl returns the control bytes of a value of type typ and size.
+func mmdbControl(typ, size int) []byte {
+	var out []byte
+	first := 0
+	if typ <= 7 {
+		first = typ << 5
+	}
+	switch {
+	case size < 29:
+		out = []byte{byte(first | size)}
+	case size < 285:
+		out = []byte{byte(first | 29), byte(size - 29)}
+	default:
+		panic("mmdb value too large")
+	}
+	if typ > 7 {
+		out = slices.Insert(out, 1, byte(typ-7))
+	}
+	return out
+}
+
+func mmdbUint(typ int, v uint64) []byte {
+	value := binary.BigEndian.AppendUint64(nil, v)
+	for len(value) > 0 && value[0] == 0 {
+		value = value[1:]
+	}
+	return append(mmdbControl(typ, len(value)), value...)
+}
+
+// writeMMDB writes an IPv4 MaxMind database of dbType holding record for
+// network and nothing else, and returns its path.
+func writeMMDB(t *testing.T, dbType string, network netip.Prefix, record map[string]any) string {
+	t.Helper()
+	// One node per bit of the prefix; the other branch of each is empty.
+	nodeCount := network.Bits()
+	addr := network.Addr().As4()
+	ip := binary.BigEndian.Uint32(addr[:])
+	empty := uint32(nodeCount)
+	data := uint32(nodeCount) + 16
+
+	var file []byte
+	for i := range nodeCount {
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = data
+		}
+		left, right := next, empty
+		if ip>>(31-i)&1 == 1 {
+			left, right = empty, next
+		}
+		file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+	}
+	file = append(file, make([]byte, 16)...)
+	file = append(file, mmdbValue(record)...)
+	file = append(file, "\xab\xcd\xefMaxMind.com"...)
+	file = append(file, mmdbValue(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               dbType,
+		"description":                 map[string]any{"en": "hostinfo test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})...)
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func cityRecord() map[string]any {
+	return map[string]any{
+		"city":         map[string]any{"names": map[string]any{"en": "Mountain View", "de": "Mountain View"}},
+		"country":      map[string]any{"iso_code": "US"},
+		"location":     map[string]any{"latitude": 37.4056, "longitude": -122.0775, "time_zone": "America/Los_Angeles"},
+		"postal":       map[string]any{"code": "94043"},
+		"subdivisions": []any{map[string]any{"names": map[string]any{"en": "California"}}},
+	}
+}
+
+func asnRecord() map[string]any {
+	return map[string]any{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example Networks",
+	}
+}
+
+func TestGeoDBLookup(t *testing.T) {
+	city := writeMMDB(t, "GeoLite2-City", netip.MustParsePrefix("192.0.2.0/24"), cityRecord())
+	asn := writeMMDB(t, "GeoLite2-ASN", netip.MustParsePrefix("192.0.2.0/24"), asnRecord())
+	cityData := IPInfoResponse{
+		IP:        "192.0.2.1",
+		City:      "Mountain View",
+		Region:    "California",
+		Country:   "US",
+		Loc:       "37.4056,-122.0775",
+		Postal:    "94043",
+		Timezone:  "America/Los_Angeles",
+		Latitude:  37.4056,
+		Longitude: -122.0775,
+	}
+	merged := cityData
+	merged.Org = "AS64500 Example Networks"
+
+	tests := []struct {
+		name    string
+		paths   []string
+		ip      string
+		want    IPInfoResponse
+		wantErr error
+	}{
+		{name: "city", paths: []string{city}, ip: "192.0.2.1", want: cityData},
+		{name: "ASN", paths: []string{asn}, ip: "192.0.2.200", want: IPInfoResponse{IP: "192.0.2.200", Org: "AS64500 Example Networks"}},
+		{name: "city and ASN", paths: []string{city, asn}, ip: "192.0.2.1", want: merged},
+		{name: "no record", paths: []string{city}, ip: "198.51.100.1", wantErr: ErrNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := OpenGeoDB(tt.paths...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			got, err := db.Lookup(tt.ip)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %+v, %v, want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenGeoDBErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.mmdb")
+	if err := os.WriteFile(corrupt, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	valid := writeMMDB(t, "GeoLite2-City", netip.MustParsePrefix("192.0.2.0/24"), cityRecord())
+	for _, paths := range [][]string{{filepath.Join(dir, "missing.mmdb")}, {corrupt}, {valid, corrupt}} {
+		if db, err := OpenGeoDB(paths...); err == nil {
+			db.Close()
+			t.Errorf("OpenGeoDB(%q) succeeded, want an error", paths)
+		}
+	}
+}
+
+func TestProcessTargetGeoDB(t *testing.T) {
+	db, err := OpenGeoDB(writeMMDB(t, "GeoLite2-City", netip.MustParsePrefix("192.0.2.0/24"), cityRecord()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	client := stubClient(t, respond(http.StatusOK, shodanBody), failOnHit(t, "ipinfo"))
+	client.GeoDB = db
+	client.AppendSource = true
+	results, err := client.ProcessTarget(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := results[0]
+	if got.Country != "US" || got.City != "Mountain View" || !slices.Equal(got.Ports, []int{22, 443}) {
+		t.Errorf("got %+v, want the offline geolocation with the Shodan data", got)
+	}
+	if got.Sources["geo"] != SourceMMDB {
+		t.Errorf("got sources %v, want geo from %s", got.Sources, SourceMMDB)
+	}
+}
@@ -0,0 +1,718 @@
+// Package hostinfo enriches IPs and hostnames with data from ipinfo.io (or
+// ip-api.com) and internetdb.shodan.io.
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/time/rate"
+)
+
+type IPInfoResponse struct {
+	IP       string `json:"ip" yaml:"ip"`
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	City     string `json:"city,omitempty" yaml:"city,omitempty"`
+	Region   string `json:"region,omitempty" yaml:"region,omitempty"`
+	Country  string `json:"country,omitempty" yaml:"country,omitempty"`
+	Loc      string `json:"loc,omitempty" yaml:"loc,omitempty"`
+	Org      string `json:"org,omitempty" yaml:"org,omitempty"`
+	Postal   string `json:"postal,omitempty" yaml:"postal,omitempty"`
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	Latitude  float64 `json:"latitude,omitempty" yaml:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty" yaml:"longitude,omitempty"`
+}
+
+type ShodanResponse struct {
+	Hostnames []string `json:"hostnames,omitempty" yaml:"hostnames,omitempty"`
+	Ports     []int    `json:"ports,omitempty" yaml:"ports,omitempty"`
+	CPEs      []string `json:"cpes,omitempty" yaml:"cpes,omitempty"`
+	Tags      []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Vulns     []Vuln   `json:"vulns,omitempty" yaml:"vulns,omitempty"`
+
+	// The fields below are only filled in by the full host API.
+	OS         string          `json:"os,omitempty" yaml:"os,omitempty"`
+	LastUpdate string          `json:"last_update,omitempty" yaml:"last_update,omitempty"`
+	Services   []ShodanService `json:"services,omitempty" yaml:"services,omitempty"`
+
+	// Extra holds the InternetDB fields not decoded above, so fields the
+	// API adds later are passed through rather than dropped.
+	Extra map[string]any `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+type CombinedResponse struct {
+	Target         string `json:"target,omitempty" yaml:"target,omitempty"`
+	IPInfoResponse `yaml:",inline"`
+	ShodanResponse `yaml:",inline"`
+
+	ASN     string `json:"asn,omitempty" yaml:"asn,omitempty"`
+	OrgName string `json:"org_name,omitempty" yaml:"org_name,omitempty"`
+
+	Port     int   `json:"port,omitempty" yaml:"port,omitempty"`
+	PortOpen *bool `json:"port_open,omitempty" yaml:"port_open,omitempty"`
+
+	Whois      *WhoisInfo   `json:"whois,omitempty" yaml:"whois,omitempty"`
+	TLS        []TLSInfo    `json:"tls,omitempty" yaml:"tls,omitempty"`
+	PortStatus []PortStatus `json:"port_status,omitempty" yaml:"port_status,omitempty"`
+	DNS        *DNSRecords  `json:"dns,omitempty" yaml:"dns,omitempty"`
+
+	Web map[int]WebInfo `json:"web,omitempty" yaml:"web,omitempty"`
+
+	ResolutionChain []string `json:"resolution_chain,omitempty" yaml:"resolution_chain,omitempty"`
+
+	LatencyMs *float64 `json:"latency_ms,omitempty" yaml:"latency_ms,omitempty"`
+
+	Private bool `json:"private,omitempty" yaml:"private,omitempty"`
+
+	// Sources names where each part of the record came from, such as
+	// GeoProviderIPAPI for "geo" after a fallback. Keys are "geo",
+	// "network" (org and ASN), "ports" and "vulns".
+	Sources map[string]string `json:"sources,omitempty" yaml:"sources,omitempty"`
+	// Errors holds the failures of the sources, "shodan", "geo" or "nvd",
+	// that couldn't be queried while the others could.
+	Errors map[string]string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Data sources recorded in CombinedResponse.Sources, along with
+// GeoProviderIPInfo and GeoProviderIPAPI.
+const (
+	SourceMMDB       = "mmdb"
+	SourceInternetDB = "internetdb"
+	SourceShodan     = "shodan"
+	SourceScan       = "scan"
+)
+
+func (r *CombinedResponse) setError(source string, err error) {
+	if r.Errors == nil {
+		r.Errors = map[string]string{}
+	}
+	r.Errors[source] = err.Error()
+}
+
+func (r *CombinedResponse) setSource(key, source string) {
+	if r.Sources == nil {
+		r.Sources = map[string]string{}
+	}
+	r.Sources[key] = source
+}
+
+var (
+	// ErrNoData is returned when a source has no information about an IP.
+	ErrNoData = errors.New("no data available")
+	// ErrRateLimited is returned when a source keeps answering 429.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNoCredits is returned when the Shodan API key has run out of
+	// query credits.
+	ErrNoCredits = errors.New("out of query credits")
+	// ErrTargetTimeout is returned when a target takes longer than
+	// TargetTimeout.
+	ErrTargetTimeout = errors.New("target timed out")
+)
+
+// Client holds the configuration used to resolve and enrich targets. The
+// zero value is ready to use and queries the system resolver through
+// http.DefaultClient.
+type Client struct {
+	// HTTPClient sends every outbound request, including DoH queries.
+	HTTPClient *http.Client
+	// Resolver is a host:port DNS server or an https:// DoH endpoint. The
+	// system resolver is used when it is empty.
+	Resolver string
+	// Exclude lists the addresses that must never be queried. Targets that
+	// are, or resolve to, such an address are skipped with a warning before
+	// any request about the address is made.
+	Exclude []netip.Prefix
+	// Scope, when set, lists the only addresses that may be queried. Other
+	// addresses are skipped like those in Exclude, which takes precedence.
+	Scope []netip.Prefix
+	// SkipPrivate skips private and reserved addresses, as reported by
+	// IsBogon, like those in Exclude. MarkPrivate instead keeps them as
+	// records holding only the IP and Private, without querying any
+	// source about them.
+	SkipPrivate bool
+	MarkPrivate bool
+	// SecondaryResolver, in the same form as Resolver, is used for
+	// hostnames Resolver fails to resolve for any reason other than the
+	// name not existing.
+	SecondaryResolver string
+	// DNSRetries is the number of times a transient resolution failure is
+	// retried on each resolver.
+	DNSRetries int
+	// Retries is the number of times transient HTTP failures are retried.
+	Retries int
+	// IPInfoToken authenticates requests to ipinfo.io when set.
+	IPInfoToken string
+	// ShodanAPIKey switches from the free InternetDB to the full Shodan
+	// host API, which also reports banners and certificate details.
+	ShodanAPIKey string
+	// ShodanAPIURL is the Shodan API base URL. It defaults to
+	// DefaultShodanAPIURL.
+	ShodanAPIURL string
+	// ShodanLimiter and IPInfoLimiter throttle the requests sent to Shodan
+	// and ipinfo.io, retries included. They are shared by every worker, and
+	// nil means unlimited.
+	ShodanLimiter *rate.Limiter
+	IPInfoLimiter *rate.Limiter
+	// ShodanURL and IPInfoURL override the base URLs of
+	// internetdb.shodan.io and ipinfo.io, e.g. to point at a mirror. They
+	// default to DefaultShodanURL and DefaultIPInfoURL.
+	ShodanURL string
+	IPInfoURL string
+	// NoShodan and NoIPInfo skip the internetdb.shodan.io and ipinfo.io
+	// lookups, leaving the matching part of each record empty. With both
+	// set, records only hold the resolved IP.
+	NoShodan bool
+	NoIPInfo bool
+	// GeoProvider selects where the geolocation part of each record comes
+	// from: GeoProviderIPInfo, the default, or GeoProviderIPAPI.
+	GeoProvider string
+	// GeoFallback retries a rate-limited ipinfo.io lookup against
+	// ip-api.com.
+	GeoFallback bool
+	// GeoDB, when set, replaces the online geolocation providers with
+	// local MaxMind databases.
+	GeoDB *GeoDB
+
+	// NormalizeHosts resolves hostname targets in the form returned by
+	// NormalizeHostname. Records keep the target as given.
+	NormalizeHosts bool
+	// AllIPs processes every address a hostname resolves to instead of
+	// only the first one.
+	AllIPs bool
+	// PTR fills in the hostname of IP targets from their PTR record when
+	// ipinfo.io has none.
+	PTR bool
+	// IPv4Only and IPv6Only restrict resolution and processing to one
+	// address family.
+	IPv4Only bool
+	IPv6Only bool
+	// Whois adds WHOIS registration details to every record.
+	Whois bool
+	// Records lists the extra DNS record types (RecordMX, RecordTXT,
+	// RecordNS) looked up for hostname targets.
+	Records []string
+	// CNAMEChain records the CNAME hops a hostname target resolves
+	// through, followed by the record's IP.
+	CNAMEChain bool
+	// WhoisServer is the host:port WHOIS queries start from. It defaults
+	// to DefaultWhoisServer.
+	WhoisServer string
+	// TLS inspects the certificate of every TLS port Shodan reports open.
+	TLS bool
+	// TLSTimeout bounds each TLS handshake. It defaults to
+	// DefaultTLSTimeout.
+	TLSTimeout time.Duration
+	// HTTPGrab fetches the root page of every web port Shodan reports and
+	// records its title and Server header.
+	HTTPGrab bool
+	// HTTPGrabTimeout bounds each of those fetches, redirects included. It
+	// defaults to DefaultHTTPGrabTimeout.
+	HTTPGrabTimeout time.Duration
+	// FaviconHash also fetches /favicon.ico from those ports and records
+	// its Shodan-style hash. It implies HTTPGrab.
+	FaviconHash bool
+
+	grabOnce       sync.Once
+	grabHTTPClient *http.Client
+	// VerifyPorts probes every port Shodan reports with a TCP connect and
+	// records whether it is still open.
+	VerifyPorts bool
+	// PortTimeout bounds each of those connects. It defaults to
+	// DefaultPortTimeout.
+	PortTimeout time.Duration
+	// AppendSource records in CombinedResponse.Sources which provider
+	// each part of a record came from.
+	AppendSource bool
+	// ScanPorts lists the ports connect-scanned, bounded by PortTimeout,
+	// on IPs Shodan reports no ports for. The open ones fill in Ports.
+	ScanPorts []int
+	// ScanUDPPorts lists the UDP ports probed with ProbeUDPPort on those
+	// IPs. Only the ones that answer fill in Ports.
+	ScanUDPPorts []int
+	// Latency measures the TCP connect time to 443, 80 or the first port
+	// Shodan reports, bounded by PortTimeout.
+	Latency bool
+	// EnrichCVEs looks up the CVSS score and severity of every Shodan vuln.
+	EnrichCVEs bool
+	// NVDURL is the NVD CVE API endpoint. It defaults to DefaultNVDURL.
+	NVDURL string
+	// NVDAPIKey authenticates requests to the NVD, which raises its rate
+	// limit from 5 to 50 requests per 30 seconds.
+	NVDAPIKey string
+	// NVDLimiter throttles the requests sent to the NVD, retries included.
+	// When it is nil, requests keep to the public NVD rate limit for
+	// NVDAPIKey.
+	NVDLimiter *rate.Limiter
+
+	nvdOnce           sync.Once
+	defaultNVDLimiter *rate.Limiter
+
+	// Cache stores results by IP, and DNS resolutions by hostname, across
+	// targets and runs. Without it nothing is cached except resolutions,
+	// which are then kept for the lifetime of the Client.
+	Cache *Cache
+	// Concurrency is the number of targets ProcessTargets handles in
+	// parallel.
+	Concurrency int
+	// TargetTimeout bounds the whole of ProcessTarget, including DNS and
+	// every HTTP request. There is no limit when it is zero.
+	TargetTimeout time.Duration
+
+	noCredits atomic.Bool
+
+	cveMutex sync.Mutex
+	cves     map[string]Vuln
+	cveCalls map[string]*cveCall
+
+	// Logger receives debug logs of every DNS resolution and HTTP request.
+	// Nothing is logged when it is nil.
+	Logger *slog.Logger
+	// DebugHTTP also logs the first bytes of every response body.
+	DebugHTTP bool
+	// Observer is told about every HTTP request and cache lookup. Nothing
+	// is reported when it is nil.
+	Observer Observer
+	// UserAgent is sent on every HTTP request, including DoH queries. It
+	// defaults to DefaultUserAgent.
+	UserAgent string
+	// HostConcurrency caps the HTTP requests in flight to any one host,
+	// counting until the response body is closed. There is no cap when it
+	// is zero.
+	HostConcurrency int
+
+	hostSlotsMutex sync.Mutex
+	hostSlots      map[string]chan struct{}
+
+	// RIPEStatURL is the endpoint LookupASNPrefixes queries. It defaults
+	// to DefaultRIPEStatURL.
+	RIPEStatURL string
+
+	resolutionMutex sync.Mutex
+	resolutions     map[string]resolutionEntry
+	resolutionCalls map[string]*resolutionCall
+
+	asnMutex    sync.Mutex
+	asnPrefixes map[string][]string
+}
+
+// Result is the outcome of processing a single target.
+type Result struct {
+	// Index is the position of Target in the slice given to
+	// ProcessTargets, or among the targets received by
+	// ProcessTargetStream.
+	Index     int
+	Target    string
+	Responses []CombinedResponse
+	Err       error
+}
+
+// discardLogger is used when Client.Logger is nil. No level is enabled, so
+// records are never built.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+	return c.Logger
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// parseOrg splits an ipinfo.io org such as "AS15169 Google LLC" into the
+// ASN and the organization name. Both are empty when org has no AS prefix.
+func parseOrg(org string) (string, string) {
+	asn, name, _ := strings.Cut(org, " ")
+	digits, ok := strings.CutPrefix(asn, "AS")
+	if !ok || digits == "" {
+		return "", ""
+	}
+	if _, err := strconv.ParseUint(digits, 10, 32); err != nil {
+		return "", ""
+	}
+	return asn, strings.TrimSpace(name)
+}
+
+func (c *Client) processIP(ctx context.Context, ip string) (CombinedResponse, error) {
+	if c.MarkPrivate && IsBogon(ip) {
+		return CombinedResponse{IPInfoResponse: IPInfoResponse{IP: ip}, Private: true}, nil
+	}
+
+	// Records missing a source must not be served to later runs that
+	// want it, so they bypass the cache.
+	useCache := c.Cache != nil && !c.NoShodan && !c.NoIPInfo
+	if useCache {
+		combined, ok := c.Cache.get(ip)
+		c.observeCache(ok)
+		if ok {
+			return combined, nil
+		}
+	}
+
+	var combined CombinedResponse
+	var errs []error
+	enabled := 0
+
+	if !c.NoShodan {
+		enabled++
+		shodanData, source, err := c.fetchShodan(ctx, ip)
+		if err != nil && !errors.Is(err, ErrNoData) {
+			errs = append(errs, err)
+			combined.setError("shodan", err)
+		}
+		combined.ShodanResponse = shodanData
+		if len(shodanData.Ports) > 0 {
+			combined.setSource("ports", source)
+		}
+		if len(shodanData.Vulns) > 0 {
+			combined.setSource("vulns", source)
+		}
+	}
+	if !c.NoIPInfo {
+		enabled++
+		ipInfoData, source, err := c.fetchGeoData(ctx, ip)
+		if err != nil && !errors.Is(err, ErrNoData) {
+			errs = append(errs, err)
+			combined.setError("geo", err)
+		}
+		combined.IPInfoResponse = ipInfoData
+		if ipInfoData.Country != "" || ipInfoData.City != "" || ipInfoData.Loc != "" {
+			combined.setSource("geo", source)
+		}
+		if ipInfoData.Org != "" {
+			combined.setSource("network", source)
+		}
+	}
+
+	// A record is only lost when every source failed; otherwise the
+	// failures are noted on it and it is kept out of the cache.
+	if enabled > 0 && len(errs) == enabled {
+		return CombinedResponse{}, errors.Join(errs...)
+	}
+	for source, message := range combined.Errors {
+		c.logger().Warn("source lookup failed", "ip", ip, "source", source, "err", message)
+	}
+
+	if combined.IP == "" {
+		combined.IP = ip
+	}
+	if useCache && len(errs) == 0 {
+		c.Cache.set(ip, combined)
+	}
+
+	return combined, nil
+}
+
+// SplitTarget extracts the host, and the port if one is given, from targets
+// written as host:port or as URLs such as https://example.com:8443/login.
+// Other targets are returned unchanged.
+func SplitTarget(target string) (string, string) {
+	if !strings.Contains(target, "/") {
+		if host, port, err := net.SplitHostPort(target); err == nil {
+			return host, port
+		}
+		return target, ""
+	}
+
+	raw := target
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Hostname() == "" {
+		return target, ""
+	}
+	return parsed.Hostname(), parsed.Port()
+}
+
+// NormalizeHostname trims whitespace around hostname, strips a single
+// trailing dot and lowercases it, so that forms such as "Example.COM." and
+// "example.com" compare equal.
+func NormalizeHostname(hostname string) string {
+	hostname = strings.TrimSpace(hostname)
+	hostname = strings.TrimSuffix(hostname, ".")
+	return strings.ToLower(hostname)
+}
+
+// idnaProfile converts internationalized hostnames for lookup. Unlike
+// idna.Lookup it accepts underscores, which appear in real DNS names.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// ToASCIIHostname returns the punycode (A-label) form of a hostname with
+// Unicode labels, such as münchen.de. ASCII hostnames are returned as is.
+func ToASCIIHostname(hostname string) (string, error) {
+	ascii := true
+	for i := 0; i < len(hostname); i++ {
+		if hostname[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return hostname, nil
+	}
+
+	converted, err := idnaProfile.ToASCII(hostname)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname %q: %w", hostname, err)
+	}
+	return converted, nil
+}
+
+// scopeToPort restricts the Shodan ports of combined to port and records
+// whether Shodan reports it open.
+func scopeToPort(combined *CombinedResponse, port int) {
+	open := slices.Contains(combined.Ports, port)
+	combined.Ports = nil
+	if open {
+		combined.Ports = []int{port}
+	}
+	combined.Port = port
+	combined.PortOpen = &open
+}
+
+// ProcessTarget enriches every IP the target stands for. Records for the
+// IPs that succeeded are returned alongside the errors of those that failed.
+func (c *Client) ProcessTarget(ctx context.Context, target string) ([]CombinedResponse, error) {
+	if c.TargetTimeout <= 0 {
+		return c.processTarget(ctx, target)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.TargetTimeout)
+	defer cancel()
+	results, err := c.processTarget(ctx, target)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", ErrTargetTimeout, c.TargetTimeout)
+	}
+	return results, err
+}
+
+func (c *Client) processTarget(ctx context.Context, target string) ([]CombinedResponse, error) {
+	host, portValue := SplitTarget(target)
+	port := 0
+	if portValue != "" {
+		var err error
+		port, err = strconv.Atoi(portValue)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", portValue)
+		}
+	}
+
+	ips := []string{host}
+	ip := net.ParseIP(host)
+	isIP := ip != nil
+
+	if isIP && !c.matchesFamily(ip) {
+		return nil, errors.New("address family excluded by IPv4Only/IPv6Only")
+	}
+	if !isIP {
+		if c.NormalizeHosts {
+			host = NormalizeHostname(host)
+		}
+		var err error
+		host, err = ToASCIIHostname(host)
+		if err != nil {
+			return nil, err
+		}
+		ips, err = c.ResolveHostname(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	label := ""
+	if !isIP || host != target {
+		label = target
+	}
+
+	var domainWhois *WhoisInfo
+	if c.Whois && !isIP {
+		domainWhois, _ = c.LookupWhois(ctx, host)
+	}
+
+	var dnsRecords *DNSRecords
+	if len(c.Records) > 0 && !isIP {
+		dnsRecords, _ = c.LookupRecords(ctx, host, c.Records)
+	}
+
+	var cnameChain []string
+	if c.CNAMEChain && !isIP {
+		cnameChain, _ = c.LookupCNAMEChain(ctx, host)
+	}
+
+	var results []CombinedResponse
+	var errs []error
+	for _, ip := range ips {
+		if c.skipIP(target, ip) {
+			continue
+		}
+		combined, err := c.processIP(ctx, ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ip, err))
+			continue
+		}
+		combined.Target = label
+		combined.ASN, combined.OrgName = parseOrg(combined.Org)
+		if c.AppendSource {
+			// The map may be shared with the cached record.
+			combined.Sources = maps.Clone(combined.Sources)
+		} else {
+			combined.Sources = nil
+		}
+		if len(c.ScanPorts)+len(c.ScanUDPPorts) > 0 && len(combined.Ports) == 0 {
+			combined.Ports = c.scanPorts(ctx, ip, c.ScanPorts, c.ScanUDPPorts)
+			if c.AppendSource && len(combined.Ports) > 0 {
+				combined.setSource("ports", SourceScan)
+			}
+		}
+		if port != 0 {
+			scopeToPort(&combined, port)
+		}
+
+		if c.PTR && isIP && combined.Hostname == "" {
+			if name, err := c.LookupPTR(ctx, ip); err == nil {
+				combined.Hostname = name
+			}
+		}
+
+		combined.DNS = dnsRecords
+		if cnameChain != nil {
+			combined.ResolutionChain = append(slices.Clone(cnameChain), ip)
+		}
+		if c.Whois {
+			combined.Whois = domainWhois
+			if isIP {
+				combined.Whois, _ = c.LookupWhois(ctx, ip)
+			}
+		}
+
+		if c.EnrichCVEs && len(combined.Vulns) > 0 {
+			var err error
+			combined.Vulns, err = c.enrichVulns(ctx, combined.Vulns)
+			if err != nil {
+				combined.setError("nvd", err)
+				c.logger().Warn("source lookup failed", "ip", ip, "source", "nvd", "err", err)
+			}
+		}
+		if c.VerifyPorts && len(combined.Ports) > 0 {
+			combined.PortStatus = c.verifyPorts(ctx, ip, combined.Ports)
+		}
+		if c.Latency {
+			if latency, ok := c.MeasureLatency(ctx, ip, combined.Ports); ok {
+				combined.LatencyMs = &latency
+			}
+		}
+		if c.TLS {
+			serverName := ""
+			if !isIP {
+				serverName = host
+			}
+			combined.TLS = c.inspectTLSPorts(ctx, ip, combined.Ports, serverName)
+		}
+		if c.HTTPGrab || c.FaviconHash {
+			grabHost := ""
+			if !isIP {
+				grabHost = host
+			}
+			combined.Web = c.grabWebPorts(ctx, ip, combined.Ports, grabHost)
+		}
+
+		results = append(results, combined)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// ProcessTargets processes targets with Concurrency workers and sends one
+// Result per target, in completion order. Once ctx is cancelled no new
+// targets are started. The channel is closed when every started target has
+// finished, and must be drained by the caller.
+func (c *Client) ProcessTargets(ctx context.Context, targets []string) <-chan Result {
+	stream := make(chan string)
+	go func() {
+		defer close(stream)
+		for _, target := range targets {
+			select {
+			case stream <- target:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c.ProcessTargetStream(ctx, stream)
+}
+
+// ProcessTargetStream is ProcessTargets for targets that arrive over time:
+// each one is started as soon as it is received and a worker is free. The
+// returned channel is closed once targets is closed, or ctx is cancelled,
+// and every started target has finished.
+func (c *Client) ProcessTargetStream(ctx context.Context, targets <-chan string) <-chan Result {
+	type job struct {
+		index  int
+		target string
+	}
+	results := make(chan Result)
+	jobs := make(chan job)
+
+	var wg sync.WaitGroup
+	for range max(c.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				responses, err := c.ProcessTarget(ctx, job.target)
+				results <- Result{Index: job.index, Target: job.target, Responses: responses, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			var target string
+			var ok bool
+			select {
+			case target, ok = <-targets:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{index: i, target: target}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
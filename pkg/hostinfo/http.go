@@ -0,0 +1,242 @@
+package hostinfo
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// isTransientStatus reports whether a response with status code is worth
+// retrying. Other 5xx codes, such as 501 Not Implemented, are permanent.
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return min(delay, retryMaxDelay)
+		}
+	}
+	backoff := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return backoff + rand.N(backoff/2+1)
+}
+
+// doWithRetry sends req, retrying idempotent requests on connection errors
+// and transient status codes. Once the retries are exhausted the last
+// response or error is returned to the caller.
+func (c *Client) doWithRetry(req *http.Request, limiter *rate.Limiter) (*http.Response, error) {
+	client := c.httpClient()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if err := waitLimiter(req, limiter); err != nil {
+			return nil, err
+		}
+		return c.do(client, req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := waitLimiter(req, limiter); err != nil {
+			return nil, err
+		}
+		resp, err := c.do(client, req)
+		if err == nil && !isTransientStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= c.Retries {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if resp != nil {
+			drainAndClose(resp.Body)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// DefaultUserAgent is sent when Client.UserAgent is empty.
+const DefaultUserAgent = "hostinfo"
+
+// do sends req with the User-Agent header and logs the exchange at debug
+// level. The query string is left out of the log since it may carry an
+// API key.
+func (c *Client) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", cmp.Or(c.UserAgent, DefaultUserAgent))
+
+	release, err := c.acquireHost(req)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := c.logger()
+	endpoint := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	start := time.Now()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		release()
+		c.observeRequest(req, 0, time.Since(start), err)
+		logger.Debug("http request failed", "method", req.Method, "url", endpoint, "duration", time.Since(start), "err", err)
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	c.observeRequest(req, resp.StatusCode, time.Since(start), nil)
+	logger.Debug("http request", "method", req.Method, "url", endpoint, "status", resp.StatusCode, "duration", time.Since(start))
+	if c.DebugHTTP {
+		resp.Body = newDebugBody(resp.Body, func(body []byte, truncated bool) {
+			logger.Debug("http response body", "url", endpoint, "status", resp.StatusCode, "body", string(body), "truncated", truncated)
+		})
+	}
+	return resp, nil
+}
+
+// acquireHost waits for one of the HostConcurrency slots of the host
+// req is sent to and returns the function that frees it.
+func (c *Client) acquireHost(req *http.Request) (func(), error) {
+	if c.HostConcurrency <= 0 {
+		return func() {}, nil
+	}
+
+	c.hostSlotsMutex.Lock()
+	if c.hostSlots == nil {
+		c.hostSlots = map[string]chan struct{}{}
+	}
+	slots, ok := c.hostSlots[req.URL.Host]
+	if !ok {
+		slots = make(chan struct{}, c.HostConcurrency)
+		c.hostSlots[req.URL.Host] = slots
+	}
+	c.hostSlotsMutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
+
+// releaseBody frees the host slot of a response once its body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// debugBodyLimit is the number of response body bytes DebugHTTP logs.
+const debugBodyLimit = 4096
+
+// debugBody copies what is read from a response body into a bounded buffer
+// and hands it to logBody once the body is closed, so decoding is
+// unaffected.
+type debugBody struct {
+	io.Reader
+	body    io.Closer
+	buf     *limitedBuffer
+	logBody func(body []byte, truncated bool)
+}
+
+func newDebugBody(body io.ReadCloser, logBody func([]byte, bool)) *debugBody {
+	buf := &limitedBuffer{limit: debugBodyLimit}
+	return &debugBody{Reader: io.TeeReader(body, buf), body: body, buf: buf, logBody: logBody}
+}
+
+func (b *debugBody) Close() error {
+	b.logBody(b.buf.Bytes(), b.buf.truncated)
+	return b.body.Close()
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the
+// rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// maxDrainBytes is how much of an unread response body drainAndClose reads
+// so the connection can be reused. Larger leftovers aren't worth reading.
+const maxDrainBytes = 64 << 10
+
+// drainAndClose reads what is left of body before closing it. The
+// transport only returns a connection to its idle pool once the body has
+// been read to the end, and decoders usually stop short of that.
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
+
+// waitLimiter blocks until limiter allows another request, or until the
+// request's context is done. A nil limiter never blocks.
+func waitLimiter(req *http.Request, limiter *rate.Limiter) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(req.Context())
+}
+
+func checkResponse(resp *http.Response, source string) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%s: %w", source, ErrNoData)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%s: %w", source, ErrRateLimited)
+	default:
+		return fmt.Errorf("%s returned %s", source, resp.Status)
+	}
+}
@@ -0,0 +1,611 @@
+package hostinfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: ""},
+		{value: "0", wantOK: true},
+		{value: "7", want: 7 * time.Second, wantOK: true},
+		{value: "-1"},
+		{value: "soon"},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), wantOK: true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+	tests := []struct {
+		name     string
+		attempt  int
+		resp     *http.Response
+		min, max time.Duration
+	}{
+		{name: "first backoff", attempt: 0, min: retryBaseDelay, max: retryBaseDelay * 3 / 2},
+		{name: "doubled backoff", attempt: 2, min: 4 * retryBaseDelay, max: 6 * retryBaseDelay},
+		{name: "capped backoff", attempt: 20, min: retryMaxDelay, max: retryMaxDelay * 3 / 2},
+		{name: "Retry-After", attempt: 3, resp: withRetryAfter("2"), min: 2 * time.Second, max: 2 * time.Second},
+		{name: "capped Retry-After", attempt: 0, resp: withRetryAfter("3600"), min: retryMaxDelay, max: retryMaxDelay},
+		{name: "invalid Retry-After", attempt: 0, resp: withRetryAfter("later"), min: retryBaseDelay, max: retryBaseDelay * 3 / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				if got := retryDelay(tt.attempt, tt.resp); got < tt.min || got > tt.max {
+					t.Fatalf("got %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		retries      int
+		failures     int
+		status       int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{name: "success", method: http.MethodGet, retries: 2, status: http.StatusServiceUnavailable, wantStatus: 200, wantRequests: 1},
+		{name: "recovers", method: http.MethodGet, retries: 2, failures: 2, status: http.StatusServiceUnavailable, wantStatus: 200, wantRequests: 3},
+		{name: "rate limited then recovers", method: http.MethodGet, retries: 1, failures: 1, status: http.StatusTooManyRequests, wantStatus: 200, wantRequests: 2},
+		{name: "retries exhausted", method: http.MethodGet, retries: 2, failures: 5, status: http.StatusBadGateway, wantStatus: http.StatusBadGateway, wantRequests: 3},
+		{name: "no retries", method: http.MethodGet, failures: 1, status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantRequests: 1},
+		{name: "permanent status", method: http.MethodGet, retries: 3, failures: 1, status: http.StatusNotFound, wantStatus: http.StatusNotFound, wantRequests: 1},
+		{name: "gateway timeout", method: http.MethodGet, retries: 1, failures: 1, status: http.StatusGatewayTimeout, wantStatus: 200, wantRequests: 2},
+		{name: "not implemented", method: http.MethodGet, retries: 3, failures: 1, status: http.StatusNotImplemented, wantStatus: http.StatusNotImplemented, wantRequests: 1},
+		{name: "HTTP version not supported", method: http.MethodGet, retries: 3, failures: 1, status: http.StatusHTTPVersionNotSupported, wantStatus: http.StatusHTTPVersionNotSupported, wantRequests: 1},
+		{name: "POST not retried", method: http.MethodPost, retries: 3, failures: 1, status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= int32(tt.failures) {
+					// Skip the backoff so the test stays fast.
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Write([]byte("ok"))
+			})
+			client := &Client{Retries: tt.retries}
+			req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.doWithRetry(req, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryConnectionErrors(t *testing.T) {
+	srv := newStub(t, respond(http.StatusOK, "{}"))
+	url := srv.URL
+	srv.Close()
+
+	client := &Client{Retries: 1}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := client.doWithRetry(req, nil); err == nil {
+		t.Fatal("got no error from a closed server")
+	}
+	if elapsed := time.Since(start); elapsed < retryBaseDelay {
+		t.Errorf("returned after %s, before backing off", elapsed)
+	}
+}
+
+func TestDoWithRetryCancelledBackoff(t *testing.T) {
+	srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client := &Client{Retries: 3}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.doWithRetry(req, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	const calls, perSecond = 6, 20
+	interval := time.Second / perSecond
+	tests := []struct {
+		name  string
+		fetch func(c *Client, ctx context.Context) error
+		limit func(c *Client, limiter *rate.Limiter)
+	}{
+		{
+			name: "Shodan",
+			fetch: func(c *Client, ctx context.Context) error {
+				_, err := c.FetchShodanData(ctx, "192.0.2.1")
+				return err
+			},
+			limit: func(c *Client, limiter *rate.Limiter) { c.ShodanLimiter = limiter },
+		},
+		{
+			name: "ipinfo",
+			fetch: func(c *Client, ctx context.Context) error {
+				_, err := c.FetchIPInfoData(ctx, "192.0.2.1")
+				return err
+			},
+			limit: func(c *Client, limiter *rate.Limiter) { c.IPInfoLimiter = limiter },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var seen []time.Time
+			record := func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				seen = append(seen, time.Now())
+				mu.Unlock()
+				respond(http.StatusOK, shodanBody)(w, r)
+			}
+			client := stubClient(t, record, record)
+			tt.limit(client, rate.NewLimiter(perSecond, 1))
+
+			// The workers share one limiter, so together they are held to
+			// the configured rate.
+			var wg sync.WaitGroup
+			for i := 0; i < calls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := tt.fetch(client, context.Background()); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(seen) != calls {
+				t.Fatalf("got %d requests, want %d", len(seen), calls)
+			}
+			slices.SortFunc(seen, func(a, b time.Time) int { return a.Compare(b) })
+			// Allow some scheduling jitter on top of the limiter's spacing.
+			if span, want := seen[calls-1].Sub(seen[0]), (calls-1)*interval*9/10; span < want {
+				t.Errorf("%d requests took %s, want at least %s", calls, span, want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	client := stubClient(t, failOnHit(t, "Shodan"), failOnHit(t, "ipinfo"))
+	client.ShodanLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	client.ShodanLimiter.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.FetchShodanData(ctx, "192.0.2.1"); err == nil {
+		t.Error("got no error waiting past the deadline")
+	}
+}
+
+// bufferLogger returns a logger writing text records at level and above
+// to the returned buffer.
+func bufferLogger(level slog.Level) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: level})), &buf
+}
+
+func TestLoggerHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   slog.Level
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "debug",
+			level:   slog.LevelDebug,
+			want:    []string{"level=DEBUG", `msg="http request"`, "method=GET", "status=200", "/192.0.2.1"},
+			notWant: []string{"secret"},
+		},
+		{name: "info", level: slog.LevelInfo, notWant: []string{"http request"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := bufferLogger(tt.level)
+			client := stubClient(t, respond(http.StatusOK, shodanBody), respond(http.StatusOK, ipinfoBody))
+			client.IPInfoToken = "secret"
+			client.Logger = logger
+			if _, err := client.FetchIPInfoData(context.Background(), "192.0.2.1"); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("log is missing %q:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("log contains %q:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerHTTPFailure(t *testing.T) {
+	logger, buf := bufferLogger(slog.LevelDebug)
+	client := &Client{Logger: logger, ShodanURL: "http://127.0.0.1:1"}
+	client.FetchShodanData(context.Background(), "192.0.2.1")
+	if got := buf.String(); !strings.Contains(got, `msg="http request failed"`) || !strings.Contains(got, "err=") {
+		t.Errorf("got log:\n%s", got)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{name: "under the limit", writes: []string{"ab", "cd"}, want: "abcd"},
+		{name: "at the limit", writes: []string{"abcdef"}, want: "abcdef"},
+		{name: "over the limit", writes: []string{"abcd", "efgh"}, want: "abcdef", wantTruncated: true},
+		{name: "after the limit", writes: []string{"abcdef", "g"}, want: "abcdef", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &limitedBuffer{limit: 6}
+			for _, w := range tt.writes {
+				// Writes always report success so the TeeReader never fails.
+				if n, err := buf.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if got := buf.String(); got != tt.want || buf.truncated != tt.wantTruncated {
+				t.Errorf("got %q truncated %v, want %q truncated %v", got, buf.truncated, tt.want, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestDebugHTTP(t *testing.T) {
+	long := `{"ip":"192.0.2.1","padding":"` + strings.Repeat("x", debugBodyLimit) + `"}`
+	tests := []struct {
+		name    string
+		debug   bool
+		body    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "body logged",
+			debug: true,
+			body:  ipinfoBody,
+			want:  []string{`msg="http response body"`, "status=200", "AS64500 Example", "truncated=false"},
+		},
+		{name: "long body truncated", debug: true, body: long, want: []string{"truncated=true"}},
+		{name: "disabled", body: ipinfoBody, notWant: []string{"http response body"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := bufferLogger(slog.LevelDebug)
+			client := stubClient(t, failOnHit(t, "Shodan"), respond(http.StatusOK, tt.body))
+			client.Logger = logger
+			client.DebugHTTP = tt.debug
+			got, err := client.FetchIPInfoData(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IP != "192.0.2.1" {
+				t.Errorf("got IP %q, want the body still decoded", got.IP)
+			}
+			log := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(log, want) {
+					t.Errorf("log is missing %q:\n%s", want, log)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(log, notWant) {
+					t.Errorf("log contains %q:\n%s", notWant, log)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	// The decoder leaves the trailing whitespace after the JSON value
+	// unread, yet the connection must still go back to the idle pool.
+	padded := shodanBody + strings.Repeat(" ", 32<<10)
+	tests := []struct {
+		name  string
+		fetch func(c *Client, ctx context.Context) error
+	}{
+		{
+			name: "Shodan",
+			fetch: func(c *Client, ctx context.Context) error {
+				_, err := c.FetchShodanData(ctx, "192.0.2.1")
+				return err
+			},
+		},
+		{
+			name: "ipinfo",
+			fetch: func(c *Client, ctx context.Context) error {
+				_, err := c.FetchIPInfoData(ctx, "192.0.2.1")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dials atomic.Int32
+			srv := httptest.NewUnstartedServer(respond(http.StatusOK, padded))
+			srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					dials.Add(1)
+				}
+			}
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			var reused atomic.Int32
+			ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					if info.Reused {
+						reused.Add(1)
+					}
+				},
+			})
+			client := &Client{HTTPClient: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}, ShodanURL: srv.URL, IPInfoURL: srv.URL}
+			const fetches = 5
+			for range fetches {
+				if err := tt.fetch(client, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := dials.Load(); n != 1 {
+				t.Errorf("server saw %d connections, want 1", n)
+			}
+			if n := reused.Load(); n != fetches-1 {
+				t.Errorf("got %d reused connections, want %d", n, fetches-1)
+			}
+		})
+	}
+}
+
+func TestDrainAndClose(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		wantRead int
+	}{
+		{name: "small leftover", size: 100, wantRead: 100},
+		{name: "large leftover", size: 2 * maxDrainBytes, wantRead: maxDrainBytes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &countingBody{Reader: strings.NewReader(strings.Repeat("x", tt.size))}
+			drainAndClose(body)
+			if body.read != tt.wantRead || !body.closed {
+				t.Errorf("read %d bytes and closed %v, want %d and closed", body.read, body.closed, tt.wantRead)
+			}
+		})
+	}
+}
+
+type countingBody struct {
+	*strings.Reader
+	read   int
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestUserAgent(t *testing.T) {
+	calls := []struct {
+		name string
+		call func(c *Client, url string)
+	}{
+		{name: "Shodan", call: func(c *Client, url string) {
+			c.ShodanURL = url
+			c.FetchShodanData(context.Background(), "192.0.2.1")
+		}},
+		{name: "ipinfo", call: func(c *Client, url string) {
+			c.IPInfoURL = url
+			c.FetchIPInfoData(context.Background(), "192.0.2.1")
+		}},
+		{name: "NVD", call: func(c *Client, url string) {
+			c.NVDURL = url
+			c.FetchCVE(context.Background(), "CVE-2021-44228")
+		}},
+		{name: "RIPEstat", call: func(c *Client, url string) {
+			c.RIPEStatURL = url
+			c.LookupASNPrefixes(context.Background(), "AS64500")
+		}},
+		{name: "DoH", call: func(c *Client, url string) {
+			c.Resolver = url + "/dns-query"
+			c.ResolveHostname(context.Background(), "example.com")
+		}},
+	}
+	agents := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: DefaultUserAgent},
+		{name: "custom", userAgent: "scanner/1.0 (ops@example.com)", want: "scanner/1.0 (ops@example.com)"},
+	}
+	for _, call := range calls {
+		for _, agent := range agents {
+			t.Run(call.name+" "+agent.name, func(t *testing.T) {
+				var mu sync.Mutex
+				var got []string
+				srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					got = append(got, r.Header.Get("User-Agent"))
+					mu.Unlock()
+					w.Write([]byte("{}"))
+				}))
+				defer srv.Close()
+				call.call(&Client{HTTPClient: srv.Client(), UserAgent: agent.userAgent}, srv.URL)
+				mu.Lock()
+				defer mu.Unlock()
+				if len(got) == 0 {
+					t.Fatal("got no request")
+				}
+				for _, ua := range got {
+					if ua != agent.want {
+						t.Errorf("got User-Agent %q, want %q", ua, agent.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// peakStub serves slow InternetDB-style answers and records the most
+// requests it handled at once.
+func peakStub(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var inFlight, peak atomic.Int32
+	srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"ip":"192.0.2.1"}`))
+	})
+	return srv, &peak
+}
+
+func TestHostConcurrency(t *testing.T) {
+	const requests = 8
+	tests := []struct {
+		name     string
+		limit    int
+		wantPeak int32
+	}{
+		{name: "unlimited", wantPeak: requests},
+		{name: "one", limit: 1, wantPeak: 1},
+		{name: "three", limit: 3, wantPeak: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodan, shodanPeak := peakStub(t)
+			ipinfo, ipinfoPeak := peakStub(t)
+			client := &Client{ShodanURL: shodan.URL, IPInfoURL: ipinfo.URL, HostConcurrency: tt.limit}
+
+			var wg sync.WaitGroup
+			for range requests {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					if _, err := client.FetchShodanData(context.Background(), "192.0.2.1"); err != nil {
+						t.Error(err)
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					if _, err := client.FetchIPInfoData(context.Background(), "192.0.2.1"); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// Each host has its own slots, so both reach the cap.
+			for name, peak := range map[string]*atomic.Int32{"Shodan": shodanPeak, "ipinfo": ipinfoPeak} {
+				if got := peak.Load(); got != tt.wantPeak {
+					t.Errorf("got %d %s requests at once, want %d", got, name, tt.wantPeak)
+				}
+			}
+		})
+	}
+}
+
+func TestHostConcurrencyCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("{}"))
+	})
+	defer close(release)
+	client := &Client{ShodanURL: srv.URL, HostConcurrency: 1}
+	go client.FetchShodanData(context.Background(), "192.0.2.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	for busy := false; !busy; {
+		client.hostSlotsMutex.Lock()
+		busy = len(client.hostSlots[strings.TrimPrefix(srv.URL, "http://")]) == 1
+		client.hostSlotsMutex.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.FetchShodanData(ctx, "192.0.2.1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the wait for a slot cancelled", err)
+	}
+}
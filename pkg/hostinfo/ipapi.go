@@ -0,0 +1,102 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Geolocation providers accepted by Client.GeoProvider.
+const (
+	GeoProviderIPInfo = "ipinfo"
+	GeoProviderIPAPI  = "ipapi"
+)
+
+// ipAPIFields are the fields requested from ip-api.com.
+const ipAPIFields = "status,message,query,reverse,city,regionName,countryCode,zip,lat,lon,timezone,as"
+
+type ipAPIResponse struct {
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+	Query       string  `json:"query"`
+	Reverse     string  `json:"reverse"`
+	City        string  `json:"city"`
+	RegionName  string  `json:"regionName"`
+	CountryCode string  `json:"countryCode"`
+	Zip         string  `json:"zip"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+	AS          string  `json:"as"`
+}
+
+// FetchIPAPIData queries ip-api.com for ip and maps the answer onto an
+// IPInfoResponse. It returns ErrNoData for private, reserved and otherwise
+// unknown addresses.
+func (c *Client) FetchIPAPIData(ctx context.Context, ip string) (IPInfoResponse, error) {
+	// The free ip-api.com endpoint is only served over plain HTTP.
+	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=%s", ip, ipAPIFields)
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderIPAPI), http.MethodGet, url, nil)
+	if err != nil {
+		return IPInfoResponse{}, err
+	}
+
+	resp, err := c.doWithRetry(req, nil)
+	if err != nil {
+		return IPInfoResponse{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if err := checkResponse(resp, "ip-api.com"); err != nil {
+		return IPInfoResponse{}, err
+	}
+
+	var ipAPIData ipAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ipAPIData); err != nil {
+		return IPInfoResponse{}, err
+	}
+	if ipAPIData.Status != "success" {
+		return IPInfoResponse{}, fmt.Errorf("ip-api.com: %s: %w", ipAPIData.Message, ErrNoData)
+	}
+
+	ipInfoData := IPInfoResponse{
+		IP:        ipAPIData.Query,
+		Hostname:  ipAPIData.Reverse,
+		City:      ipAPIData.City,
+		Region:    ipAPIData.RegionName,
+		Country:   ipAPIData.CountryCode,
+		Org:       ipAPIData.AS,
+		Postal:    ipAPIData.Zip,
+		Timezone:  ipAPIData.Timezone,
+		Latitude:  ipAPIData.Lat,
+		Longitude: ipAPIData.Lon,
+	}
+	if ipAPIData.Lat != 0 || ipAPIData.Lon != 0 {
+		ipInfoData.Loc = formatLoc(ipAPIData.Lat, ipAPIData.Lon)
+	}
+	return ipInfoData, nil
+}
+
+// fetchGeoData reads GeoDB when one is set, and otherwise queries the
+// selected geolocation provider, falling back to ip-api.com when ipinfo.io
+// is rate limited and GeoFallback is set. It also returns the source the
+// data came from.
+func (c *Client) fetchGeoData(ctx context.Context, ip string) (IPInfoResponse, string, error) {
+	if c.GeoDB != nil {
+		geoData, err := c.GeoDB.Lookup(ip)
+		return geoData, SourceMMDB, err
+	}
+	if c.GeoProvider == GeoProviderIPAPI {
+		ipAPIData, err := c.FetchIPAPIData(ctx, ip)
+		return ipAPIData, GeoProviderIPAPI, err
+	}
+
+	ipInfoData, err := c.FetchIPInfoData(ctx, ip)
+	if errors.Is(err, ErrRateLimited) && c.GeoFallback {
+		ipAPIData, err := c.FetchIPAPIData(ctx, ip)
+		return ipAPIData, GeoProviderIPAPI, err
+	}
+	return ipInfoData, GeoProviderIPInfo, err
+}
@@ -0,0 +1,114 @@
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// routeIPAPI returns an HTTP client sending the requests for ip-api.com
+// to handler.
+func routeIPAPI(t *testing.T, handler http.HandlerFunc) *http.Client {
+	t.Helper()
+	return &http.Client{Transport: stubTransport{"ip-api.com": newStub(t, handler)}}
+}
+
+const ipAPIBody = `{"status":"success","query":"192.0.2.1","reverse":"host.example.test","city":"Mountain View",
+"regionName":"California","countryCode":"US","zip":"94043","lat":37.4056,"lon":-122.0775,
+"timezone":"America/Los_Angeles","as":"AS64500 Example"}`
+
+func TestFetchIPAPIData(t *testing.T) {
+	want := IPInfoResponse{
+		IP:        "192.0.2.1",
+		Hostname:  "host.example.test",
+		City:      "Mountain View",
+		Region:    "California",
+		Country:   "US",
+		Loc:       "37.4056,-122.0775",
+		Org:       "AS64500 Example",
+		Postal:    "94043",
+		Timezone:  "America/Los_Angeles",
+		Latitude:  37.4056,
+		Longitude: -122.0775,
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    IPInfoResponse
+		wantErr error
+	}{
+		{name: "success", handler: respond(http.StatusOK, ipAPIBody), want: want},
+		{name: "no location", handler: respond(http.StatusOK, `{"status":"success","query":"192.0.2.1"}`), want: IPInfoResponse{IP: "192.0.2.1"}},
+		{name: "reserved range", handler: respond(http.StatusOK, `{"status":"fail","message":"reserved range","query":"192.0.2.1"}`), wantErr: ErrNoData},
+		{name: "rate limited", handler: respond(http.StatusTooManyRequests, ""), wantErr: ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotFields string
+			client := &Client{HTTPClient: routeIPAPI(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotFields = r.URL.Path, r.URL.Query().Get("fields")
+				tt.handler(w, r)
+			})}
+			got, err := client.FetchIPAPIData(context.Background(), "192.0.2.1")
+			if gotPath != "/json/192.0.2.1" || gotFields != ipAPIFields {
+				t.Errorf("got request for %s with fields %q", gotPath, gotFields)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchGeoData(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    string
+		fallback    bool
+		ipinfo      http.HandlerFunc
+		wantSource  string
+		wantCountry string
+		wantErr     error
+	}{
+		{name: "ipinfo", ipinfo: respond(http.StatusOK, ipinfoBody), wantSource: GeoProviderIPInfo, wantCountry: "US"},
+		{name: "ipapi", provider: GeoProviderIPAPI, ipinfo: respond(http.StatusInternalServerError, ""), wantSource: GeoProviderIPAPI, wantCountry: "US"},
+		{name: "rate limited", ipinfo: respond(http.StatusTooManyRequests, ""), wantErr: ErrRateLimited},
+		{name: "rate limited with fallback", fallback: true, ipinfo: respond(http.StatusTooManyRequests, ""), wantSource: GeoProviderIPAPI, wantCountry: "US"},
+		{name: "other error with fallback", fallback: true, ipinfo: respond(http.StatusNotFound, ""), wantErr: ErrNoData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{
+				HTTPClient: &http.Client{Transport: stubTransport{
+					"ipinfo.io":  newStub(t, tt.ipinfo),
+					"ip-api.com": newStub(t, respond(http.StatusOK, ipAPIBody)),
+				}},
+				GeoProvider: tt.provider,
+				GeoFallback: tt.fallback,
+			}
+			got, source, err := client.fetchGeoData(context.Background(), "192.0.2.1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source != tt.wantSource || got.Country != tt.wantCountry {
+				t.Errorf("got country %q from %s, want %q from %s", got.Country, source, tt.wantCountry, tt.wantSource)
+			}
+		})
+	}
+}
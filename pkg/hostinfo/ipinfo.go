@@ -0,0 +1,74 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultIPInfoURL is the ipinfo.io base URL used when Client.IPInfoURL is
+// empty.
+const DefaultIPInfoURL = "https://ipinfo.io"
+
+// FetchIPInfoData queries ipinfo.io for ip, authenticating with
+// IPInfoToken when it is set.
+func (c *Client) FetchIPInfoData(ctx context.Context, ip string) (IPInfoResponse, error) {
+	baseURL := c.IPInfoURL
+	if baseURL == "" {
+		baseURL = DefaultIPInfoURL
+	}
+
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderIPInfo), http.MethodGet, fmt.Sprintf("%s/%s/json", strings.TrimSuffix(baseURL, "/"), ip), nil)
+	if err != nil {
+		return IPInfoResponse{}, err
+	}
+
+	if c.IPInfoToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.IPInfoToken)
+	}
+
+	resp, err := c.doWithRetry(req, c.IPInfoLimiter)
+	if err != nil {
+		return IPInfoResponse{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if err := checkResponse(resp, "ipinfo.io"); err != nil {
+		return IPInfoResponse{}, err
+	}
+
+	var ipInfoData IPInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ipInfoData); err != nil {
+		return IPInfoResponse{}, err
+	}
+	ipInfoData.Latitude, ipInfoData.Longitude = parseLoc(ipInfoData.Loc)
+
+	return ipInfoData, nil
+}
+
+// parseLoc splits an ipinfo.io "lat,lng" string into its coordinates,
+// returning zeros when it is missing or malformed.
+func parseLoc(loc string) (float64, float64) {
+	latValue, lngValue, ok := strings.Cut(loc, ",")
+	if !ok {
+		return 0, 0
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latValue), 64)
+	if err != nil {
+		return 0, 0
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(lngValue), 64)
+	if err != nil {
+		return 0, 0
+	}
+	return lat, lng
+}
+
+// formatLoc renders coordinates as an ipinfo.io "lat,lng" string.
+func formatLoc(lat, lng float64) string {
+	return strconv.FormatFloat(lat, 'f', 4, 64) + "," + strconv.FormatFloat(lng, 'f', 4, 64)
+}
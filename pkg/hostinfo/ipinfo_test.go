@@ -0,0 +1,113 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFetchIPInfoDataToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		wantAuth string
+	}{
+		{name: "anonymous"},
+		{name: "token", token: "secret", wantAuth: "Bearer secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth, gotPath, gotQuery string
+			ipinfo := func(w http.ResponseWriter, r *http.Request) {
+				gotAuth, gotPath, gotQuery = r.Header.Get("Authorization"), r.URL.Path, r.URL.RawQuery
+				respond(http.StatusOK, ipinfoBody)(w, r)
+			}
+			client := stubClient(t, respond(http.StatusOK, shodanBody), ipinfo)
+			client.IPInfoToken = tt.token
+			got, err := client.FetchIPInfoData(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Country != "US" {
+				t.Errorf("got country %q, want US", got.Country)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Errorf("got Authorization %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if gotPath != "/192.0.2.1/json" || gotQuery != "" {
+				t.Errorf("got request for %s?%s, want /192.0.2.1/json without a query", gotPath, gotQuery)
+			}
+		})
+	}
+}
+
+func TestFetchIPInfoDataStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusForbidden, wantErr: true},
+		{status: http.StatusNotFound, wantErr: true},
+	}
+	for _, tt := range tests {
+		client := stubClient(t, respond(http.StatusOK, shodanBody), respond(tt.status, ipinfoBody))
+		if _, err := client.FetchIPInfoData(context.Background(), "192.0.2.1"); (err != nil) != tt.wantErr {
+			t.Errorf("status %d: got error %v, want error %v", tt.status, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseLoc(t *testing.T) {
+	tests := []struct {
+		loc      string
+		lat, lng float64
+	}{
+		{loc: "37.4056,-122.0775", lat: 37.4056, lng: -122.0775},
+		{loc: " -33.8688 , 151.2093 ", lat: -33.8688, lng: 151.2093},
+		{loc: "0,0"},
+		{loc: ""},
+		{loc: "37.4056"},
+		{loc: "north,west"},
+		{loc: "37.4056,west"},
+	}
+	for _, tt := range tests {
+		if lat, lng := parseLoc(tt.loc); lat != tt.lat || lng != tt.lng {
+			t.Errorf("parseLoc(%q) = %v, %v, want %v, %v", tt.loc, lat, lng, tt.lat, tt.lng)
+		}
+	}
+}
+
+func TestFetchIPInfoDataLoc(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		lat, lng float64
+		wantJSON bool
+	}{
+		{name: "loc", body: `{"ip":"192.0.2.1","loc":"37.4056,-122.0775"}`, lat: 37.4056, lng: -122.0775, wantJSON: true},
+		{name: "no loc", body: `{"ip":"192.0.2.1"}`},
+		{name: "malformed loc", body: `{"ip":"192.0.2.1","loc":"unknown"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, respond(http.StatusOK, shodanBody), respond(http.StatusOK, tt.body))
+			got, err := client.FetchIPInfoData(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Latitude != tt.lat || got.Longitude != tt.lng {
+				t.Errorf("got %v, %v, want %v, %v", got.Latitude, got.Longitude, tt.lat, tt.lng)
+			}
+			encoded, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasLat := strings.Contains(string(encoded), `"latitude"`); hasLat != tt.wantJSON {
+				t.Errorf("got %s, want latitude present %v", encoded, tt.wantJSON)
+			}
+		})
+	}
+}
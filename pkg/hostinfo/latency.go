@@ -0,0 +1,47 @@
+package hostinfo
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// latencyPorts are tried before the ports Shodan reports when measuring
+// latency.
+var latencyPorts = []int{443, 80}
+
+// MeasureLatency returns the TCP connect round-trip time to ip in
+// milliseconds, trying 443, 80 and then the first of ports in that order.
+// Each attempt is bounded by PortTimeout. It reports false when none of
+// them connects.
+func (c *Client) MeasureLatency(ctx context.Context, ip string, ports []int) (float64, bool) {
+	timeout := c.PortTimeout
+	if timeout <= 0 {
+		timeout = DefaultPortTimeout
+	}
+
+	candidates := slices.Clone(latencyPorts)
+	if len(ports) > 0 && !slices.Contains(candidates, ports[0]) {
+		candidates = append(candidates, ports[0])
+	}
+
+	var dialer net.Dialer
+	for _, port := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		conn, err := dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		return float64(elapsed.Microseconds()) / 1000, true
+	}
+	return 0, false
+}
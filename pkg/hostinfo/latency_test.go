@@ -0,0 +1,84 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useLatencyPorts replaces the preferred latency ports until the test ends,
+// so local services on 443 or 80 don't get in the way.
+func useLatencyPorts(t *testing.T, ports ...int) {
+	t.Helper()
+	old := latencyPorts
+	latencyPorts = ports
+	t.Cleanup(func() { latencyPorts = old })
+}
+
+func TestMeasureLatency(t *testing.T) {
+	open, closed := openTCPPort(t), closedTCPPort(t)
+	tests := []struct {
+		name      string
+		preferred []int
+		ports     []int
+		wantOK    bool
+	}{
+		{name: "preferred port", preferred: []int{open}, wantOK: true},
+		{name: "falls back to a Shodan port", preferred: []int{closed}, ports: []int{open, closed}, wantOK: true},
+		{name: "only the first Shodan port", preferred: []int{closed}, ports: []int{closed, open}},
+		{name: "nothing connects", preferred: []int{closed}, ports: []int{closed}},
+		{name: "no ports", preferred: []int{closed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useLatencyPorts(t, tt.preferred...)
+			client := &Client{PortTimeout: time.Second}
+			latency, ok := client.MeasureLatency(context.Background(), "127.0.0.1", tt.ports)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if ok && latency < 0 {
+				t.Errorf("got latency %v ms, want it non-negative", latency)
+			}
+		})
+	}
+}
+
+func TestProcessTargetLatency(t *testing.T) {
+	open, closed := openTCPPort(t), closedTCPPort(t)
+	useLatencyPorts(t, closed)
+	tests := []struct {
+		name        string
+		port        int
+		wantLatency bool
+	}{
+		{name: "reachable", port: open, wantLatency: true},
+		{name: "unreachable", port: closed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, respond(http.StatusOK, fmt.Sprintf(`{"ip":"127.0.0.1","ports":[%d]}`, tt.port)), respond(http.StatusOK, "{}"))
+			client.Latency = true
+			client.PortTimeout = time.Second
+			results, err := client.ProcessTarget(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results[0].LatencyMs
+			if (got != nil) != tt.wantLatency || got != nil && *got < 0 {
+				t.Fatalf("got latency %v, want one %v", got, tt.wantLatency)
+			}
+			data, err := json.Marshal(results[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if has := strings.Contains(string(data), `"latency_ms"`); has != tt.wantLatency {
+				t.Errorf("got %s, want latency_ms %v", data, tt.wantLatency)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package hostinfo
+
+import "container/list"
+
+// lru is a map that remembers the order its keys were last used in, so the
+// least recently used one can be evicted in O(1). The zero value is empty
+// and ready to use. It is not safe for concurrent use.
+type lru[V any] struct {
+	items map[string]*list.Element
+	// order holds *lruItem values, most recently used first.
+	order list.List
+}
+
+type lruItem[V any] struct {
+	key   string
+	value V
+}
+
+func (l *lru[V]) len() int {
+	return l.order.Len()
+}
+
+// get returns the value of key and marks it as most recently used.
+func (l *lru[V]) get(key string) (V, bool) {
+	element, ok := l.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	l.order.MoveToFront(element)
+	return element.Value.(*lruItem[V]).value, true
+}
+
+// set stores value under key as the most recently used entry, then evicts
+// the least recently used ones beyond limit. A limit of zero is unbounded.
+func (l *lru[V]) set(key string, value V, limit int) {
+	if element, ok := l.items[key]; ok {
+		element.Value.(*lruItem[V]).value = value
+		l.order.MoveToFront(element)
+	} else {
+		if l.items == nil {
+			l.items = map[string]*list.Element{}
+		}
+		l.items[key] = l.order.PushFront(&lruItem[V]{key: key, value: value})
+	}
+
+	for limit > 0 && l.order.Len() > limit {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem[V]).key)
+	}
+}
+
+// each calls fn for every entry, least recently used first.
+func (l *lru[V]) each(fn func(key string, value V)) {
+	for element := l.order.Back(); element != nil; element = element.Prev() {
+		item := element.Value.(*lruItem[V])
+		fn(item.key, item.value)
+	}
+}
@@ -0,0 +1,252 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultNVDURL is the NVD CVE API endpoint used when Client.NVDURL is empty.
+const DefaultNVDURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+
+// NVD allows nvdPublicLimit requests in a rolling nvdWindow without an API
+// key, and nvdAPIKeyLimit with one.
+const (
+	nvdWindow      = 30 * time.Second
+	nvdPublicLimit = 5
+	nvdAPIKeyLimit = 50
+)
+
+// Vuln is a CVE reported by Shodan. It is encoded as the bare CVE ID until
+// it has been enriched, and as an object with its CVSS score afterwards.
+type Vuln struct {
+	ID       string  `json:"id" yaml:"id"`
+	CVSS     float64 `json:"cvss" yaml:"cvss"`
+	Severity string  `json:"severity" yaml:"severity"`
+}
+
+func (v Vuln) MarshalJSON() ([]byte, error) {
+	if v.Severity == "" {
+		return json.Marshal(v.ID)
+	}
+	type vuln Vuln
+	return json.Marshal(vuln(v))
+}
+
+func (v *Vuln) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*v = Vuln{}
+		return json.Unmarshal(data, &v.ID)
+	}
+	type vuln Vuln
+	return json.Unmarshal(data, (*vuln)(v))
+}
+
+func (v Vuln) MarshalYAML() (any, error) {
+	if v.Severity == "" {
+		return v.ID, nil
+	}
+	type vuln Vuln
+	return vuln(v), nil
+}
+
+func (v *Vuln) UnmarshalYAML(unmarshal func(any) error) error {
+	*v = Vuln{}
+	if err := unmarshal(&v.ID); err == nil {
+		return nil
+	}
+	type vuln Vuln
+	return unmarshal((*vuln)(v))
+}
+
+// VulnIDs returns the CVE IDs of vulns.
+func VulnIDs(vulns []Vuln) []string {
+	ids := make([]string, len(vulns))
+	for i, v := range vulns {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+type nvdMetric struct {
+	BaseSeverity string `json:"baseSeverity"`
+	CVSSData     struct {
+		BaseScore    float64 `json:"baseScore"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+}
+
+type nvdResponse struct {
+	Vulnerabilities []struct {
+		CVE struct {
+			ID      string `json:"id"`
+			Metrics struct {
+				V40 []nvdMetric `json:"cvssMetricV40"`
+				V31 []nvdMetric `json:"cvssMetricV31"`
+				V30 []nvdMetric `json:"cvssMetricV30"`
+				V2  []nvdMetric `json:"cvssMetricV2"`
+			} `json:"metrics"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+// nvdLimiter returns NVDLimiter, or a limiter keeping to the public NVD
+// rate limit of the API key in use when it is nil.
+func (c *Client) nvdLimiter() *rate.Limiter {
+	if c.NVDLimiter != nil {
+		return c.NVDLimiter
+	}
+	c.nvdOnce.Do(func() {
+		limit := nvdPublicLimit
+		if c.NVDAPIKey != "" {
+			limit = nvdAPIKeyLimit
+		}
+		c.defaultNVDLimiter = rate.NewLimiter(rate.Every(nvdWindow/time.Duration(limit)), 1)
+	})
+	return c.defaultNVDLimiter
+}
+
+// FetchCVE looks up the CVSS score and severity of a CVE, preferring the
+// newest CVSS version NVD has. CVEs without any score get severity
+// "UNKNOWN". Requests are throttled by NVDLimiter, and an exceeded NVD rate
+// limit is reported as ErrRateLimited.
+func (c *Client) FetchCVE(ctx context.Context, id string) (Vuln, error) {
+	endpoint := c.NVDURL
+	if endpoint == "" {
+		endpoint = DefaultNVDURL
+	}
+
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderNVD), http.MethodGet, endpoint+"?cveId="+url.QueryEscape(id), nil)
+	if err != nil {
+		return Vuln{}, err
+	}
+	if c.NVDAPIKey != "" {
+		req.Header.Set("apiKey", c.NVDAPIKey)
+	}
+
+	resp, err := c.doWithRetry(req, c.nvdLimiter())
+	if err != nil {
+		return Vuln{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode == http.StatusForbidden {
+		// NVD answers 403 rather than 429 once the rate limit is exceeded.
+		return Vuln{}, fmt.Errorf("NVD: %w (%s)", ErrRateLimited, resp.Status)
+	}
+	if err := checkResponse(resp, "NVD"); err != nil {
+		return Vuln{}, err
+	}
+
+	var nvdData nvdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&nvdData); err != nil {
+		return Vuln{}, err
+	}
+	if len(nvdData.Vulnerabilities) == 0 {
+		return Vuln{}, fmt.Errorf("NVD: %s: %w", id, ErrNoData)
+	}
+
+	vuln := Vuln{ID: id, Severity: "UNKNOWN"}
+	metrics := nvdData.Vulnerabilities[0].CVE.Metrics
+	for _, versions := range [][]nvdMetric{metrics.V40, metrics.V31, metrics.V30, metrics.V2} {
+		if len(versions) == 0 {
+			continue
+		}
+		metric := versions[0]
+		vuln.CVSS = metric.CVSSData.BaseScore
+		vuln.Severity = metric.CVSSData.BaseSeverity
+		if vuln.Severity == "" {
+			vuln.Severity = metric.BaseSeverity
+		}
+		break
+	}
+	return vuln, nil
+}
+
+// enrichVulns returns a copy of vulns with the CVSS details filled in.
+// CVEs that can't be looked up are kept as bare IDs, and the first failure
+// is returned. Once NVD reports its rate limit exceeded the remaining CVEs
+// are left as bare IDs too.
+func (c *Client) enrichVulns(ctx context.Context, vulns []Vuln) ([]Vuln, error) {
+	enriched := slices.Clone(vulns)
+	var firstErr error
+	for i, v := range vulns {
+		details, err := c.lookupCVE(ctx, v.ID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			if errors.Is(err, ErrRateLimited) || ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		enriched[i] = details
+	}
+	return enriched, firstErr
+}
+
+// cveCall is a FetchCVE in flight, shared by every lookup of the same CVE.
+type cveCall struct {
+	done chan struct{}
+	vuln Vuln
+	err  error
+}
+
+// lookupCVE returns the details of a CVE, fetching each one once per
+// client. Concurrent lookups of a CVE wait for the same request. CVEs NVD
+// doesn't know are cached with severity "UNKNOWN"; other failures aren't
+// cached so later lookups try again.
+func (c *Client) lookupCVE(ctx context.Context, id string) (Vuln, error) {
+	for {
+		c.cveMutex.Lock()
+		if cached, ok := c.cves[id]; ok {
+			c.cveMutex.Unlock()
+			return cached, nil
+		}
+		if call, ok := c.cveCalls[id]; ok {
+			c.cveMutex.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return Vuln{}, ctx.Err()
+			}
+			if call.err != nil && ctx.Err() == nil &&
+				(errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+				// The lookup was abandoned by its own target; try again.
+				continue
+			}
+			return call.vuln, call.err
+		}
+		call := &cveCall{done: make(chan struct{})}
+		if c.cveCalls == nil {
+			c.cveCalls = map[string]*cveCall{}
+		}
+		c.cveCalls[id] = call
+		c.cveMutex.Unlock()
+
+		call.vuln, call.err = c.FetchCVE(ctx, id)
+		if errors.Is(call.err, ErrNoData) {
+			call.vuln, call.err = Vuln{ID: id, Severity: "UNKNOWN"}, nil
+		}
+
+		c.cveMutex.Lock()
+		delete(c.cveCalls, id)
+		if call.err == nil {
+			if c.cves == nil {
+				c.cves = map[string]Vuln{}
+			}
+			c.cves[id] = call.vuln
+		}
+		c.cveMutex.Unlock()
+		close(call.done)
+		return call.vuln, call.err
+	}
+}
@@ -0,0 +1,219 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// nvdBody is an NVD answer for id scored score under CVSS v3.1.
+func nvdBody(id string, score float64, severity string) string {
+	return fmt.Sprintf(`{"vulnerabilities":[{"cve":{"id":%q,"metrics":{"cvssMetricV31":[{"cvssData":{"baseScore":%v,"baseSeverity":%q}}]}}}]}`, id, score, severity)
+}
+
+// nvdClient returns a client querying an NVD stub served by handler, with no
+// rate limit.
+func nvdClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	return &Client{
+		NVDURL:     newStub(t, handler).URL,
+		NVDLimiter: rate.NewLimiter(rate.Inf, 1),
+	}
+}
+
+func TestFetchCVE(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     Vuln
+		wantErr  error
+		wantFail bool
+	}{
+		{
+			name:   "v3.1 score",
+			status: http.StatusOK,
+			body:   nvdBody("CVE-2021-44228", 10, "CRITICAL"),
+			want:   Vuln{ID: "CVE-2021-44228", CVSS: 10, Severity: "CRITICAL"},
+		},
+		{
+			name:   "v2 severity outside cvssData",
+			status: http.StatusOK,
+			body:   `{"vulnerabilities":[{"cve":{"metrics":{"cvssMetricV2":[{"baseSeverity":"MEDIUM","cvssData":{"baseScore":5}}]}}}]}`,
+			want:   Vuln{ID: "CVE-2021-44228", CVSS: 5, Severity: "MEDIUM"},
+		},
+		{
+			name:   "no score",
+			status: http.StatusOK,
+			body:   `{"vulnerabilities":[{"cve":{"metrics":{}}}]}`,
+			want:   Vuln{ID: "CVE-2021-44228", Severity: "UNKNOWN"},
+		},
+		{name: "unknown CVE", status: http.StatusOK, body: `{"vulnerabilities":[]}`, wantErr: ErrNoData},
+		{name: "rate limited with 403", status: http.StatusForbidden, wantErr: ErrRateLimited},
+		{name: "rate limited with 429", status: http.StatusTooManyRequests, wantErr: ErrRateLimited},
+		{name: "server error", status: http.StatusInternalServerError, wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := nvdClient(t, respond(tt.status, tt.body))
+			got, err := client.FetchCVE(context.Background(), "CVE-2021-44228")
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantFail:
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case got != tt.want:
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchCVESendsAPIKey(t *testing.T) {
+	var key atomic.Value
+	client := nvdClient(t, func(w http.ResponseWriter, r *http.Request) {
+		key.Store(r.Header.Get("apiKey"))
+		respond(http.StatusOK, nvdBody("CVE-1", 1, "LOW"))(w, r)
+	})
+	client.NVDAPIKey = "secret"
+	if _, err := client.FetchCVE(context.Background(), "CVE-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := key.Load(); got != "secret" {
+		t.Errorf("got apiKey %q, want %q", got, "secret")
+	}
+}
+
+func TestNVDLimiterDefaults(t *testing.T) {
+	tests := []struct {
+		key  string
+		want rate.Limit
+	}{
+		{key: "", want: rate.Every(nvdWindow / nvdPublicLimit)},
+		{key: "secret", want: rate.Every(nvdWindow / nvdAPIKeyLimit)},
+	}
+	for _, tt := range tests {
+		client := &Client{NVDAPIKey: tt.key}
+		if got := client.nvdLimiter().Limit(); got != tt.want {
+			t.Errorf("key %q: got limit %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	custom := rate.NewLimiter(1, 1)
+	client := &Client{NVDLimiter: custom}
+	if client.nvdLimiter() != custom {
+		t.Error("NVDLimiter is not used")
+	}
+}
+
+func TestEnrichVulnsSharesLookups(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	client := nvdClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		id := r.URL.Query().Get("cveId")
+		respond(http.StatusOK, nvdBody(id, 7.5, "HIGH"))(w, r)
+	})
+
+	vulns := []Vuln{{ID: "CVE-1"}, {ID: "CVE-2"}}
+	const workers = 8
+	var wg sync.WaitGroup
+	results := make([][]Vuln, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = client.enrichVulns(context.Background(), vulns)
+		}()
+	}
+	// Let every worker reach the lookups before NVD answers.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := requests.Load(); got != int32(len(vulns)) {
+		t.Errorf("got %d NVD requests, want %d", got, len(vulns))
+	}
+	for i, enriched := range results {
+		for _, v := range enriched {
+			if v.Severity != "HIGH" {
+				t.Errorf("worker %d: %s not enriched: %+v", i, v.ID, v)
+			}
+		}
+	}
+}
+
+func TestEnrichVulnsFailures(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantErr      error
+		wantRequests int32
+		wantCached   bool
+	}{
+		// A rate-limited NVD is not asked about the remaining CVEs.
+		{name: "rate limited", status: http.StatusForbidden, wantErr: ErrRateLimited, wantRequests: 1},
+		{name: "unknown CVEs", status: http.StatusNotFound, wantRequests: 2, wantCached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			client := nvdClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tt.status)
+			})
+			vulns := []Vuln{{ID: "CVE-1"}, {ID: "CVE-2"}}
+			enriched, err := client.enrichVulns(context.Background(), vulns)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+			if len(enriched) != len(vulns) {
+				t.Fatalf("got %d vulns, want %d", len(enriched), len(vulns))
+			}
+			if _, cached := client.cves["CVE-1"]; cached != tt.wantCached {
+				t.Errorf("cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestProcessTargetSurfacesNVDErrors(t *testing.T) {
+	client := stubClient(t, respond(http.StatusOK, shodanBody), respond(http.StatusOK, ipinfoBody))
+	client.EnrichCVEs = true
+	client.NVDURL = newStub(t, respond(http.StatusForbidden, "")).URL
+	client.NVDLimiter = rate.NewLimiter(rate.Inf, 1)
+
+	results, err := client.ProcessTarget(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := results[0]
+	if got.Errors["nvd"] == "" {
+		t.Errorf("no NVD error recorded: %v", got.Errors)
+	}
+	data, err := json.Marshal(got.Vulns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["CVE-2021-44228"]` {
+		t.Errorf("got vulns %s, want the bare ID", data)
+	}
+}
@@ -0,0 +1,61 @@
+package hostinfo
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Providers reported to Observer.ObserveRequest.
+const (
+	ProviderShodan   = "shodan"
+	ProviderIPInfo   = "ipinfo"
+	ProviderIPAPI    = "ipapi"
+	ProviderNVD      = "nvd"
+	ProviderRIPEStat = "ripestat"
+	ProviderDoH      = "doh"
+	// ProviderTarget covers the requests sent to the scanned hosts
+	// themselves, such as those of HTTPGrab.
+	ProviderTarget = "target"
+)
+
+// Observer is notified of the HTTP requests and cache lookups a Client
+// makes, for example to export metrics. Its methods are called from many
+// goroutines at once.
+type Observer interface {
+	// ObserveRequest reports a finished HTTP request to provider, one of
+	// the Provider constants. status is zero when err is set.
+	ObserveRequest(provider string, status int, duration time.Duration, err error)
+	// ObserveCache reports a lookup of an IP in Cache.
+	ObserveCache(hit bool)
+}
+
+// providerKey carries the provider a request is sent to.
+type providerKey struct{}
+
+// withProvider returns a copy of ctx whose requests are reported as sent to
+// provider.
+func withProvider(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// requestProvider returns the provider req is sent to. Requests not
+// tagged by withProvider go to a scanned host.
+func requestProvider(req *http.Request) string {
+	if provider, ok := req.Context().Value(providerKey{}).(string); ok {
+		return provider
+	}
+	return ProviderTarget
+}
+
+func (c *Client) observeRequest(req *http.Request, status int, duration time.Duration, err error) {
+	if c.Observer != nil {
+		c.Observer.ObserveRequest(requestProvider(req), status, duration, err)
+	}
+}
+
+func (c *Client) observeCache(hit bool) {
+	if c.Observer != nil {
+		c.Observer.ObserveCache(hit)
+	}
+}
@@ -0,0 +1,84 @@
+package hostinfo
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// recordingObserver records the providers of the requests it is told about.
+type recordingObserver struct {
+	mu        sync.Mutex
+	providers []string
+}
+
+func (o *recordingObserver) ObserveRequest(provider string, status int, duration time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.providers = append(o.providers, provider)
+}
+
+func (o *recordingObserver) ObserveCache(hit bool) {}
+
+func TestObserveRequestProviders(t *testing.T) {
+	web := newStub(t, respond(http.StatusOK, "<title>stub</title>"))
+	webPort := stubPort(t, web)
+
+	tests := []struct {
+		name  string
+		setup func(c *Client)
+		run   func(ctx context.Context, c *Client) error
+		want  []string
+	}{
+		{
+			name: "shodan and ipinfo",
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.ProcessTarget(ctx, "192.0.2.1")
+				return err
+			},
+			want: []string{ProviderIPInfo, ProviderShodan},
+		},
+		{
+			name: "nvd",
+			setup: func(c *Client) {
+				c.HTTPClient.Transport.(stubTransport)["services.nvd.nist.gov"] = newStub(t, respond(http.StatusOK, nvdBody("CVE-1", 1, "LOW")))
+				c.NVDLimiter = rate.NewLimiter(rate.Inf, 1)
+			},
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.FetchCVE(ctx, "CVE-1")
+				return err
+			},
+			want: []string{ProviderNVD},
+		},
+		{
+			name: "web grab",
+			run: func(ctx context.Context, c *Client) error {
+				_, err := c.GrabHTTP(ctx, "127.0.0.1", webPort, "")
+				return err
+			},
+			want: []string{ProviderTarget},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observer := &recordingObserver{}
+			client := stubClient(t, respond(http.StatusOK, shodanBody), respond(http.StatusOK, ipinfoBody))
+			client.Observer = observer
+			if tt.setup != nil {
+				tt.setup(client)
+			}
+			if err := tt.run(context.Background(), client); err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(observer.providers)
+			if !slices.Equal(observer.providers, tt.want) {
+				t.Errorf("got providers %v, want %v", observer.providers, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultPortTimeout bounds each TCP connect, and each wait for a UDP
+// answer, when Client.PortTimeout is zero.
+const DefaultPortTimeout = 2 * time.Second
+
+// maxPortProbes is the number of ports of a single IP probed at once.
+const maxPortProbes = 8
+
+// Live port states reported by VerifyPort and ProbeUDPPort.
+const (
+	PortOpen     = "open"
+	PortClosed   = "closed"
+	PortFiltered = "filtered"
+)
+
+// PortStatus is the live state of a port Shodan reports.
+type PortStatus struct {
+	Port   int    `json:"port" yaml:"port"`
+	Status string `json:"status" yaml:"status"`
+}
+
+// VerifyPort attempts a TCP connection to ip:port. The port is open when
+// the connection succeeds, closed when it is refused and filtered when the
+// attempt times out or fails in any other way.
+func (c *Client) VerifyPort(ctx context.Context, ip string, port int) string {
+	timeout := c.PortTimeout
+	if timeout <= 0 {
+		timeout = DefaultPortTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return PortClosed
+		}
+		return PortFiltered
+	}
+	conn.Close()
+	return PortOpen
+}
+
+// udpProbes are the payloads sent to UDP ports whose usual service ignores
+// an empty datagram.
+var udpProbes = map[int][]byte{
+	// DNS query for the NS records of the root zone.
+	53: {0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01},
+	// NTPv3 client request.
+	123: append([]byte{0x1b}, make([]byte, 47)...),
+}
+
+// ProbeUDPPort sends a datagram to ip:port, the query of its usual service
+// for the ports in udpProbes and an empty one otherwise, and waits for an
+// answer. UDP has no handshake, so the state is a heuristic: the port is
+// open when anything answers, closed when the host reports it unreachable
+// over ICMP, and filtered when nothing comes back, which open services
+// ignoring the probe look like too.
+func (c *Client) ProbeUDPPort(ctx context.Context, ip string, port int) string {
+	timeout := c.PortTimeout
+	if timeout <= 0 {
+		timeout = DefaultPortTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return PortFiltered
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.Write(udpProbes[port]); err != nil {
+		return udpPortState(err)
+	}
+	_, err = conn.Read(make([]byte, 512))
+	return udpPortState(err)
+}
+
+// udpPortState maps the outcome of a UDP probe to a port state. Linux
+// reports an ICMP port unreachable as a refused connection on the next
+// operation on the socket.
+func udpPortState(err error) string {
+	switch {
+	case err == nil:
+		return PortOpen
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return PortClosed
+	default:
+		return PortFiltered
+	}
+}
+
+// verifyPorts probes every port with VerifyPort and returns their states in
+// the order of ports.
+func (c *Client) verifyPorts(ctx context.Context, ip string, ports []int) []PortStatus {
+	return c.probePorts(ctx, ip, ports, c.VerifyPort)
+}
+
+// probePorts probes every port with probe, at most maxPortProbes at a
+// time, and returns their states in the order of ports.
+func (c *Client) probePorts(ctx context.Context, ip string, ports []int, probe func(ctx context.Context, ip string, port int) string) []PortStatus {
+	statuses := make([]PortStatus, len(ports))
+	sem := make(chan struct{}, maxPortProbes)
+
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			statuses[i] = PortStatus{Port: port, Status: probe(ctx, ip, port)}
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// scanPorts connect-scans the tcp ports and probes the udp ones with
+// ProbeUDPPort, and returns the open ones in ascending order. UDP ports
+// only count when they answer.
+func (c *Client) scanPorts(ctx context.Context, ip string, tcp, udp []int) []int {
+	var open []int
+	statuses := append(c.probePorts(ctx, ip, tcp, c.VerifyPort), c.probePorts(ctx, ip, udp, c.ProbeUDPPort)...)
+	for _, status := range statuses {
+		if status.Status == PortOpen {
+			open = append(open, status.Port)
+		}
+	}
+	slices.Sort(open)
+	return slices.Compact(open)
+}
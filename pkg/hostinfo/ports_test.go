@@ -0,0 +1,230 @@
+package hostinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// openTCPPort listens on a local TCP port until the test ends.
+func openTCPPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// closedTCPPort returns a local TCP port nothing listens on.
+func closedTCPPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// udpPort binds a local UDP port until the test ends. When echo is set,
+// every datagram received is sent back; otherwise they are ignored.
+func udpPort(t *testing.T, echo bool) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if echo {
+				// Empty probes still get an answer.
+				conn.WriteTo(append(buf[:n:n], 'x'), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// closedUDPPort returns a local UDP port nothing is bound to.
+func closedUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestProbePorts(t *testing.T) {
+	client := &Client{PortTimeout: 200 * time.Millisecond}
+	tests := []struct {
+		name  string
+		probe func(ctx context.Context, ip string, port int) string
+		port  int
+		want  string
+	}{
+		{name: "open TCP", probe: client.VerifyPort, port: openTCPPort(t), want: PortOpen},
+		{name: "closed TCP", probe: client.VerifyPort, port: closedTCPPort(t), want: PortClosed},
+		{name: "answering UDP", probe: client.ProbeUDPPort, port: udpPort(t, true), want: PortOpen},
+		{name: "silent UDP", probe: client.ProbeUDPPort, port: udpPort(t, false), want: PortFiltered},
+		{name: "unreachable UDP", probe: client.ProbeUDPPort, port: closedUDPPort(t), want: PortClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.probe(context.Background(), "127.0.0.1", tt.port); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeUDPPortCancel(t *testing.T) {
+	client := &Client{PortTimeout: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if got := client.ProbeUDPPort(ctx, "127.0.0.1", udpPort(t, false)); got != PortFiltered {
+		t.Errorf("got %s, want %s", got, PortFiltered)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probe ignored cancellation for %s", elapsed)
+	}
+}
+
+func TestVerifyPortFiltered(t *testing.T) {
+	// A connect that neither succeeds nor is refused, here because it is
+	// never attempted, leaves the port filtered.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := &Client{PortTimeout: time.Second}
+	if got := client.VerifyPort(ctx, "127.0.0.1", openTCPPort(t)); got != PortFiltered {
+		t.Errorf("got %s, want %s", got, PortFiltered)
+	}
+}
+
+func TestVerifyPortsOrder(t *testing.T) {
+	// The open ports are all listening before the closed ones are picked,
+	// so a closed port can't be handed out again as an open one.
+	var open []int
+	for range 3 * maxPortProbes / 2 {
+		open = append(open, openTCPPort(t))
+	}
+	var ports []int
+	var want []PortStatus
+	for _, port := range open {
+		closed := closedTCPPort(t)
+		ports = append(ports, port, closed)
+		want = append(want, PortStatus{Port: port, Status: PortOpen}, PortStatus{Port: closed, Status: PortClosed})
+	}
+	client := &Client{PortTimeout: time.Second}
+	if got := client.verifyPorts(context.Background(), "127.0.0.1", ports); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProcessTargetVerifyPorts(t *testing.T) {
+	open, closed := openTCPPort(t), closedTCPPort(t)
+	shodan := respond(http.StatusOK, fmt.Sprintf(`{"ip":"127.0.0.1","ports":[%d,%d]}`, open, closed))
+	tests := []struct {
+		name   string
+		verify bool
+		want   []PortStatus
+	}{
+		{name: "disabled"},
+		{name: "enabled", verify: true, want: []PortStatus{{Port: open, Status: PortOpen}, {Port: closed, Status: PortClosed}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, shodan, respond(http.StatusOK, "{}"))
+			client.VerifyPorts = tt.verify
+			client.PortTimeout = time.Second
+			results, err := client.ProcessTarget(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := results[0]
+			if !slices.Equal(got.Ports, []int{open, closed}) {
+				t.Errorf("got ports %v, want Shodan's list kept", got.Ports)
+			}
+			if !slices.Equal(got.PortStatus, tt.want) {
+				t.Errorf("got port status %v, want %v", got.PortStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanPortsFillsPorts(t *testing.T) {
+	openTCP, closedTCP := openTCPPort(t), closedTCPPort(t)
+	openUDP, silentUDP := udpPort(t, true), udpPort(t, false)
+
+	tests := []struct {
+		name   string
+		shodan http.HandlerFunc
+		tcp    []int
+		udp    []int
+		want   []int
+	}{
+		{
+			name:   "scanned when Shodan has no data",
+			shodan: respond(http.StatusNotFound, `{"detail":"No information available"}`),
+			tcp:    []int{closedTCP, openTCP},
+			udp:    []int{silentUDP, openUDP},
+			want:   sortedPorts(openTCP, openUDP),
+		},
+		{
+			name:   "TCP only",
+			shodan: respond(http.StatusNotFound, `{"detail":"No information available"}`),
+			tcp:    []int{openTCP},
+			want:   []int{openTCP},
+		},
+		{
+			name:   "Shodan ports kept",
+			shodan: respond(http.StatusOK, shodanBody),
+			tcp:    []int{openTCP},
+			udp:    []int{openUDP},
+			want:   []int{22, 443},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, tt.shodan, respond(http.StatusOK, ipinfoBody))
+			client.ScanPorts = tt.tcp
+			client.ScanUDPPorts = tt.udp
+			client.PortTimeout = 200 * time.Millisecond
+			results, err := client.ProcessTarget(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results[0].Ports; !slices.Equal(got, tt.want) {
+				t.Errorf("got ports %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func sortedPorts(ports ...int) []int {
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
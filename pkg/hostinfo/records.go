@@ -0,0 +1,135 @@
+package hostinfo
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNS record types accepted in Client.Records.
+const (
+	RecordMX  = "mx"
+	RecordTXT = "txt"
+	RecordNS  = "ns"
+)
+
+// RecordTypes lists every DNS record type LookupRecords supports.
+var RecordTypes = []string{RecordMX, RecordTXT, RecordNS}
+
+// DNSRecords holds the extra DNS records of a hostname target.
+type DNSRecords struct {
+	MX  []MXRecord `json:"mx,omitempty" yaml:"mx,omitempty"`
+	TXT []string   `json:"txt,omitempty" yaml:"txt,omitempty"`
+	NS  []string   `json:"ns,omitempty" yaml:"ns,omitempty"`
+}
+
+// MXRecord is a single mail exchanger.
+type MXRecord struct {
+	Host string `json:"host" yaml:"host"`
+	Pref uint16 `json:"pref" yaml:"pref"`
+}
+
+// LookupRecords looks up each of the given record types of hostname with
+// the configured resolver. A type that fails or has no records is left
+// empty; the error of the last failure is returned only when nothing was
+// found at all.
+func (c *Client) LookupRecords(ctx context.Context, hostname string, types []string) (*DNSRecords, error) {
+	records := &DNSRecords{}
+	var lastErr error
+	for _, recordType := range types {
+		var err error
+		switch recordType {
+		case RecordMX:
+			records.MX, err = c.lookupMX(ctx, hostname)
+		case RecordTXT:
+			records.TXT, err = c.lookupTXT(ctx, hostname)
+		case RecordNS:
+			records.NS, err = c.lookupNS(ctx, hostname)
+		default:
+			err = errors.New("unsupported record type " + recordType)
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	if len(records.MX) == 0 && len(records.TXT) == 0 && len(records.NS) == 0 {
+		return nil, lastErr
+	}
+	return records, nil
+}
+
+func (c *Client) lookupMX(ctx context.Context, hostname string) ([]MXRecord, error) {
+	var mxs []MXRecord
+	if c.isDoHResolver() {
+		answers, err := c.dohExchange(ctx, hostname, dnsmessage.TypeMX)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			if body, ok := answer.Body.(*dnsmessage.MXResource); ok {
+				mxs = append(mxs, MXRecord{Host: strings.TrimSuffix(body.MX.String(), "."), Pref: body.Pref})
+			}
+		}
+		// Order by preference, as net.Resolver does.
+		slices.SortStableFunc(mxs, func(a, b MXRecord) int { return cmp.Compare(a.Pref, b.Pref) })
+		return mxs, nil
+	}
+
+	records, err := c.newResolver().LookupMX(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		mxs = append(mxs, MXRecord{Host: strings.TrimSuffix(record.Host, "."), Pref: record.Pref})
+	}
+	return mxs, nil
+}
+
+func (c *Client) lookupTXT(ctx context.Context, hostname string) ([]string, error) {
+	if !c.isDoHResolver() {
+		return c.newResolver().LookupTXT(ctx, hostname)
+	}
+
+	answers, err := c.dohExchange(ctx, hostname, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var txts []string
+	for _, answer := range answers {
+		if body, ok := answer.Body.(*dnsmessage.TXTResource); ok {
+			// Like net.Resolver, join the character-strings of a record.
+			txts = append(txts, strings.Join(body.TXT, ""))
+		}
+	}
+	return txts, nil
+}
+
+func (c *Client) lookupNS(ctx context.Context, hostname string) ([]string, error) {
+	var names []string
+	if c.isDoHResolver() {
+		answers, err := c.dohExchange(ctx, hostname, dnsmessage.TypeNS)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			if body, ok := answer.Body.(*dnsmessage.NSResource); ok {
+				names = append(names, strings.TrimSuffix(body.NS.String(), "."))
+			}
+		}
+		return names, nil
+	}
+
+	records, err := c.newResolver().LookupNS(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		names = append(names, strings.TrimSuffix(record.Host, "."))
+	}
+	return names, nil
+}
@@ -0,0 +1,113 @@
+package hostinfo
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func mxRecord(name string, pref uint16, host string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeMX), Body: &dnsmessage.MXResource{Pref: pref, MX: dnsName(host)}}
+}
+
+func txtRecord(name string, txt ...string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: txt}}
+}
+
+func nsRecord(name, host string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeNS), Body: &dnsmessage.NSResource{NS: dnsName(host)}}
+}
+
+func recordsZone() dnsZone {
+	return dnsZone{}.add(
+		ipRecord("example.test", "192.0.2.1"),
+		mxRecord("example.test", 20, "mx2.example.test"),
+		mxRecord("example.test", 10, "mx1.example.test"),
+		txtRecord("example.test", "v=spf1 ", "-all"),
+		nsRecord("example.test", "ns1.example.test"),
+		ipRecord("bare.test", "192.0.2.2"),
+	)
+}
+
+func TestLookupRecords(t *testing.T) {
+	all := &DNSRecords{
+		MX:  []MXRecord{{Host: "mx1.example.test", Pref: 10}, {Host: "mx2.example.test", Pref: 20}},
+		TXT: []string{"v=spf1 -all"},
+		NS:  []string{"ns1.example.test"},
+	}
+	tests := []struct {
+		name     string
+		hostname string
+		types    []string
+		want     *DNSRecords
+		wantErr  bool
+	}{
+		{name: "all types", hostname: "example.test", types: RecordTypes, want: all},
+		{name: "MX only", hostname: "example.test", types: []string{RecordMX}, want: &DNSRecords{MX: all.MX}},
+		{name: "TXT and NS", hostname: "example.test", types: []string{RecordTXT, RecordNS}, want: &DNSRecords{TXT: all.TXT, NS: all.NS}},
+		{name: "no records", hostname: "bare.test", types: RecordTypes},
+		{name: "missing name", hostname: "missing.test", types: RecordTypes, wantErr: true},
+		{name: "unsupported type", hostname: "example.test", types: []string{"srv"}, wantErr: true},
+	}
+	resolvers := []struct {
+		name   string
+		client func(t *testing.T) *Client
+	}{
+		{name: "DNS", client: func(t *testing.T) *Client { return &Client{Resolver: newDNSStub(t, recordsZone()).addr} }},
+		{name: "DoH", client: func(t *testing.T) *Client { return newDoHStub(t, recordsZone()) }},
+	}
+	for _, resolver := range resolvers {
+		t.Run(resolver.name, func(t *testing.T) {
+			client := resolver.client(t)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					got, err := client.LookupRecords(context.Background(), tt.hostname, tt.types)
+					if tt.wantErr {
+						if err == nil {
+							t.Fatalf("got %+v, want an error", got)
+						}
+						return
+					}
+					if !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("got %+v, want %+v", got, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestProcessTargetRecords(t *testing.T) {
+	dns := newDNSStub(t, recordsZone())
+	tests := []struct {
+		name    string
+		target  string
+		records []string
+		want    *DNSRecords
+	}{
+		{name: "hostname", target: "example.test", records: []string{RecordNS}, want: &DNSRecords{NS: []string{"ns1.example.test"}}},
+		{name: "disabled", target: "example.test"},
+		{name: "IP target", target: "192.0.2.1", records: RecordTypes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, echoShodan, respond(http.StatusOK, "{}"))
+			client.Resolver = dns.addr
+			client.Records = tt.records
+			results, err := client.ProcessTarget(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The primary resolution is unchanged by the extra lookups.
+			if got := results[0].IP; got != "192.0.2.1" {
+				t.Errorf("got IP %s, want 192.0.2.1", got)
+			}
+			if got := results[0].DNS; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got DNS %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
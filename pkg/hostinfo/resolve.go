@@ -0,0 +1,451 @@
+package hostinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ParseResolverAddress validates a DNS server address and returns it as
+// host:port, defaulting to port 53 when none is given.
+func ParseResolverAddress(value string) (string, error) {
+	if net.ParseIP(value) != nil {
+		return net.JoinHostPort(value, "53"), nil
+	}
+
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		var addrErr *net.AddrError
+		if !errors.As(err, &addrErr) || addrErr.Err != "missing port in address" {
+			return "", fmt.Errorf("invalid resolver %q: %v", value, err)
+		}
+		host, port = value, "53"
+	}
+
+	if host == "" || strings.ContainsAny(host, " /") {
+		return "", fmt.Errorf("invalid resolver %q: bad host", value)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid resolver %q: bad port %q", value, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func (c *Client) newResolver() *net.Resolver {
+	return newNetResolver(c.Resolver)
+}
+
+// newNetResolver returns a resolver querying the host:port DNS server, or
+// the system resolver when server is empty.
+func newNetResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	dialer := &net.Dialer{}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// matchesFamily reports whether ip belongs to the address family selected
+// with IPv4Only or IPv6Only. Every address matches when neither is set.
+func (c *Client) matchesFamily(ip net.IP) bool {
+	isIPv4 := ip.To4() != nil
+	switch {
+	case c.IPv4Only:
+		return isIPv4
+	case c.IPv6Only:
+		return !isIPv4
+	default:
+		return true
+	}
+}
+
+// ResolveHostname returns the addresses of hostname that match the selected
+// address family, trimmed to the first one unless AllIPs is set. Lookups
+// are memoized, within the TTL of the answers, for the lifetime of the
+// Client or in Cache when it is set.
+func (c *Client) ResolveHostname(ctx context.Context, hostname string) ([]string, error) {
+	addresses, err := c.lookupHostname(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	addresses = slices.DeleteFunc(slices.Clone(addresses), func(address string) bool {
+		return !c.matchesFamily(net.ParseIP(address))
+	})
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no IP addresses found for hostname %s", hostname)
+	}
+	if !c.AllIPs {
+		addresses = addresses[:1]
+	}
+	return addresses, nil
+}
+
+// resolutionCall is a resolution in flight, shared by every lookup of the
+// same hostname.
+type resolutionCall struct {
+	done      chan struct{}
+	addresses []string
+	err       error
+}
+
+// lookupHostname returns every address of hostname, consulting the
+// resolution cache first. Concurrent lookups of the same hostname share a
+// single resolution.
+func (c *Client) lookupHostname(ctx context.Context, hostname string) ([]string, error) {
+	for {
+		c.resolutionMutex.Lock()
+		if addresses, ok := c.cachedResolution(hostname); ok {
+			c.resolutionMutex.Unlock()
+			c.logger().Debug("resolved hostname", "hostname", hostname, "addresses", addresses, "cached", true)
+			return addresses, nil
+		}
+		if call, ok := c.resolutionCalls[hostname]; ok {
+			c.resolutionMutex.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.err != nil && ctx.Err() == nil &&
+				(errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+				// The resolution was abandoned by its own target; try again.
+				continue
+			}
+			return call.addresses, call.err
+		}
+		call := &resolutionCall{done: make(chan struct{})}
+		if c.resolutionCalls == nil {
+			c.resolutionCalls = map[string]*resolutionCall{}
+		}
+		c.resolutionCalls[hostname] = call
+		c.resolutionMutex.Unlock()
+
+		ips, ttl, err := c.resolveIPAddr(ctx, hostname)
+		if err != nil {
+			c.logger().Debug("resolving hostname failed", "hostname", hostname, "err", err)
+			call.err = err
+		} else {
+			call.addresses = make([]string, len(ips))
+			for i, ip := range ips {
+				call.addresses[i] = ip.String()
+			}
+			c.logger().Debug("resolved hostname", "hostname", hostname, "addresses", call.addresses, "ttl", ttl, "cached", false)
+		}
+
+		c.resolutionMutex.Lock()
+		delete(c.resolutionCalls, hostname)
+		if call.err == nil && ttl > 0 {
+			c.cacheResolution(hostname, call.addresses, ttl)
+		}
+		c.resolutionMutex.Unlock()
+		close(call.done)
+		return call.addresses, call.err
+	}
+}
+
+// defaultResolutionTTL bounds how long a resolution through net.Resolver,
+// which does not report the TTL of the answers, is cached.
+const defaultResolutionTTL = 5 * time.Minute
+
+// dnsRetryDelay is the delay before the first retry of a failed
+// resolution; it doubles with every further attempt.
+var dnsRetryDelay = 200 * time.Millisecond
+
+// resolveIPAddr looks hostname up on Resolver and then, if that keeps
+// failing, on SecondaryResolver. Transient failures are retried DNSRetries
+// times on each; a name that does not exist is neither retried nor looked
+// up again elsewhere. It also returns how long the addresses may be
+// cached: the lowest TTL of the answers, or defaultResolutionTTL when the
+// resolver does not report it.
+func (c *Client) resolveIPAddr(ctx context.Context, hostname string) ([]net.IPAddr, time.Duration, error) {
+	ips, ttl, err := c.resolveIPAddrWith(ctx, c.Resolver, hostname)
+	if err == nil || c.SecondaryResolver == "" || isNotFound(err) || ctx.Err() != nil {
+		return ips, ttl, err
+	}
+	c.logger().Debug("falling back to secondary resolver", "hostname", hostname, "resolver", c.SecondaryResolver, "err", err)
+	return c.resolveIPAddrWith(ctx, c.SecondaryResolver, hostname)
+}
+
+func (c *Client) resolveIPAddrWith(ctx context.Context, resolver, hostname string) ([]net.IPAddr, time.Duration, error) {
+	delay := dnsRetryDelay
+	for attempt := 0; ; attempt++ {
+		var ips []net.IPAddr
+		ttl := defaultResolutionTTL
+		var err error
+		if isDoH(resolver) {
+			ips, ttl, err = c.dohLookupIPAddr(ctx, resolver, hostname)
+		} else {
+			ips, err = newNetResolver(resolver).LookupIPAddr(ctx, hostname)
+		}
+		if err == nil || isNotFound(err) || attempt >= c.DNSRetries {
+			return ips, ttl, err
+		}
+		c.logger().Debug("retrying hostname resolution", "hostname", hostname, "attempt", attempt+1, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, 0, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// isNotFound reports whether err says the name does not exist.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// cachedResolution and cacheResolution must be called with resolutionMutex
+// held.
+func (c *Client) cachedResolution(hostname string) ([]string, bool) {
+	if c.Cache != nil {
+		return c.Cache.getResolution(hostname)
+	}
+
+	entry, ok := c.resolutions[hostname]
+	if !ok || !entry.live() {
+		return nil, false
+	}
+	return entry.Addresses, true
+}
+
+func (c *Client) cacheResolution(hostname string, addresses []string, ttl time.Duration) {
+	if c.Cache != nil {
+		c.Cache.setResolution(hostname, addresses, ttl)
+		return
+	}
+
+	if c.resolutions == nil {
+		c.resolutions = map[string]resolutionEntry{}
+	}
+	c.resolutions[hostname] = resolutionEntry{Addresses: addresses, Timestamp: time.Now(), TTL: ttl}
+}
+
+// LookupPTR returns the first PTR name of ip in lexical order, so repeated
+// runs report the same hostname.
+func (c *Client) LookupPTR(ctx context.Context, ip string) (string, error) {
+	var names []string
+	var err error
+	if c.isDoHResolver() {
+		names, err = c.dohLookupAddr(ctx, ip)
+	} else {
+		names, err = c.newResolver().LookupAddr(ctx, ip)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no PTR records found for %s", ip)
+	}
+	slices.Sort(names)
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+// maxCNAMEHops bounds LookupCNAMEChain so CNAME loops terminate.
+const maxCNAMEHops = 16
+
+// LookupCNAMEChain returns hostname followed by every CNAME it points
+// through, in resolution order. A hostname without a CNAME yields just
+// itself.
+func (c *Client) LookupCNAMEChain(ctx context.Context, hostname string) ([]string, error) {
+	qtype := dnsmessage.TypeA
+	if c.IPv6Only {
+		qtype = dnsmessage.TypeAAAA
+	}
+
+	chain := []string{strings.TrimSuffix(hostname, ".")}
+	seen := map[string]bool{strings.ToLower(chain[0]): true}
+	for len(chain) <= maxCNAMEHops {
+		answers, err := c.dnsExchange(ctx, chain[len(chain)-1], qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		// Resolvers usually return the rest of the chain along with the
+		// first hop, so follow it through the answer section before asking
+		// again.
+		progressed := false
+		for {
+			next, ok := cnameTarget(answers, chain[len(chain)-1])
+			if !ok {
+				break
+			}
+			if seen[strings.ToLower(next)] {
+				return nil, fmt.Errorf("CNAME loop at %s", next)
+			}
+			seen[strings.ToLower(next)] = true
+			chain = append(chain, next)
+			progressed = true
+			if len(chain) > maxCNAMEHops {
+				return nil, fmt.Errorf("CNAME chain of %s exceeds %d hops", hostname, maxCNAMEHops)
+			}
+		}
+		if !progressed || hasAddress(answers, chain[len(chain)-1]) {
+			return chain, nil
+		}
+	}
+	return nil, fmt.Errorf("CNAME chain of %s exceeds %d hops", hostname, maxCNAMEHops)
+}
+
+// cnameTarget returns the target of the CNAME record for name in answers.
+func cnameTarget(answers []dnsmessage.Resource, name string) (string, bool) {
+	for _, answer := range answers {
+		body, ok := answer.Body.(*dnsmessage.CNAMEResource)
+		if ok && sameName(answer.Header.Name.String(), name) {
+			return strings.TrimSuffix(body.CNAME.String(), "."), true
+		}
+	}
+	return "", false
+}
+
+// hasAddress reports whether answers hold an A or AAAA record for name.
+func hasAddress(answers []dnsmessage.Resource, name string) bool {
+	for _, answer := range answers {
+		switch answer.Body.(type) {
+		case *dnsmessage.AResource, *dnsmessage.AAAAResource:
+			if sameName(answer.Header.Name.String(), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// dnsExchange sends a raw query for name to the configured resolver: the
+// DoH endpoint, the Resolver address, or the first nameserver of
+// /etc/resolv.conf.
+func (c *Client) dnsExchange(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	if c.isDoHResolver() {
+		return c.dohExchange(ctx, name, qtype)
+	}
+
+	server := c.Resolver
+	if server == "" {
+		server = systemNameserver()
+	}
+
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := exchangeOver(ctx, "udp", server, packed)
+	if err == nil && reply.Truncated {
+		reply, err = exchangeOver(ctx, "tcp", server, packed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reply.ID != query.ID {
+		return nil, fmt.Errorf("DNS reply ID mismatch from %s", server)
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS query for %s failed: %s", name, reply.RCode)
+	}
+	return reply.Answers, nil
+}
+
+// exchangeOver sends a packed query to server over network ("udp" or
+// "tcp") and unpacks the reply.
+func exchangeOver(ctx context.Context, network, server string, packed []byte) (*dnsmessage.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dnsExchangeTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		packed = append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...)
+	}
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if network == "tcp" {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		body = make([]byte, int(length[0])<<8|int(length[1]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil, err
+		}
+	} else {
+		body = make([]byte, 65535)
+		n, err := conn.Read(body)
+		if err != nil {
+			return nil, err
+		}
+		body = body[:n]
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// dnsExchangeTimeout bounds raw DNS queries whose context has no deadline.
+const dnsExchangeTimeout = 5 * time.Second
+
+// systemNameserver returns the first nameserver listed in /etc/resolv.conf,
+// or the local resolver when there is none.
+func systemNameserver() string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
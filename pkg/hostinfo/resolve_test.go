@@ -0,0 +1,679 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsZone maps "name. TYPE", e.g. "example.test. A", to its answers. Names
+// with no record of any type don't exist.
+type dnsZone map[string][]dnsmessage.Resource
+
+func zoneKey(name string, qtype dnsmessage.Type) string {
+	return strings.ToLower(name) + " " + strings.TrimPrefix(qtype.String(), "Type")
+}
+
+func (z dnsZone) add(resources ...dnsmessage.Resource) dnsZone {
+	for _, r := range resources {
+		key := zoneKey(r.Header.Name.String(), r.Header.Type)
+		z[key] = append(z[key], r)
+	}
+	return z
+}
+
+func (z dnsZone) has(name string) bool {
+	for key := range z {
+		if strings.HasPrefix(key, strings.ToLower(name)+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// reply answers a packed query from the zone. CNAME records are returned
+// for any query type, with the records of their targets.
+func (z dnsZone) reply(packed []byte) ([]byte, error) {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil {
+		return nil, err
+	}
+	reply := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+	if len(query.Questions) == 1 {
+		q := query.Questions[0]
+		name := q.Name.String()
+		for range 16 {
+			cnames := z[zoneKey(name, dnsmessage.TypeCNAME)]
+			if len(cnames) == 0 || q.Type == dnsmessage.TypeCNAME {
+				break
+			}
+			reply.Answers = append(reply.Answers, cnames[0])
+			name = cnames[0].Body.(*dnsmessage.CNAMEResource).CNAME.String()
+		}
+		reply.Answers = append(reply.Answers, z[zoneKey(name, q.Type)]...)
+		if !z.has(q.Name.String()) {
+			reply.RCode = dnsmessage.RCodeNameError
+		}
+	}
+	return reply.Pack()
+}
+
+func dnsName(name string) dnsmessage.Name {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return dnsmessage.MustNewName(name)
+}
+
+func dnsHeader(name string, qtype dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsName(name), Type: qtype, Class: dnsmessage.ClassINET, TTL: 60}
+}
+
+// ipRecord returns the A or AAAA record of name for ip.
+func ipRecord(name, ip string) dnsmessage.Resource {
+	addr := netip.MustParseAddr(ip)
+	if addr.Is4() {
+		return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: addr.As4()}}
+	}
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeAAAA), Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}}
+}
+
+func cnameRecord(name, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeCNAME), Body: &dnsmessage.CNAMEResource{CNAME: dnsName(target)}}
+}
+
+func ptrRecord(ip, target string) dnsmessage.Resource {
+	name, err := reverseName(ip)
+	if err != nil {
+		panic(err)
+	}
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsName(target)}}
+}
+
+// servFail answers a packed query with SERVFAIL.
+func servFail(packed []byte) ([]byte, error) {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil {
+		return nil, err
+	}
+	reply := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeServerFailure},
+		Questions: query.Questions,
+	}
+	return reply.Pack()
+}
+
+// dnsStub is a DNS server on 127.0.0.1 answering over UDP and TCP from a
+// zone. The first failures queries are answered with SERVFAIL.
+type dnsStub struct {
+	addr     string
+	queries  atomic.Int32
+	failures atomic.Int32
+}
+
+func (s *dnsStub) reply(zone dnsZone, query []byte) ([]byte, error) {
+	s.queries.Add(1)
+	if s.failures.Add(-1) >= 0 {
+		return servFail(query)
+	}
+	return zone.reply(query)
+}
+
+func newDNSStub(t *testing.T, zone dnsZone) *dnsStub {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Skipf("no TCP port matching the UDP one: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	stub := &dnsStub{addr: udp.LocalAddr().String()}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply, err := stub.reply(zone, buf[:n]); err == nil {
+				udp.WriteTo(reply, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var length [2]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply, err := stub.reply(zone, query)
+					if err != nil {
+						return
+					}
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+				}
+			}()
+		}
+	}()
+	return stub
+}
+
+// multiZone has a hostname with two IPv4 and one IPv6 address.
+func multiZone() dnsZone {
+	return dnsZone{}.add(
+		ipRecord("multi.test", "192.0.2.1"),
+		ipRecord("multi.test", "192.0.2.2"),
+		ipRecord("multi.test", "2001:db8::1"),
+		ipRecord("single.test", "192.0.2.9"),
+	)
+}
+
+func TestResolveHostnameAllIPs(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		allIPs   bool
+		ipv4     bool
+		ipv6     bool
+		want     []string
+		wantErr  bool
+	}{
+		{name: "all addresses", hostname: "multi.test", allIPs: true, want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "first address", hostname: "multi.test"},
+		{name: "all IPv4", hostname: "multi.test", allIPs: true, ipv4: true, want: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "all IPv6", hostname: "multi.test", allIPs: true, ipv6: true, want: []string{"2001:db8::1"}},
+		{name: "single", hostname: "single.test", allIPs: true, want: []string{"192.0.2.9"}},
+		{name: "no IPv6", hostname: "single.test", ipv6: true, wantErr: true},
+		{name: "missing", hostname: "missing.test", wantErr: true},
+	}
+	dns := newDNSStub(t, multiZone())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{Resolver: dns.addr, AllIPs: tt.allIPs, IPv4Only: tt.ipv4, IPv6Only: tt.ipv6}
+			got, err := client.ResolveHostname(context.Background(), tt.hostname)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				// Only the first address, whichever the resolver sorted first.
+				if len(got) != 1 || !slices.Contains([]string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}, got[0]) {
+					t.Errorf("got %v, want one of the addresses", got)
+				}
+				return
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{ip: "192.0.2.1", want: "1.2.0.192.in-addr.arpa."},
+		{ip: "::ffff:192.0.2.1", want: "1.2.0.192.in-addr.arpa."},
+		{ip: "2001:db8::1", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{ip: "example.test", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := reverseName(tt.ip)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("reverseName(%q) = %q, %v, want %q", tt.ip, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupPTR(t *testing.T) {
+	zone := dnsZone{}.add(
+		ptrRecord("192.0.2.1", "host.example.test"),
+		ptrRecord("192.0.2.2", "zz.example.test"),
+		ptrRecord("192.0.2.2", "aa.example.test"),
+		ptrRecord("2001:db8::1", "v6.example.test"),
+	)
+	dns := newDNSStub(t, zone)
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{ip: "192.0.2.1", want: "host.example.test"},
+		{ip: "192.0.2.2", want: "aa.example.test"},
+		{ip: "2001:db8::1", want: "v6.example.test"},
+		{ip: "192.0.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		client := &Client{Resolver: dns.addr}
+		got, err := client.LookupPTR(context.Background(), tt.ip)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("LookupPTR(%q) = %q, %v, want %q", tt.ip, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseResolverAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "8.8.8.8", want: "8.8.8.8:53"},
+		{value: "8.8.8.8:5353", want: "8.8.8.8:5353"},
+		{value: "2001:4860:4860::8888", want: "[2001:4860:4860::8888]:53"},
+		{value: "[2001:4860:4860::8888]:5353", want: "[2001:4860:4860::8888]:5353"},
+		{value: "dns.example.test", want: "dns.example.test:53"},
+		{value: "dns.example.test:5353", want: "dns.example.test:5353"},
+		{value: "8.8.8.8:", wantErr: true},
+		{value: "8.8.8.8:dns", wantErr: true},
+		{value: "8.8.8.8:70000", wantErr: true},
+		{value: ":53", wantErr: true},
+		{value: "8.8.8.8:53:53", wantErr: true},
+		{value: "dns example", wantErr: true},
+		{value: "udp://8.8.8.8", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseResolverAddress(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseResolverAddress(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveHostnameResolverPort(t *testing.T) {
+	dns := newDNSStub(t, multiZone())
+	address, err := ParseResolverAddress(dns.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{Resolver: address}
+	got, err := client.ResolveHostname(context.Background(), "single.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{"192.0.2.9"}) {
+		t.Errorf("got %v, want [192.0.2.9]", got)
+	}
+	if dns.queries.Load() == 0 {
+		t.Error("the resolver on a nonstandard port was not queried")
+	}
+}
+
+func TestMatchesFamily(t *testing.T) {
+	tests := []struct {
+		ip         string
+		ipv4, ipv6 bool
+		want       bool
+	}{
+		{ip: "192.0.2.1", want: true},
+		{ip: "2001:db8::1", want: true},
+		{ip: "192.0.2.1", ipv4: true, want: true},
+		{ip: "::ffff:192.0.2.1", ipv4: true, want: true},
+		{ip: "2001:db8::1", ipv4: true, want: false},
+		{ip: "192.0.2.1", ipv6: true, want: false},
+		{ip: "2001:db8::1", ipv6: true, want: true},
+	}
+	for _, tt := range tests {
+		client := &Client{IPv4Only: tt.ipv4, IPv6Only: tt.ipv6}
+		if got := client.matchesFamily(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("matchesFamily(%s) with IPv4Only %v, IPv6Only %v = %v, want %v", tt.ip, tt.ipv4, tt.ipv6, got, tt.want)
+		}
+	}
+}
+
+func TestResolveHostnameMemoized(t *testing.T) {
+	tests := []struct {
+		name   string
+		cache  bool
+		allIPs bool
+	}{
+		{name: "per client"},
+		{name: "per client, all IPs", allIPs: true},
+		{name: "in Cache", cache: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns := newDNSStub(t, multiZone())
+			client := &Client{Resolver: dns.addr, AllIPs: tt.allIPs}
+			if tt.cache {
+				client.Cache = &Cache{}
+			}
+			first, err := client.ResolveHostname(context.Background(), "multi.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			queries := dns.queries.Load()
+			if queries == 0 {
+				t.Fatal("the resolver was not queried")
+			}
+			for range 3 {
+				got, err := client.ResolveHostname(context.Background(), "multi.test")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(got, first) {
+					t.Errorf("got %v, want the first answer %v", got, first)
+				}
+			}
+			if _, err := client.ResolveHostname(context.Background(), "single.test"); err != nil {
+				t.Fatal(err)
+			}
+			if got := dns.queries.Load(); got != 2*queries {
+				t.Errorf("got %d queries, want %d for each distinct hostname", got, queries)
+			}
+
+			// A fresh client shares the resolutions only through Cache.
+			other := &Client{Resolver: dns.addr, AllIPs: tt.allIPs, Cache: client.Cache}
+			if _, err := other.ResolveHostname(context.Background(), "multi.test"); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := dns.queries.Load() > 2*queries, !tt.cache; got != want {
+				t.Errorf("second client queried the resolver = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResolveHostnameMemoizedAllIPs(t *testing.T) {
+	// The memo holds every address, so the AllIPs setting of each lookup
+	// still applies.
+	dns := newDNSStub(t, multiZone())
+	cache := &Cache{}
+	first := &Client{Resolver: dns.addr, Cache: cache}
+	if got, err := first.ResolveHostname(context.Background(), "multi.test"); err != nil || len(got) != 1 {
+		t.Fatalf("got %v, %v, want one address", got, err)
+	}
+	all := &Client{Resolver: dns.addr, Cache: cache, AllIPs: true}
+	got, err := all.ResolveHostname(context.Background(), "multi.test")
+	if err != nil || len(got) != 3 {
+		t.Errorf("got %v, %v from the cached resolution, want all three addresses", got, err)
+	}
+}
+
+func TestResolveHostnameLogged(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{hostname: "single.test", want: `msg="resolved hostname" hostname=single.test addresses=[192.0.2.9]`},
+		{hostname: "missing.test", want: `msg="resolving hostname failed" hostname=missing.test`},
+	}
+	dns := newDNSStub(t, multiZone())
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			logger, buf := bufferLogger(slog.LevelDebug)
+			client := &Client{Resolver: dns.addr, Logger: logger}
+			client.ResolveHostname(context.Background(), tt.hostname)
+			if got := buf.String(); !strings.Contains(got, tt.want) {
+				t.Errorf("log is missing %q:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func chainZone() dnsZone {
+	zone := dnsZone{}.add(
+		cnameRecord("www.example.test", "edge.cdn.test"),
+		cnameRecord("edge.cdn.test", "origin.cdn.test"),
+		ipRecord("origin.cdn.test", "192.0.2.7"),
+		ipRecord("origin.cdn.test", "2001:db8::7"),
+		ipRecord("plain.test", "192.0.2.8"),
+		cnameRecord("loop-a.test", "loop-b.test"),
+		cnameRecord("loop-b.test", "loop-a.test"),
+	)
+	for i := range maxCNAMEHops + 2 {
+		zone.add(cnameRecord(fmt.Sprintf("hop%d.test", i), fmt.Sprintf("hop%d.test", i+1)))
+	}
+	return zone
+}
+
+func TestLookupCNAMEChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		ipv6     bool
+		want     []string
+		wantErr  string
+	}{
+		{name: "two hops", hostname: "www.example.test", want: []string{"www.example.test", "edge.cdn.test", "origin.cdn.test"}},
+		{name: "two hops over IPv6", hostname: "www.example.test", ipv6: true, want: []string{"www.example.test", "edge.cdn.test", "origin.cdn.test"}},
+		{name: "trailing dot", hostname: "www.example.test.", want: []string{"www.example.test", "edge.cdn.test", "origin.cdn.test"}},
+		{name: "no CNAME", hostname: "plain.test", want: []string{"plain.test"}},
+		{name: "loop", hostname: "loop-a.test", wantErr: "CNAME loop at loop-a.test"},
+		{name: "too many hops", hostname: "hop0.test", wantErr: "exceeds"},
+		{name: "missing", hostname: "missing.test", wantErr: "RCodeNameError"},
+	}
+	resolvers := []struct {
+		name   string
+		client func(t *testing.T) *Client
+	}{
+		{name: "DNS", client: func(t *testing.T) *Client { return &Client{Resolver: newDNSStub(t, chainZone()).addr} }},
+		{name: "DoH", client: func(t *testing.T) *Client { return newDoHStub(t, chainZone()) }},
+	}
+	for _, resolver := range resolvers {
+		t.Run(resolver.name, func(t *testing.T) {
+			client := resolver.client(t)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					client.IPv6Only = tt.ipv6
+					got, err := client.LookupCNAMEChain(context.Background(), tt.hostname)
+					if tt.wantErr != "" {
+						if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+							t.Fatalf("got %q, %v, want error %q", got, err, tt.wantErr)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !slices.Equal(got, tt.want) {
+						t.Errorf("got %q, want %q", got, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestProcessTargetCNAMEChain(t *testing.T) {
+	dns := newDNSStub(t, chainZone())
+	tests := []struct {
+		name    string
+		target  string
+		enabled bool
+		want    []string
+	}{
+		{name: "chain", target: "www.example.test", enabled: true, want: []string{"www.example.test", "edge.cdn.test", "origin.cdn.test", "192.0.2.7"}},
+		{name: "no CNAME", target: "plain.test", enabled: true, want: []string{"plain.test", "192.0.2.8"}},
+		{name: "IP target", target: "192.0.2.8", enabled: true},
+		{name: "disabled", target: "www.example.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stubClient(t, echoShodan, respond(http.StatusOK, "{}"))
+			client.Resolver = dns.addr
+			client.IPv4Only = true
+			client.CNAMEChain = tt.enabled
+			results, err := client.ProcessTarget(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results[0].ResolutionChain; !slices.Equal(got, tt.want) {
+				t.Errorf("got chain %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// useDNSRetryDelay shortens the delay between resolution retries until
+// the test ends.
+func useDNSRetryDelay(t *testing.T) {
+	old := dnsRetryDelay
+	dnsRetryDelay = time.Millisecond
+	t.Cleanup(func() { dnsRetryDelay = old })
+}
+
+func TestResolveHostnameRetries(t *testing.T) {
+	useDNSRetryDelay(t)
+	tests := []struct {
+		name          string
+		hostname      string
+		failures      int32
+		retries       int
+		secondary     bool
+		want          []string
+		wantNotFound  bool
+		wantPrimary   int32
+		wantSecondary int32
+	}{
+		{name: "no failure", hostname: "single.test", retries: 2, want: []string{"192.0.2.9"}, wantPrimary: 2},
+		// Each failed attempt stops at its A query; the last one also asks
+		// for AAAA.
+		{name: "transient failures retried", hostname: "single.test", failures: 2, retries: 2, want: []string{"192.0.2.9"}, wantPrimary: 4},
+		{name: "retries exhausted", hostname: "single.test", failures: 3, retries: 2, wantPrimary: 3},
+		{name: "no retries", hostname: "single.test", failures: 1, wantPrimary: 1},
+		{name: "NXDOMAIN not retried", hostname: "missing.test", retries: 2, wantNotFound: true, wantPrimary: 1},
+		{name: "secondary fallback", hostname: "single.test", failures: 100, retries: 1, secondary: true, want: []string{"192.0.2.9"}, wantPrimary: 2, wantSecondary: 2},
+		{name: "NXDOMAIN not looked up on secondary", hostname: "missing.test", retries: 1, secondary: true, wantNotFound: true, wantPrimary: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, primary := newDoHServer(t, multiZone())
+			primary.failures.Store(tt.failures)
+			_, secondary := newDoHServer(t, multiZone())
+			client := &Client{Resolver: primary.addr, HTTPClient: srv.Client(), DNSRetries: tt.retries}
+			if tt.secondary {
+				client.SecondaryResolver = secondary.addr
+			}
+
+			got, err := client.ResolveHostname(context.Background(), tt.hostname)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				if isNotFound(err) != tt.wantNotFound {
+					t.Errorf("got error %v, want not found %v", err, tt.wantNotFound)
+				}
+			} else if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+			if n := primary.queries.Load(); n != tt.wantPrimary {
+				t.Errorf("got %d queries to the primary resolver, want %d", n, tt.wantPrimary)
+			}
+			if n := secondary.queries.Load(); n != tt.wantSecondary {
+				t.Errorf("got %d queries to the secondary resolver, want %d", n, tt.wantSecondary)
+			}
+		})
+	}
+}
+
+func TestResolveHostnameRetriesDoHHTTP(t *testing.T) {
+	useDNSRetryDelay(t)
+	var requests atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// HTTP retries would multiply the DNS ones.
+	client := &Client{Resolver: srv.URL + "/dns-query", HTTPClient: srv.Client(), Retries: 2, DNSRetries: 2}
+	if got, err := client.ResolveHostname(context.Background(), "single.test"); err == nil {
+		t.Fatalf("got %v, want an error", got)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestResolveHostnameRetriesDNS(t *testing.T) {
+	useDNSRetryDelay(t)
+	tests := []struct {
+		name          string
+		hostname      string
+		failing       bool
+		secondary     bool
+		wantErr       bool
+		wantRetried   bool
+		wantSecondary bool
+	}{
+		{name: "SERVFAIL retried", hostname: "single.test.", failing: true, wantErr: true, wantRetried: true},
+		{name: "NXDOMAIN not retried", hostname: "missing.test.", wantErr: true},
+		{name: "secondary fallback", hostname: "single.test.", failing: true, secondary: true, wantRetried: true, wantSecondary: true},
+		{name: "NXDOMAIN not looked up on secondary", hostname: "missing.test.", secondary: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The queries a single lookup takes, which depend on the
+			// resolver's own attempts, are counted without retries first.
+			queries := func(retries int) (int32, int32, error) {
+				primary, secondary := newDNSStub(t, multiZone()), newDNSStub(t, multiZone())
+				if tt.failing {
+					primary.failures.Store(1000)
+				}
+				client := &Client{Resolver: primary.addr, DNSRetries: retries}
+				if tt.secondary {
+					client.SecondaryResolver = secondary.addr
+				}
+				_, err := client.ResolveHostname(context.Background(), tt.hostname)
+				return primary.queries.Load(), secondary.queries.Load(), err
+			}
+			single, _, _ := queries(0)
+			primary, secondary, err := queries(2)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if retried := primary > single; retried != tt.wantRetried {
+				t.Errorf("got %d queries, %d without retries, want retried %v", primary, single, tt.wantRetried)
+			}
+			if (secondary > 0) != tt.wantSecondary {
+				t.Errorf("got %d queries to the secondary resolver, want used %v", secondary, tt.wantSecondary)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package hostinfo
+
+import (
+	"net/netip"
+)
+
+// ParsePrefix parses an IP address or CIDR range, returning addresses as
+// single-address prefixes.
+func ParsePrefix(value string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), nil
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipIP reports whether ip falls in Exclude or, when Scope is set,
+// outside Scope, or is a bogon with SkipPrivate set, logging a notice when
+// it does. Exclude wins when a range is in both.
+func (c *Client) skipIP(target, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	if prefixesContain(c.Exclude, addr) {
+		c.logger().Warn("skipping excluded IP", "target", target, "ip", ip)
+		return true
+	}
+	if len(c.Scope) > 0 && !prefixesContain(c.Scope, addr) {
+		c.logger().Warn("skipping out-of-scope IP", "target", target, "ip", ip)
+		return true
+	}
+	if c.SkipPrivate && prefixesContain(bogonPrefixes, addr) {
+		c.logger().Info("skipping private IP", "target", target, "ip", ip)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package hostinfo
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "192.0.2.1", want: "192.0.2.1/32"},
+		{value: "2001:db8::1", want: "2001:db8::1/128"},
+		{value: "::ffff:192.0.2.1", want: "192.0.2.1/32"},
+		{value: "192.0.2.0/24", want: "192.0.2.0/24"},
+		{value: "192.0.2.77/24", want: "192.0.2.0/24"},
+		{value: "2001:db8::/32", want: "2001:db8::/32"},
+		{value: "example.com", wantErr: true},
+		{value: "192.0.2.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePrefix(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustPrefixes(values ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(values))
+	for i, value := range values {
+		prefix, err := ParsePrefix(value)
+		if err != nil {
+			panic(err)
+		}
+		prefixes[i] = prefix
+	}
+	return prefixes
+}
+
+// queriedIPs returns a Shodan stub handler and the IPs it was asked about.
+func queriedIPs() (http.HandlerFunc, func() []string) {
+	var mu sync.Mutex
+	var ips []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ips = append(ips, strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Unlock()
+		w.Write([]byte(`{"ports":[443]}`))
+	}
+	return handler, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		sorted := slices.Clone(ips)
+		slices.Sort(sorted)
+		return sorted
+	}
+}
+
+func TestProcessTargetExclude(t *testing.T) {
+	dns := newDNSStub(t, multiZone())
+	tests := []struct {
+		name    string
+		target  string
+		exclude []netip.Prefix
+		want    []string
+		skipped int
+	}{
+		{name: "nothing excluded", target: "multi.test", want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "excluded CIDR", target: "multi.test", exclude: mustPrefixes("192.0.2.0/31"), want: []string{"192.0.2.2", "2001:db8::1"}, skipped: 1},
+		{name: "excluded IPv6 address", target: "multi.test", exclude: mustPrefixes("2001:db8::1"), want: []string{"192.0.2.1", "192.0.2.2"}, skipped: 1},
+		{name: "every address excluded", target: "multi.test", exclude: mustPrefixes("192.0.2.0/24", "2001:db8::/32"), skipped: 3},
+		{name: "excluded IP target", target: "192.0.2.9", exclude: mustPrefixes("192.0.2.0/24"), skipped: 1},
+		{name: "IP target outside the ranges", target: "198.51.100.1", exclude: mustPrefixes("192.0.2.0/24"), want: []string{"198.51.100.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodan, queried := queriedIPs()
+			logger, logs := bufferLogger(slog.LevelWarn)
+			client := stubClient(t, shodan, respond(http.StatusOK, "{}"))
+			client.Resolver, client.AllIPs, client.Exclude, client.Logger = dns.addr, true, tt.exclude, logger
+
+			results, err := client.ProcessTarget(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.IP)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got records for %q, want %q", got, tt.want)
+			}
+			if ips := queried(); !slices.Equal(ips, tt.want) {
+				t.Errorf("Shodan was asked about %q, want %q", ips, tt.want)
+			}
+			if skipped := strings.Count(logs.String(), "skipping excluded IP"); skipped != tt.skipped {
+				t.Errorf("got %d skip notices, want %d:\n%s", skipped, tt.skipped, logs.String())
+			}
+		})
+	}
+}
+
+func TestProcessTargetScope(t *testing.T) {
+	dns := newDNSStub(t, multiZone())
+	tests := []struct {
+		name           string
+		scope          []netip.Prefix
+		exclude        []netip.Prefix
+		want           []string
+		wantOutOfScope int
+		wantExcluded   int
+	}{
+		{name: "no scope", want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "IPv4 range", scope: mustPrefixes("192.0.2.0/24"), want: []string{"192.0.2.1", "192.0.2.2"}, wantOutOfScope: 1},
+		{name: "single address", scope: mustPrefixes("192.0.2.2", "2001:db8::1"), want: []string{"192.0.2.2", "2001:db8::1"}, wantOutOfScope: 1},
+		{name: "nothing in scope", scope: mustPrefixes("198.51.100.0/24"), wantOutOfScope: 3},
+		{
+			name:           "exclude wins",
+			scope:          mustPrefixes("192.0.2.0/24"),
+			exclude:        mustPrefixes("192.0.2.1"),
+			want:           []string{"192.0.2.2"},
+			wantOutOfScope: 1,
+			wantExcluded:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shodan, queried := queriedIPs()
+			logger, logs := bufferLogger(slog.LevelWarn)
+			client := stubClient(t, shodan, respond(http.StatusOK, "{}"))
+			client.Resolver, client.AllIPs, client.Logger = dns.addr, true, logger
+			client.Scope, client.Exclude = tt.scope, tt.exclude
+
+			results, err := client.ProcessTarget(context.Background(), "multi.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.IP)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got records for %q, want %q", got, tt.want)
+			}
+			if ips := queried(); !slices.Equal(ips, tt.want) {
+				t.Errorf("Shodan was asked about %q, want %q", ips, tt.want)
+			}
+			if n := strings.Count(logs.String(), "skipping out-of-scope IP"); n != tt.wantOutOfScope {
+				t.Errorf("got %d out-of-scope notices, want %d:\n%s", n, tt.wantOutOfScope, logs.String())
+			}
+			if n := strings.Count(logs.String(), "skipping excluded IP"); n != tt.wantExcluded {
+				t.Errorf("got %d exclusion notices, want %d:\n%s", n, tt.wantExcluded, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultShodanURL is the InternetDB base URL used when Client.ShodanURL is
+// empty.
+const DefaultShodanURL = "https://internetdb.shodan.io"
+
+// DefaultShodanAPIURL is the Shodan API base URL used when
+// Client.ShodanAPIURL is empty.
+const DefaultShodanAPIURL = "https://api.shodan.io"
+
+// ShodanService is a single service banner from the Shodan host API.
+type ShodanService struct {
+	Port      int        `json:"port" yaml:"port"`
+	Transport string     `json:"transport,omitempty" yaml:"transport,omitempty"`
+	Product   string     `json:"product,omitempty" yaml:"product,omitempty"`
+	Version   string     `json:"version,omitempty" yaml:"version,omitempty"`
+	Banner    string     `json:"banner,omitempty" yaml:"banner,omitempty"`
+	Timestamp string     `json:"timestamp,omitempty" yaml:"timestamp,omitempty"`
+	SSL       *ShodanSSL `json:"ssl,omitempty" yaml:"ssl,omitempty"`
+}
+
+// ShodanSSL is the certificate summary Shodan records for a TLS service.
+type ShodanSSL struct {
+	Subject  string   `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Issuer   string   `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Expires  string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Versions []string `json:"versions,omitempty" yaml:"versions,omitempty"`
+}
+
+// shodanHostResponse is the subset of the Shodan host API answer that is
+// mapped onto ShodanResponse.
+type shodanHostResponse struct {
+	Hostnames  []string `json:"hostnames"`
+	Ports      []int    `json:"ports"`
+	Tags       []string `json:"tags"`
+	Vulns      []Vuln   `json:"vulns"`
+	OS         string   `json:"os"`
+	LastUpdate string   `json:"last_update"`
+	Data       []struct {
+		Port      int      `json:"port"`
+		Transport string   `json:"transport"`
+		Product   string   `json:"product"`
+		Version   string   `json:"version"`
+		Data      string   `json:"data"`
+		Timestamp string   `json:"timestamp"`
+		CPE23     []string `json:"cpe23"`
+		SSL       *struct {
+			Cert struct {
+				Subject map[string]string `json:"subject"`
+				Issuer  map[string]string `json:"issuer"`
+				Expires string            `json:"expires"`
+			} `json:"cert"`
+			Versions []string `json:"versions"`
+		} `json:"ssl"`
+	} `json:"data"`
+}
+
+// FetchShodanData queries internetdb.shodan.io for ip. It returns ErrNoData
+// when Shodan has no record of the address.
+func (c *Client) FetchShodanData(ctx context.Context, ip string) (ShodanResponse, error) {
+	baseURL := c.ShodanURL
+	if baseURL == "" {
+		baseURL = DefaultShodanURL
+	}
+
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderShodan), http.MethodGet, fmt.Sprintf("%s/%s", strings.TrimSuffix(baseURL, "/"), ip), nil)
+	if err != nil {
+		return ShodanResponse{}, err
+	}
+
+	resp, err := c.doWithRetry(req, c.ShodanLimiter)
+	if err != nil {
+		return ShodanResponse{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if err := checkResponse(resp, "internetdb.shodan.io"); err != nil {
+		return ShodanResponse{}, err
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ShodanResponse{}, err
+	}
+	var shodanData ShodanResponse
+	if err := json.Unmarshal(body, &shodanData); err != nil {
+		return ShodanResponse{}, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ShodanResponse{}, err
+	}
+	for name, value := range fields {
+		if slices.Contains(internetDBFields, name) {
+			continue
+		}
+		if shodanData.Extra == nil {
+			shodanData.Extra = map[string]any{}
+		}
+		shodanData.Extra[name] = value
+	}
+
+	return shodanData, nil
+}
+
+// internetDBFields are the InternetDB keys decoded into ShodanResponse,
+// plus the queried ip. Any other key is kept in ShodanResponse.Extra.
+var internetDBFields = []string{"ip", "hostnames", "ports", "cpes", "tags", "vulns"}
+
+// FetchShodanHost queries the full Shodan host API for ip with
+// ShodanAPIKey. Besides what InternetDB reports, the answer carries the
+// service banners, certificate details and last-seen time. It returns
+// ErrNoData when Shodan has no record of the address.
+func (c *Client) FetchShodanHost(ctx context.Context, ip string) (ShodanResponse, error) {
+	baseURL := c.ShodanAPIURL
+	if baseURL == "" {
+		baseURL = DefaultShodanAPIURL
+	}
+
+	endpoint := fmt.Sprintf("%s/shodan/host/%s?key=%s", strings.TrimSuffix(baseURL, "/"), ip, url.QueryEscape(c.ShodanAPIKey))
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderShodan), http.MethodGet, endpoint, nil)
+	if err != nil {
+		return ShodanResponse{}, err
+	}
+
+	resp, err := c.doWithRetry(req, c.ShodanLimiter)
+	if err != nil {
+		return ShodanResponse{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode == http.StatusPaymentRequired {
+		c.noCredits.Store(true)
+		return ShodanResponse{}, fmt.Errorf("api.shodan.io: %w", ErrNoCredits)
+	}
+	if err := checkResponse(resp, "api.shodan.io"); err != nil {
+		return ShodanResponse{}, err
+	}
+
+	var hostData shodanHostResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hostData); err != nil {
+		return ShodanResponse{}, err
+	}
+
+	shodanData := ShodanResponse{
+		Hostnames:  hostData.Hostnames,
+		Ports:      hostData.Ports,
+		Tags:       hostData.Tags,
+		Vulns:      hostData.Vulns,
+		OS:         hostData.OS,
+		LastUpdate: hostData.LastUpdate,
+	}
+	for _, service := range hostData.Data {
+		for _, cpe := range service.CPE23 {
+			if !slices.Contains(shodanData.CPEs, cpe) {
+				shodanData.CPEs = append(shodanData.CPEs, cpe)
+			}
+		}
+
+		entry := ShodanService{
+			Port:      service.Port,
+			Transport: service.Transport,
+			Product:   service.Product,
+			Version:   service.Version,
+			Banner:    service.Data,
+			Timestamp: service.Timestamp,
+		}
+		if service.SSL != nil {
+			entry.SSL = &ShodanSSL{
+				Subject:  service.SSL.Cert.Subject["CN"],
+				Issuer:   service.SSL.Cert.Issuer["CN"],
+				Expires:  service.SSL.Cert.Expires,
+				Versions: service.SSL.Versions,
+			}
+		}
+		shodanData.Services = append(shodanData.Services, entry)
+	}
+	return shodanData, nil
+}
+
+// ShodanCreditsExhausted reports whether the host API has answered that
+// ShodanAPIKey is out of query credits. Records of later IPs then lack
+// Shodan data, with the failure in their Errors.
+func (c *Client) ShodanCreditsExhausted() bool {
+	return c.noCredits.Load()
+}
+
+// ShodanAPIInfo is the plan of a Shodan API key and the credits it has
+// left this month.
+type ShodanAPIInfo struct {
+	Plan         string `json:"plan"`
+	QueryCredits int    `json:"query_credits"`
+	ScanCredits  int    `json:"scan_credits"`
+}
+
+// FetchShodanAPIInfo queries the /api-info endpoint for the plan and
+// remaining credits of ShodanAPIKey. The call itself costs no credits.
+func (c *Client) FetchShodanAPIInfo(ctx context.Context) (ShodanAPIInfo, error) {
+	baseURL := c.ShodanAPIURL
+	if baseURL == "" {
+		baseURL = DefaultShodanAPIURL
+	}
+
+	endpoint := fmt.Sprintf("%s/api-info?key=%s", strings.TrimSuffix(baseURL, "/"), url.QueryEscape(c.ShodanAPIKey))
+	req, err := http.NewRequestWithContext(withProvider(ctx, ProviderShodan), http.MethodGet, endpoint, nil)
+	if err != nil {
+		return ShodanAPIInfo{}, err
+	}
+
+	resp, err := c.doWithRetry(req, c.ShodanLimiter)
+	if err != nil {
+		return ShodanAPIInfo{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	if err := checkResponse(resp, "api.shodan.io"); err != nil {
+		return ShodanAPIInfo{}, err
+	}
+
+	var info ShodanAPIInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return ShodanAPIInfo{}, err
+	}
+	return info, nil
+}
+
+// fetchShodan queries the full host API when ShodanAPIKey is set and
+// InternetDB otherwise, also returning which of the two answered.
+func (c *Client) fetchShodan(ctx context.Context, ip string) (ShodanResponse, string, error) {
+	if c.ShodanAPIKey != "" {
+		shodanData, err := c.FetchShodanHost(ctx, ip)
+		return shodanData, SourceShodan, err
+	}
+	shodanData, err := c.FetchShodanData(ctx, ip)
+	return shodanData, SourceInternetDB, err
+}
@@ -0,0 +1,259 @@
+package hostinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFetchShodanDataURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffix   string
+		wantPath string
+	}{
+		{name: "base", wantPath: "/192.0.2.1"},
+		{name: "trailing slash", suffix: "/", wantPath: "/192.0.2.1"},
+		{name: "mirror path", suffix: "/mirror/internetdb", wantPath: "/mirror/internetdb/192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				respond(http.StatusOK, shodanBody)(w, r)
+			})
+			client := &Client{ShodanURL: srv.URL + tt.suffix}
+			got, err := client.FetchShodanData(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("got request for %s, want %s", gotPath, tt.wantPath)
+			}
+			if !slices.Equal(got.Ports, []int{22, 443}) {
+				t.Errorf("got ports %v", got.Ports)
+			}
+		})
+	}
+}
+
+func TestFetchShodanDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr error
+	}{
+		{name: "unknown IP", handler: respond(http.StatusNotFound, `{"detail":"No information available"}`), wantErr: ErrNoData},
+		{name: "rate limited", handler: respond(http.StatusTooManyRequests, ""), wantErr: ErrRateLimited},
+		{name: "server error", handler: respond(http.StatusInternalServerError, "")},
+		{name: "bad JSON", handler: respond(http.StatusOK, "{")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{ShodanURL: newStub(t, tt.handler).URL}
+			_, err := client.FetchShodanData(context.Background(), "192.0.2.1")
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+const shodanHostBody = `{
+	"ip_str": "192.0.2.1",
+	"hostnames": ["host.example.test"],
+	"ports": [22, 443],
+	"tags": ["cloud"],
+	"vulns": ["CVE-2021-44228"],
+	"os": "Linux",
+	"last_update": "2024-05-01T12:00:00.000000",
+	"data": [
+		{"port": 22, "transport": "tcp", "product": "OpenSSH", "version": "8.9", "data": "SSH-2.0-OpenSSH_8.9", "timestamp": "2024-05-01T11:00:00.000000", "cpe23": ["cpe:2.3:a:openbsd:openssh:8.9"]},
+		{"port": 443, "transport": "tcp", "product": "nginx", "data": "HTTP/1.1 200 OK", "timestamp": "2024-05-01T12:00:00.000000",
+		 "cpe23": ["cpe:2.3:a:f5:nginx", "cpe:2.3:a:openbsd:openssh:8.9"],
+		 "ssl": {"cert": {"subject": {"CN": "example.test"}, "issuer": {"CN": "Example CA"}, "expires": "20250101000000Z"}, "versions": ["TLSv1.2", "TLSv1.3"]}}
+	]
+}`
+
+func TestFetchShodanHost(t *testing.T) {
+	var gotPath, gotKey string
+	srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.URL.Query().Get("key")
+		respond(http.StatusOK, shodanHostBody)(w, r)
+	})
+	client := &Client{ShodanAPIURL: srv.URL, ShodanAPIKey: "k&y"}
+	got, err := client.FetchShodanHost(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/shodan/host/192.0.2.1" || gotKey != "k&y" {
+		t.Errorf("got request for %s with key %q", gotPath, gotKey)
+	}
+
+	if got.OS != "Linux" || got.LastUpdate != "2024-05-01T12:00:00.000000" {
+		t.Errorf("got OS %q and last update %q", got.OS, got.LastUpdate)
+	}
+	if !slices.Equal(got.Ports, []int{22, 443}) || !slices.Equal(got.Hostnames, []string{"host.example.test"}) || !slices.Equal(got.Tags, []string{"cloud"}) {
+		t.Errorf("got ports %v, hostnames %v and tags %v", got.Ports, got.Hostnames, got.Tags)
+	}
+	if len(got.Vulns) != 1 || got.Vulns[0].ID != "CVE-2021-44228" {
+		t.Errorf("got vulns %+v", got.Vulns)
+	}
+	if want := []string{"cpe:2.3:a:openbsd:openssh:8.9", "cpe:2.3:a:f5:nginx"}; !slices.Equal(got.CPEs, want) {
+		t.Errorf("got CPEs %v, want %v", got.CPEs, want)
+	}
+	if len(got.Services) != 2 {
+		t.Fatalf("got %d services, want 2", len(got.Services))
+	}
+	ssh := got.Services[0]
+	if ssh.Port != 22 || ssh.Product != "OpenSSH" || ssh.Version != "8.9" || ssh.Banner != "SSH-2.0-OpenSSH_8.9" || ssh.SSL != nil {
+		t.Errorf("got SSH service %+v", ssh)
+	}
+	https := got.Services[1]
+	want := ShodanSSL{Subject: "example.test", Issuer: "Example CA", Expires: "20250101000000Z", Versions: []string{"TLSv1.2", "TLSv1.3"}}
+	if https.SSL == nil || https.SSL.Subject != want.Subject || https.SSL.Issuer != want.Issuer || https.SSL.Expires != want.Expires || !slices.Equal(https.SSL.Versions, want.Versions) {
+		t.Errorf("got HTTPS certificate %+v, want %+v", https.SSL, want)
+	}
+}
+
+func TestFetchShodanHostErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       error
+		wantNoCredits bool
+	}{
+		{name: "unknown IP", status: http.StatusNotFound, wantErr: ErrNoData},
+		{name: "out of credits", status: http.StatusPaymentRequired, wantErr: ErrNoCredits, wantNoCredits: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{ShodanAPIURL: newStub(t, respond(tt.status, `{"error":"nope"}`)).URL, ShodanAPIKey: "key"}
+			if _, err := client.FetchShodanHost(context.Background(), "192.0.2.1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := client.ShodanCreditsExhausted(); got != tt.wantNoCredits {
+				t.Errorf("got credits exhausted %v, want %v", got, tt.wantNoCredits)
+			}
+		})
+	}
+}
+
+func TestFetchShodanAPIInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    ShodanAPIInfo
+		wantErr bool
+	}{
+		{name: "credits left", status: http.StatusOK, body: `{"plan":"dev","query_credits":42,"scan_credits":5}`, want: ShodanAPIInfo{Plan: "dev", QueryCredits: 42, ScanCredits: 5}},
+		{name: "exhausted", status: http.StatusOK, body: `{"plan":"dev","query_credits":0}`, want: ShodanAPIInfo{Plan: "dev"}},
+		{name: "invalid key", status: http.StatusUnauthorized, body: `{"error":"invalid key"}`, wantErr: true},
+		{name: "malformed", status: http.StatusOK, body: `{"plan":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotKey string
+			srv := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotKey = r.URL.Path, r.URL.Query().Get("key")
+				respond(tt.status, tt.body)(w, r)
+			})
+			client := &Client{ShodanAPIURL: srv.URL + "/", ShodanAPIKey: "k&y"}
+			got, err := client.FetchShodanAPIInfo(context.Background())
+			if gotPath != "/api-info" || gotKey != "k&y" {
+				t.Errorf("got request for %s with key %q", gotPath, gotKey)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTargetShodanAPIKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		wantServices int
+	}{
+		{name: "InternetDB without a key", wantServices: 0},
+		{name: "host API with a key", key: "key", wantServices: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			internetDB, hostAPI := respond(http.StatusOK, shodanBody), respond(http.StatusOK, shodanHostBody)
+			if tt.key == "" {
+				hostAPI = failOnHit(t, "host API")
+			} else {
+				internetDB = failOnHit(t, "InternetDB")
+			}
+			client := stubClient(t, internetDB, respond(http.StatusOK, "{}"))
+			client.HTTPClient.Transport.(stubTransport)["api.shodan.io"] = newStub(t, hostAPI)
+			client.ShodanAPIKey = tt.key
+			results, err := client.ProcessTarget(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(results[0].Services); got != tt.wantServices {
+				t.Errorf("got %d services, want %d", got, tt.wantServices)
+			}
+		})
+	}
+}
+
+func TestFetchShodanDataExtra(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]any
+	}{
+		{name: "known fields only", body: shodanBody},
+		{
+			name: "unknown fields kept",
+			body: `{"ip":"192.0.2.1","ports":[22],"tags":[],"last_seen":"2024-05-01","score":3,"more":{"asn":"AS64500"}}`,
+			want: map[string]any{"last_seen": "2024-05-01", "score": 3.0, "more": map[string]any{"asn": "AS64500"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{ShodanURL: newStub(t, respond(http.StatusOK, tt.body)).URL}
+			got, err := client.FetchShodanData(context.Background(), "192.0.2.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Extra, tt.want) {
+				t.Errorf("got extra %v, want %v", got.Extra, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTargetShodanExtra(t *testing.T) {
+	shodan := respond(http.StatusOK, `{"ip":"192.0.2.1","ports":[22],"last_seen":"2024-05-01"}`)
+	client := stubClient(t, shodan, respond(http.StatusOK, ipinfoBody))
+	results, err := client.ProcessTarget(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(results[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"extra":{"last_seen":"2024-05-01"}`; !strings.Contains(string(data), want) {
+		t.Errorf("got %s, want it to contain %s", data, want)
+	}
+}
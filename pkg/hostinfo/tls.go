@@ -0,0 +1,86 @@
+package hostinfo
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultTLSTimeout bounds each TLS handshake when Client.TLSTimeout is
+// zero.
+const DefaultTLSTimeout = 5 * time.Second
+
+// tlsPorts are the ports that usually speak TLS right after connecting.
+var tlsPorts = []int{443, 465, 636, 853, 989, 990, 993, 995, 5061, 6443, 8443, 9443}
+
+// TLSInfo describes the leaf certificate presented on a port.
+type TLSInfo struct {
+	Port      int       `json:"port" yaml:"port"`
+	Subject   string    `json:"subject" yaml:"subject"`
+	Issuer    string    `json:"issuer" yaml:"issuer"`
+	SANs      []string  `json:"sans,omitempty" yaml:"sans,omitempty"`
+	NotBefore time.Time `json:"not_before" yaml:"not_before"`
+	NotAfter  time.Time `json:"not_after" yaml:"not_after"`
+}
+
+// InspectTLS performs a TLS handshake with ip:port and returns the details of
+// the leaf certificate. The certificate is not verified, so self-signed and
+// expired certificates are reported as well. serverName is sent as SNI when
+// not empty.
+func (c *Client) InspectTLS(ctx context.Context, ip string, port int, serverName string) (*TLSInfo, error) {
+	timeout := c.TLSTimeout
+	if timeout <= 0 {
+		timeout = DefaultTLSTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+
+	leaf := certs[0]
+	info := &TLSInfo{
+		Port:      port,
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		SANs:      slices.Clone(leaf.DNSNames),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+	}
+	for _, ip := range leaf.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	return info, nil
+}
+
+// inspectTLSPorts inspects every TLS port Shodan reports open on ip,
+// skipping the ports where the handshake fails.
+func (c *Client) inspectTLSPorts(ctx context.Context, ip string, ports []int, serverName string) []TLSInfo {
+	var infos []TLSInfo
+	for _, port := range ports {
+		if !slices.Contains(tlsPorts, port) {
+			continue
+		}
+		info, err := c.InspectTLS(ctx, ip, port, serverName)
+		if err != nil || info == nil {
+			continue
+		}
+		infos = append(infos, *info)
+	}
+	return infos
+}
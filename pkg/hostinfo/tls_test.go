@@ -0,0 +1,154 @@
+package hostinfo
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// selfSignedCert returns a certificate for example.test, valid from
+// notBefore for a day.
+func selfSignedCert(t *testing.T, notBefore time.Time) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.test", Organization: []string{"Example"}},
+		DNSNames:     []string{"example.test", "www.example.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsPort serves TLS with cert on a local port until the test ends, and
+// reports the server name each client sent.
+func tlsPort(t *testing.T, cert tls.Certificate) (int, <-chan string) {
+	t.Helper()
+	serverNames := make(chan string, 10)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverNames <- hello.ServerName
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, serverNames
+}
+
+// silentTCPPort accepts connections on a local port and never answers.
+func silentTCPPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestInspectTLS(t *testing.T) {
+	// An expired certificate is reported like any other.
+	notBefore := time.Now().Add(-48 * time.Hour).Truncate(time.Second).UTC()
+	port, serverNames := tlsPort(t, selfSignedCert(t, notBefore))
+
+	tests := []struct {
+		name       string
+		serverName string
+	}{
+		{name: "no SNI"},
+		{name: "SNI", serverName: "www.example.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{TLSTimeout: time.Second}
+			got, err := client.InspectTLS(context.Background(), "127.0.0.1", port, tt.serverName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Port != port || got.Subject != "CN=example.test,O=Example" || got.Issuer != got.Subject {
+				t.Errorf("got port %d, subject %q and issuer %q", got.Port, got.Subject, got.Issuer)
+			}
+			if want := []string{"example.test", "www.example.test", "127.0.0.1"}; !slices.Equal(got.SANs, want) {
+				t.Errorf("got SANs %v, want %v", got.SANs, want)
+			}
+			if !got.NotBefore.Equal(notBefore) || !got.NotAfter.Equal(notBefore.Add(24*time.Hour)) {
+				t.Errorf("got validity %s to %s", got.NotBefore, got.NotAfter)
+			}
+			if sni := <-serverNames; sni != tt.serverName {
+				t.Errorf("server got SNI %q, want %q", sni, tt.serverName)
+			}
+		})
+	}
+}
+
+func TestInspectTLSFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		port int
+	}{
+		{name: "closed port", port: closedTCPPort(t)},
+		{name: "not TLS", port: openTCPPort(t)},
+		{name: "handshake timeout", port: silentTCPPort(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{TLSTimeout: 100 * time.Millisecond}
+			start := time.Now()
+			if got, err := client.InspectTLS(context.Background(), "127.0.0.1", tt.port, ""); err == nil {
+				t.Errorf("got %+v, want an error", got)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("handshake took %s despite the timeout", elapsed)
+			}
+		})
+	}
+}
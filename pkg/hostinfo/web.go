@@ -0,0 +1,203 @@
+package hostinfo
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPGrabTimeout bounds each web request of HTTPGrab when
+// Client.HTTPGrabTimeout is zero.
+const DefaultHTTPGrabTimeout = 5 * time.Second
+
+// maxGrabRedirects is the number of same-host redirects followed when
+// grabbing a page.
+const maxGrabRedirects = 3
+
+// maxGrabBody is the number of body bytes searched for the page title.
+const maxGrabBody = 256 << 10
+
+// webPorts are the ports grabbed by HTTPGrab, and httpsPorts those of them
+// spoken to over TLS.
+var (
+	webPorts   = []int{80, 443, 8000, 8080, 8443, 8888}
+	httpsPorts = []int{443, 8443}
+)
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// WebInfo describes the root page served on a web port.
+type WebInfo struct {
+	URL        string `json:"url" yaml:"url"`
+	StatusCode int    `json:"status_code" yaml:"status_code"`
+	Title      string `json:"title,omitempty" yaml:"title,omitempty"`
+	Server     string `json:"server,omitempty" yaml:"server,omitempty"`
+
+	FaviconHash *int32 `json:"favicon_hash,omitempty" yaml:"favicon_hash,omitempty"`
+}
+
+// grabIPKey carries the grabTarget of a grab request.
+type grabIPKey struct{}
+
+// grabTarget is the IP a grab request must connect to, whatever host its
+// URL names, and the host:port the URL names.
+type grabTarget struct {
+	ip      string
+	address string
+}
+
+// GrabHTTP fetches the root page of ip:port and returns its status, title
+// and Server header. host, when not empty, is sent as the Host header and
+// SNI so virtual hosts answer as they would for the hostname. Up to
+// maxGrabRedirects redirects on the same host are followed. Certificates
+// are not verified.
+func (c *Client) GrabHTTP(ctx context.Context, ip string, port int, host string) (*WebInfo, error) {
+	resp, err := c.grab(ctx, ip, port, host, "/")
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(resp.Body)
+
+	info := &WebInfo{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Server:     resp.Header.Get("Server"),
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGrabBody))
+	if err != nil && len(body) == 0 {
+		return info, nil
+	}
+	if match := titlePattern.FindSubmatch(body); match != nil {
+		info.Title = strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	}
+	return info, nil
+}
+
+// grab sends a GET for path to ip:port, bounded by HTTPGrabTimeout.
+func (c *Client) grab(ctx context.Context, ip string, port int, host, path string) (*http.Response, error) {
+	timeout := c.HTTPGrabTimeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPGrabTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	scheme := "http"
+	if slices.Contains(httpsPorts, port) {
+		scheme = "https"
+	}
+	if host == "" {
+		host = ip
+	}
+	endpoint := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)), path)
+
+	target := grabTarget{ip: ip, address: net.JoinHostPort(host, strconv.Itoa(port))}
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, grabIPKey{}, target), http.MethodGet, endpoint, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := c.do(c.grabClient(), req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of a request once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// grabClient returns the HTTP client used to grab web ports. It uses the
+// proxy settings of HTTPClient when it has an *http.Transport, skips
+// certificate verification and keeps no idle connections. Direct
+// connections go to the IP being grabbed; through a proxy, the proxy
+// resolves the host itself.
+func (c *Client) grabClient() *http.Client {
+	c.grabOnce.Do(func() {
+		transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if base, ok := c.httpClient().Transport.(*http.Transport); ok {
+			transport = base.Clone()
+		}
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		transport.DisableKeepAlives = true
+		dialer := &net.Dialer{}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			// The transport dials the proxy rather than the target when
+			// one is set, and that connection must be left alone.
+			if target, ok := ctx.Value(grabIPKey{}).(grabTarget); ok && strings.EqualFold(address, target.address) {
+				_, port, err := net.SplitHostPort(address)
+				if err != nil {
+					return nil, err
+				}
+				address = net.JoinHostPort(target.ip, port)
+			}
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		c.grabHTTPClient = &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxGrabRedirects {
+					return http.ErrUseLastResponse
+				}
+				if req.URL.Host != via[0].URL.Host {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		}
+	})
+	return c.grabHTTPClient
+}
+
+// grabWebPorts grabs every web port Shodan reports on ip, skipping those
+// that don't answer, and hashes their favicons when FaviconHash is set.
+func (c *Client) grabWebPorts(ctx context.Context, ip string, ports []int, host string) map[int]WebInfo {
+	var web map[int]WebInfo
+	for _, port := range ports {
+		if !slices.Contains(webPorts, port) {
+			continue
+		}
+		info, err := c.GrabHTTP(ctx, ip, port, host)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				c.logger().Debug("grabbing web port failed", "ip", ip, "port", port, "err", err)
+			}
+			continue
+		}
+		if c.FaviconHash {
+			hash, ok, err := c.grabFavicon(ctx, ip, port, host)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				c.logger().Debug("grabbing favicon failed", "ip", ip, "port", port, "err", err)
+			}
+			if ok {
+				info.FaviconHash = &hash
+			}
+		}
+		if web == nil {
+			web = map[int]WebInfo{}
+		}
+		web[port] = *info
+	}
+	return web
+}
@@ -0,0 +1,140 @@
+package hostinfo
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGrabHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    WebInfo
+	}{
+		{
+			name: "title and server",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Server", "nginx")
+				w.Write([]byte("<html><head><TITLE>\n  Hello &amp;\n World </TITLE></head></html>"))
+			},
+			want: WebInfo{StatusCode: http.StatusOK, Title: "Hello & World", Server: "nginx"},
+		},
+		{
+			name:    "no title",
+			handler: respond(http.StatusNotFound, "{}"),
+			want:    WebInfo{StatusCode: http.StatusNotFound},
+		},
+		{
+			name: "same-host redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					http.Redirect(w, r, "/login", http.StatusFound)
+					return
+				}
+				w.Write([]byte("<title>Login</title>"))
+			},
+			want: WebInfo{StatusCode: http.StatusOK, Title: "Login"},
+		},
+		{
+			name: "other-host redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://elsewhere.test/", http.StatusFound)
+			},
+			want: WebInfo{StatusCode: http.StatusFound},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := stubPort(t, newStub(t, tt.handler))
+			client := &Client{}
+			got, err := client.GrabHTTP(context.Background(), "127.0.0.1", port, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.URL = ""
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrabHTTPConnections(t *testing.T) {
+	// requests holds the Host header seen by the target, or the absolute
+	// URL seen by the proxy.
+	var mu sync.Mutex
+	var requests []string
+	record := func(value string) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, value)
+	}
+	target := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		record("target " + r.Host)
+		w.Write([]byte("<title>direct</title>"))
+	})
+	proxy := newStub(t, func(w http.ResponseWriter, r *http.Request) {
+		record("proxy " + r.URL.String())
+		w.Write([]byte("<title>proxied</title>"))
+	})
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetPort := stubPort(t, target)
+
+	tests := []struct {
+		name      string
+		proxy     bool
+		ip        string
+		port      int
+		wantTitle string
+		want      string
+	}{
+		{
+			name:      "direct connections go to the grabbed IP",
+			ip:        "127.0.0.1",
+			port:      targetPort,
+			wantTitle: "direct",
+			want:      "target example.test:" + strconv.Itoa(targetPort),
+		},
+		{
+			// Nothing answers on 192.0.2.1, so dialing it instead of the
+			// proxy fails.
+			name:      "proxied connections go to the proxy",
+			proxy:     true,
+			ip:        "192.0.2.1",
+			port:      80,
+			wantTitle: "proxied",
+			want:      "proxy http://example.test:80/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			transport := &http.Transport{}
+			if tt.proxy {
+				transport.Proxy = http.ProxyURL(proxyURL)
+			}
+			client := &Client{
+				HTTPClient:      &http.Client{Transport: transport},
+				HTTPGrabTimeout: 2 * time.Second,
+			}
+			info, err := client.GrabHTTP(context.Background(), tt.ip, tt.port, "example.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Title != tt.wantTitle {
+				t.Errorf("got title %q, want %q", info.Title, tt.wantTitle)
+			}
+			if len(requests) != 1 || requests[0] != tt.want {
+				t.Errorf("got requests %q, want %q", requests, tt.want)
+			}
+		})
+	}
+}
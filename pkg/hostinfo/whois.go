@@ -0,0 +1,185 @@
+package hostinfo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DefaultWhoisServer is the root server WHOIS queries start from.
+	DefaultWhoisServer = "whois.iana.org:43"
+
+	whoisTimeout  = 10 * time.Second
+	whoisMaxHops  = 4
+	whoisMaxBytes = 1 << 20
+)
+
+// WhoisInfo holds the registration details parsed from a WHOIS response,
+// along with the raw text of the most specific server queried.
+type WhoisInfo struct {
+	Server       string `json:"server" yaml:"server"`
+	Registrar    string `json:"registrar,omitempty" yaml:"registrar,omitempty"`
+	Organization string `json:"organization,omitempty" yaml:"organization,omitempty"`
+	NetRange     string `json:"net_range,omitempty" yaml:"net_range,omitempty"`
+	Created      string `json:"created,omitempty" yaml:"created,omitempty"`
+	Expires      string `json:"expires,omitempty" yaml:"expires,omitempty"`
+	AbuseEmail   string `json:"abuse_email,omitempty" yaml:"abuse_email,omitempty"`
+	Raw          string `json:"raw" yaml:"raw"`
+}
+
+// whoisFields maps lowercased WHOIS keys from the RIRs and the common
+// registry formats onto WhoisInfo fields.
+var whoisFields = map[string]func(*WhoisInfo) *string{
+	"registrar":                              func(w *WhoisInfo) *string { return &w.Registrar },
+	"orgname":                                func(w *WhoisInfo) *string { return &w.Organization },
+	"org-name":                               func(w *WhoisInfo) *string { return &w.Organization },
+	"organization":                           func(w *WhoisInfo) *string { return &w.Organization },
+	"registrant organization":                func(w *WhoisInfo) *string { return &w.Organization },
+	"owner":                                  func(w *WhoisInfo) *string { return &w.Organization },
+	"netrange":                               func(w *WhoisInfo) *string { return &w.NetRange },
+	"inetnum":                                func(w *WhoisInfo) *string { return &w.NetRange },
+	"inet6num":                               func(w *WhoisInfo) *string { return &w.NetRange },
+	"creation date":                          func(w *WhoisInfo) *string { return &w.Created },
+	"created":                                func(w *WhoisInfo) *string { return &w.Created },
+	"regdate":                                func(w *WhoisInfo) *string { return &w.Created },
+	"registry expiry date":                   func(w *WhoisInfo) *string { return &w.Expires },
+	"registrar registration expiration date": func(w *WhoisInfo) *string { return &w.Expires },
+	"expiry date":                            func(w *WhoisInfo) *string { return &w.Expires },
+	"orgabuseemail":                          func(w *WhoisInfo) *string { return &w.AbuseEmail },
+	"abuse-mailbox":                          func(w *WhoisInfo) *string { return &w.AbuseEmail },
+	"registrar abuse contact email":          func(w *WhoisInfo) *string { return &w.AbuseEmail },
+}
+
+// whoisReferralKeys name the fields that point to a more specific server.
+var whoisReferralKeys = []string{"refer", "whois", "referralserver", "registrar whois server"}
+
+func (c *Client) whoisQuery(ctx context.Context, server, query string) (string, error) {
+	dialer := &net.Dialer{Timeout: whoisTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(whoisTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", query); err != nil {
+		return "", err
+	}
+	raw, err := io.ReadAll(io.LimitReader(conn, whoisMaxBytes))
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func splitWhoisLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "%") || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", false
+	}
+	return strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value), true
+}
+
+// whoisReferral returns the host:port of the server a response refers to,
+// or an empty string when there is none.
+func whoisReferral(raw string) string {
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		key, value, ok := splitWhoisLine(scanner.Text())
+		if !ok || value == "" || !slices.Contains(whoisReferralKeys, key) {
+			continue
+		}
+		if strings.Contains(value, "://") && !strings.HasPrefix(value, "whois://") {
+			continue
+		}
+
+		server := strings.TrimSuffix(strings.TrimPrefix(value, "whois://"), "/")
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "43")
+		}
+		return server
+	}
+	return ""
+}
+
+// parseWhois fills in the fields of info that raw provides. Fields already
+// set by a less specific server are overwritten.
+func parseWhois(info *WhoisInfo, raw string) {
+	parsed := WhoisInfo{}
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		key, value, ok := splitWhoisLine(scanner.Text())
+		if !ok || value == "" {
+			continue
+		}
+		if field, ok := whoisFields[key]; ok && *field(&parsed) == "" {
+			*field(&parsed) = value
+		}
+	}
+
+	for _, field := range whoisFields {
+		if value := *field(&parsed); value != "" {
+			*field(info) = value
+		}
+	}
+}
+
+// LookupWhois queries WHOIS for an IP address or domain, following
+// referrals from the root server down to the RIR or registrar. Hostnames
+// are reduced to their registered domain first.
+func (c *Client) LookupWhois(ctx context.Context, target string) (*WhoisInfo, error) {
+	query := target
+	if net.ParseIP(target) == nil {
+		domain, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(target, "."))
+		if err != nil {
+			return nil, err
+		}
+		query = domain
+	}
+
+	server := c.WhoisServer
+	if server == "" {
+		server = DefaultWhoisServer
+	}
+
+	info := &WhoisInfo{}
+	visited := map[string]bool{}
+	for range whoisMaxHops {
+		raw, err := c.whoisQuery(ctx, server, query)
+		if err != nil {
+			if info.Raw != "" {
+				break
+			}
+			return nil, err
+		}
+		visited[server] = true
+
+		info.Server = server
+		info.Raw = raw
+		parseWhois(info, raw)
+
+		next := whoisReferral(raw)
+		if next == "" || visited[next] {
+			break
+		}
+		server = next
+	}
+	return info, nil
+}
@@ -0,0 +1,224 @@
+package hostinfo
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// whoisStub is a WHOIS server on 127.0.0.1 answering each query with
+// answer(query), recording the queries it receives.
+type whoisStub struct {
+	addr    string
+	mu      sync.Mutex
+	queries []string
+}
+
+func newWhoisStub(t *testing.T, answer func(query string) string) *whoisStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &whoisStub{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				query, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				query = strings.TrimSpace(query)
+				stub.mu.Lock()
+				stub.queries = append(stub.queries, query)
+				stub.mu.Unlock()
+				conn.Write([]byte(answer(query)))
+			}()
+		}
+	}()
+	return stub
+}
+
+func (s *whoisStub) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func whoisAnswer(raw string) func(string) string {
+	return func(string) string { return raw }
+}
+
+const (
+	arinWhois = `# ARIN WHOIS data
+NetRange:       192.0.2.0 - 192.0.2.255
+OrgName:        Example Networks
+RegDate:        2010-01-01
+OrgAbuseEmail:  abuse@example.net
+`
+	registrarWhois = `Domain Name: EXAMPLE.COM
+Registrar: Example Registrar, Inc.
+Creation Date: 1995-08-14T04:00:00Z
+Registrar Registration Expiration Date: 2030-08-13T04:00:00Z
+Registrar Abuse Contact Email: abuse@registrar.example
+`
+)
+
+func TestParseWhois(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want WhoisInfo
+	}{
+		{
+			name: "ARIN",
+			raw:  arinWhois,
+			want: WhoisInfo{NetRange: "192.0.2.0 - 192.0.2.255", Organization: "Example Networks", Created: "2010-01-01", AbuseEmail: "abuse@example.net"},
+		},
+		{
+			name: "RIPE",
+			raw:  "% RIPE database\ninetnum:        192.0.2.0 - 192.0.2.255\norg-name:       Example BV\nabuse-mailbox:  abuse@example.nl\ncreated:        2012-03-04T10:00:00Z\norg-name:       Second Org\n",
+			want: WhoisInfo{NetRange: "192.0.2.0 - 192.0.2.255", Organization: "Example BV", Created: "2012-03-04T10:00:00Z", AbuseEmail: "abuse@example.nl"},
+		},
+		{
+			name: "registrar",
+			raw:  registrarWhois,
+			want: WhoisInfo{Registrar: "Example Registrar, Inc.", Created: "1995-08-14T04:00:00Z", Expires: "2030-08-13T04:00:00Z", AbuseEmail: "abuse@registrar.example"},
+		},
+		{name: "comments and blanks", raw: "% Registrar: commented\n\n# OrgName: commented\nOrgName:\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got WhoisInfo
+			parseWhois(&got, tt.raw)
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhoisReferral(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "refer:        whois.arin.net\n", want: "whois.arin.net:43"},
+		{raw: "whois:        whois.verisign-grs.com\n", want: "whois.verisign-grs.com:43"},
+		{raw: "ReferralServer:  whois://whois.ripe.net\n", want: "whois.ripe.net:43"},
+		{raw: "ReferralServer:  rwhois://rwhois.example.net:4321\n"},
+		{raw: "Registrar WHOIS Server: whois.registrar.example\n", want: "whois.registrar.example:43"},
+		{raw: "refer: 127.0.0.1:4343\n", want: "127.0.0.1:4343"},
+		{raw: "% refer: whois.arin.net\n"},
+		{raw: arinWhois},
+	}
+	for _, tt := range tests {
+		if got := whoisReferral(tt.raw); got != tt.want {
+			t.Errorf("whoisReferral(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLookupWhois(t *testing.T) {
+	arin := newWhoisStub(t, whoisAnswer(arinWhois))
+	registrar := newWhoisStub(t, whoisAnswer(registrarWhois))
+	registry := newWhoisStub(t, whoisAnswer("Domain Name: EXAMPLE.COM\nCreation Date: 1990-01-01T00:00:00Z\nRegistrar WHOIS Server: "+registrar.addr+"\n"))
+	root := newWhoisStub(t, func(query string) string {
+		if net.ParseIP(query) != nil {
+			return "refer: " + arin.addr + "\n"
+		}
+		return "refer: " + registry.addr + "\n"
+	})
+
+	tests := []struct {
+		name       string
+		target     string
+		wantQuery  string
+		wantServer string
+		want       WhoisInfo
+	}{
+		{
+			name: "IP", target: "192.0.2.1", wantQuery: "192.0.2.1", wantServer: arin.addr,
+			want: WhoisInfo{NetRange: "192.0.2.0 - 192.0.2.255", Organization: "Example Networks", Created: "2010-01-01", AbuseEmail: "abuse@example.net"},
+		},
+		{
+			name: "domain", target: "www.example.com.", wantQuery: "example.com", wantServer: registrar.addr,
+			want: WhoisInfo{Registrar: "Example Registrar, Inc.", Created: "1995-08-14T04:00:00Z", Expires: "2030-08-13T04:00:00Z", AbuseEmail: "abuse@registrar.example"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{WhoisServer: root.addr}
+			got, err := client.LookupWhois(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Server != tt.wantServer || got.Raw == "" {
+				t.Errorf("got server %q and raw %q, want the response of %s", got.Server, got.Raw, tt.wantServer)
+			}
+			parsed := *got
+			parsed.Server, parsed.Raw = "", ""
+			if parsed != tt.want {
+				t.Errorf("got %+v, want %+v", parsed, tt.want)
+			}
+			if queries := root.received(); queries[len(queries)-1] != tt.wantQuery {
+				t.Errorf("root server got query %q, want %q", queries[len(queries)-1], tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestLookupWhoisFailures(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	var loop *whoisStub
+	loop = newWhoisStub(t, func(string) string { return "OrgName: Loop\nrefer: " + loop.addr + "\n" })
+	broken := newWhoisStub(t, whoisAnswer("OrgName: Root Only\nrefer: "+closedAddr+"\n"))
+
+	tests := []struct {
+		name    string
+		server  string
+		wantOrg string
+		wantErr bool
+	}{
+		{name: "referral loop", server: loop.addr, wantOrg: "Loop"},
+		{name: "unreachable referral", server: broken.addr, wantOrg: "Root Only"},
+		{name: "unreachable server", server: closedAddr, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{WhoisServer: tt.server}
+			got, err := client.LookupWhois(context.Background(), "192.0.2.1")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Organization != tt.wantOrg {
+				t.Errorf("got organization %q, want %q", got.Organization, tt.wantOrg)
+			}
+		})
+	}
+	if n := len(loop.received()); n != 1 {
+		t.Errorf("looping server got %d queries, want 1", n)
+	}
+}
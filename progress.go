@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressInterval is how often -progress redraws its counter.
+var progressInterval = time.Second
+
+// progressReporter periodically prints how many targets have been processed.
+// On a terminal it redraws a single line; otherwise it prints one line per
+// tick. A nil *progressReporter is a no-op.
+type progressReporter struct {
+	w         io.Writer
+	total     int
+	redraw    bool
+	processed atomic.Int64
+	errors    atomic.Int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// newProgressReporter returns a reporter for total targets, or an unknown
+// number when total is zero, writing to stderr, or nil when -progress is
+// off or stderr isn't a terminal and -progress-force isn't set.
+func newProgressReporter(total int) *progressReporter {
+	terminal := isTerminal(os.Stderr)
+	if !argProgressForce && (!argProgress || !terminal) {
+		return nil
+	}
+	return &progressReporter{w: os.Stderr, total: total, redraw: terminal}
+}
+
+func (p *progressReporter) Start() {
+	if p == nil {
+		return
+	}
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Add records a finished target.
+func (p *progressReporter) Add(failed bool) {
+	if p == nil {
+		return
+	}
+	p.processed.Add(1)
+	if failed {
+		p.errors.Add(1)
+	}
+}
+
+// Stop prints the final count and ends the line.
+func (p *progressReporter) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+	p.print()
+	if p.redraw {
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progressReporter) print() {
+	line := fmt.Sprintf("processed %d/%d, errors %d", p.processed.Load(), p.total, p.errors.Load())
+	if p.total == 0 {
+		// -stream doesn't know how many targets are coming.
+		line = fmt.Sprintf("processed %d, errors %d", p.processed.Load(), p.errors.Load())
+	}
+	if p.redraw {
+		fmt.Fprintf(p.w, "\r\033[K%s", line)
+		return
+	}
+	fmt.Fprintln(p.w, line)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a strings.Builder safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProgressReporterPrint(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  int
+		redraw bool
+		want   string
+	}{
+		{name: "lines", total: 10, want: "processed 3/10, errors 1\n"},
+		{name: "redraw", total: 10, redraw: true, want: "\r\033[Kprocessed 3/10, errors 1"},
+		{name: "unknown total", want: "processed 3, errors 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			p := &progressReporter{w: &out, total: tt.total, redraw: tt.redraw}
+			p.Add(false)
+			p.Add(true)
+			p.Add(false)
+			p.print()
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressReporterTicks(t *testing.T) {
+	setArg(t, &progressInterval, 10*time.Millisecond)
+	var out syncBuffer
+	p := &progressReporter{w: &out, total: 4}
+	p.Start()
+	p.Add(false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "\n") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %q after 5s, want a line per tick", out.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.Add(true)
+	p.Stop()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if lines[0] != "processed 1/4, errors 0" {
+		t.Errorf("got first line %q", lines[0])
+	}
+	if last := lines[len(lines)-1]; last != "processed 2/4, errors 1" {
+		t.Errorf("got final line %q, want the count at Stop", last)
+	}
+	before := out.String()
+	time.Sleep(30 * time.Millisecond)
+	if out.String() != before {
+		t.Error("progress kept printing after Stop")
+	}
+}
+
+func TestProgressReporterNil(t *testing.T) {
+	var p *progressReporter
+	p.Start()
+	p.Add(true)
+	p.Stop()
+}
+
+func TestProgressFlags(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1"}`)
+	ipinfo, _ := countingStub(t, "{}")
+	tests := []struct {
+		name string
+		flag string
+		want bool
+	}{
+		{name: "off", want: false},
+		{name: "-progress without a terminal", flag: "-progress", want: false},
+		{name: "-progress-force", flag: "-progress-force", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "-log-level", "error", "192.0.2.1"}
+			if tt.flag != "" {
+				args = append([]string{tt.flag}, args...)
+			}
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if got := strings.Contains(stderr, "processed 1/1, errors 0"); got != tt.want {
+				t.Errorf("progress shown = %v, want %v; stderr:\n%s", got, tt.want, stderr)
+			}
+			if strings.Contains(stdout, "processed") {
+				t.Errorf("progress written to stdout: %q", stdout)
+			}
+		})
+	}
+}
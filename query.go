@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// queryPath holds the parsed -q value.
+var queryPath []string
+
+// parseQuery parses a -q expression such as .ports or .whois.registrar
+// into its keys. The first key is checked against the keys of
+// hostinfo.CombinedResponse; "." alone selects the whole record.
+func parseQuery(expr string) ([]string, error) {
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("%q must start with '.'", expr)
+	}
+	if expr == "." {
+		return []string{}, nil
+	}
+
+	path := strings.Split(expr[1:], ".")
+	for _, key := range path {
+		if key == "" {
+			return nil, fmt.Errorf("%q has an empty key", expr)
+		}
+	}
+	known := jsonFieldNames(reflect.TypeFor[hostinfo.CombinedResponse]())
+	if !slices.Contains(known, path[0]) {
+		return nil, fmt.Errorf("unknown field %q (valid fields: %s)", path[0], strings.Join(known, ", "))
+	}
+	return path, nil
+}
+
+// queryResultWriter prints the value -q selects from each record as raw
+// text, one line per value. Arrays are flattened to one line per element,
+// and keys after an array apply to each of its elements, so .vulns.id
+// lists every CVE ID. Records without the field print nothing.
+type queryResultWriter struct {
+	w    io.Writer
+	path []string
+}
+
+func (qw *queryResultWriter) WriteResult(combined hostinfo.CombinedResponse) error {
+	jsonData, err := json.Marshal(combined)
+	if err != nil {
+		return err
+	}
+	if len(qw.path) == 0 {
+		_, err := fmt.Fprintln(qw.w, string(jsonData))
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	var record any
+	if err := decoder.Decode(&record); err != nil {
+		return err
+	}
+
+	var lines strings.Builder
+	for _, value := range queryValues(record, qw.path) {
+		switch value := value.(type) {
+		case nil:
+			continue
+		case string:
+			lines.WriteString(value)
+		case json.Number:
+			lines.WriteString(value.String())
+		case bool:
+			fmt.Fprint(&lines, value)
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			lines.Write(encoded)
+		}
+		lines.WriteByte('\n')
+	}
+	_, err = io.WriteString(qw.w, lines.String())
+	return err
+}
+
+// WriteError is never called, since run rejects -errors-inline with -q and -only-ip.
+func (qw *queryResultWriter) WriteError(target string, err error) error {
+	return nil
+}
+
+func (qw *queryResultWriter) Close() error {
+	return nil
+}
+
+// queryValues walks path through a decoded JSON value.
+func queryValues(value any, path []string) []any {
+	if array, ok := value.([]any); ok {
+		var values []any
+		for _, element := range array {
+			values = append(values, queryValues(element, path)...)
+		}
+		return values
+	}
+	if len(path) == 0 {
+		return []any{value}
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	field, ok := object[path[0]]
+	if !ok {
+		return nil
+	}
+	return queryValues(field, path[1:])
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []string
+		wantErr string
+	}{
+		{expr: ".", want: []string{}},
+		{expr: ".ip", want: []string{"ip"}},
+		{expr: ".whois.registrar", want: []string{"whois", "registrar"}},
+		{expr: "ip", wantErr: "must start with '.'"},
+		{expr: ".whois.", wantErr: "has an empty key"},
+		{expr: "..ip", wantErr: "has an empty key"},
+		{expr: ".address", wantErr: `unknown field "address"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseQuery(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) || got == nil {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryResultWriter(t *testing.T) {
+	record := sampleRecord()
+	record.Latitude = 37.4056
+	record.Vulns = []hostinfo.Vuln{
+		{ID: "CVE-2021-44228", CVSS: 10, Severity: "CRITICAL"},
+		{ID: "CVE-2023-0001", CVSS: 5.3, Severity: "MEDIUM"},
+	}
+	record.Whois = &hostinfo.WhoisInfo{Server: "whois.example", Registrar: "Example Registrar"}
+	record.PortStatus = []hostinfo.PortStatus{{Port: 22, Status: hostinfo.PortOpen}}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: ".ip", want: "192.0.2.1\n"},
+		{expr: ".ports", want: "22\n443\n"},
+		{expr: ".latitude", want: "37.4056\n"},
+		{expr: ".hostnames", want: "a.example.test\nb.example.test\n"},
+		{expr: ".whois.registrar", want: "Example Registrar\n"},
+		{expr: ".vulns.id", want: "CVE-2021-44228\nCVE-2023-0001\n"},
+		{expr: ".port_status", want: `{"port":22,"status":"open"}` + "\n"},
+		{expr: ".whois.raw.missing"},
+		{expr: ".dns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			path, err := parseQuery(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf strings.Builder
+			qw := &queryResultWriter{w: &buf, path: path}
+			if err := qw.WriteResult(record); err != nil {
+				t.Fatal(err)
+			}
+			if err := qw.WriteError("bad.example", errors.New("lookup failed")); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[22,443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: ".ip", want: "192.0.2.1\n"},
+		{query: ".ports", want: "22\n443\n"},
+		{query: ".country", want: "US\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-q", tt.query,
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
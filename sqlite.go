@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteCommitEvery is the number of records written per transaction, so
+// an interrupted run keeps everything but the last few.
+const sqliteCommitEvery = 100
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS hosts (
+	ip         TEXT PRIMARY KEY,
+	target     TEXT,
+	hostname   TEXT,
+	city       TEXT,
+	region     TEXT,
+	country    TEXT,
+	loc        TEXT,
+	org        TEXT,
+	postal     TEXT,
+	timezone   TEXT,
+	asn        TEXT,
+	os         TEXT,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ports (
+	ip   TEXT NOT NULL REFERENCES hosts(ip) ON DELETE CASCADE,
+	port INTEGER NOT NULL,
+	PRIMARY KEY (ip, port)
+);
+CREATE TABLE IF NOT EXISTS vulns (
+	ip       TEXT NOT NULL REFERENCES hosts(ip) ON DELETE CASCADE,
+	id       TEXT NOT NULL,
+	cvss     REAL,
+	severity TEXT,
+	PRIMARY KEY (ip, id)
+);
+`
+
+const sqliteUpsertHost = `
+INSERT INTO hosts (ip, target, hostname, city, region, country, loc, org, postal, timezone, asn, os, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (ip) DO UPDATE SET
+	target = excluded.target,
+	hostname = excluded.hostname,
+	city = excluded.city,
+	region = excluded.region,
+	country = excluded.country,
+	loc = excluded.loc,
+	org = excluded.org,
+	postal = excluded.postal,
+	timezone = excluded.timezone,
+	asn = excluded.asn,
+	os = excluded.os,
+	updated_at = excluded.updated_at`
+
+// sqliteSink stores written records in the -sqlite database: one hosts row
+// per IP, upserted so reruns refresh it, plus its ports and vulns rows. A
+// nil *sqliteSink is a no-op.
+type sqliteSink struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+}
+
+func newSQLiteSink() (*sqliteSink, error) {
+	if argSQLite == "" {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite", argSQLite)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps the foreign_keys pragma in effect for
+	// every statement.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", argSQLite, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema in %s: %w", argSQLite, err)
+	}
+	return &sqliteSink{db: db}, nil
+}
+
+// Add upserts the host row of combined and replaces its ports and vulns.
+func (s *sqliteSink) Add(combined hostinfo.CombinedResponse) error {
+	if s == nil {
+		return nil
+	}
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		s.tx = tx
+	}
+
+	if _, err := s.tx.Exec(sqliteUpsertHost,
+		combined.IP, combined.Target, combined.Hostname,
+		combined.City, combined.Region, combined.Country, combined.Loc,
+		combined.Org, combined.Postal, combined.Timezone,
+		combined.ASN, combined.OS, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec("DELETE FROM ports WHERE ip = ?", combined.IP); err != nil {
+		return err
+	}
+	for _, port := range combined.Ports {
+		if _, err := s.tx.Exec("INSERT OR IGNORE INTO ports (ip, port) VALUES (?, ?)", combined.IP, port); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.tx.Exec("DELETE FROM vulns WHERE ip = ?", combined.IP); err != nil {
+		return err
+	}
+	for _, vuln := range combined.Vulns {
+		if _, err := s.tx.Exec("INSERT OR IGNORE INTO vulns (ip, id, cvss, severity) VALUES (?, ?, ?, ?)",
+			combined.IP, vuln.ID, vuln.CVSS, vuln.Severity); err != nil {
+			return err
+		}
+	}
+
+	s.pending++
+	if s.pending >= sqliteCommitEvery {
+		return s.commit()
+	}
+	return nil
+}
+
+func (s *sqliteSink) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	s.pending = 0
+	return err
+}
+
+// Close commits the open transaction and closes the database.
+func (s *sqliteSink) Close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.commit()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
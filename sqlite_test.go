@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// writeSQLite stores each run's records in the -sqlite database at path,
+// one sink per run.
+func writeSQLite(t *testing.T, path string, runs ...[]hostinfo.CombinedResponse) {
+	t.Helper()
+	setArg(t, &argSQLite, path)
+	for _, records := range runs {
+		sink, err := newSQLiteSink()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			if err := sink.Add(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func queryInts(t *testing.T, db *sql.DB, query string, args ...any) []int {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var values []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestSQLiteSink(t *testing.T) {
+	first := sampleRecord()
+	second := sampleRecord()
+	second.IP, second.Country, second.Ports, second.Vulns = "192.0.2.2", "DE", []int{80}, nil
+	// A rerun refreshes the host row and replaces its ports and vulns.
+	rescanned := sampleRecord()
+	rescanned.Country, rescanned.Ports = "FR", []int{443, 8443}
+	rescanned.Vulns = []hostinfo.Vuln{{ID: "CVE-2023-0001", CVSS: 7.5, Severity: "HIGH"}}
+
+	tests := []struct {
+		name        string
+		runs        [][]hostinfo.CombinedResponse
+		wantHosts   int
+		wantCountry string
+		wantPorts   []int
+		wantVulns   int
+	}{
+		{name: "one run", runs: [][]hostinfo.CombinedResponse{{first, second}}, wantHosts: 2, wantCountry: "US", wantPorts: []int{22, 443}, wantVulns: 1},
+		{name: "upserted rerun", runs: [][]hostinfo.CombinedResponse{{first, second}, {rescanned}}, wantHosts: 2, wantCountry: "FR", wantPorts: []int{443, 8443}, wantVulns: 1},
+		{name: "duplicate in one run", runs: [][]hostinfo.CombinedResponse{{first, first}}, wantHosts: 1, wantCountry: "US", wantPorts: []int{22, 443}, wantVulns: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hosts.db")
+			writeSQLite(t, path, tt.runs...)
+
+			db, err := sql.Open("sqlite", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if got := queryInts(t, db, "SELECT COUNT(*) FROM hosts"); got[0] != tt.wantHosts {
+				t.Errorf("got %d hosts, want %d", got[0], tt.wantHosts)
+			}
+			var target, country, org string
+			if err := db.QueryRow("SELECT target, country, org FROM hosts WHERE ip = ?", first.IP).Scan(&target, &country, &org); err != nil {
+				t.Fatal(err)
+			}
+			if target != first.Target || country != tt.wantCountry || org != first.Org {
+				t.Errorf("got target %q, country %q and org %q", target, country, org)
+			}
+			if got := queryInts(t, db, "SELECT port FROM ports WHERE ip = ? ORDER BY port", first.IP); !slices.Equal(got, tt.wantPorts) {
+				t.Errorf("got ports %v, want %v", got, tt.wantPorts)
+			}
+			if got := queryInts(t, db, "SELECT COUNT(*) FROM vulns WHERE ip = ?", first.IP); got[0] != tt.wantVulns {
+				t.Errorf("got %d vulns, want %d", got[0], tt.wantVulns)
+			}
+		})
+	}
+}
+
+func TestSQLiteSinkCommitsInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.db")
+	setArg(t, &argSQLite, path)
+	sink, err := newSQLiteSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	record := sampleRecord()
+	for i := range sqliteCommitEvery + 1 {
+		record.IP = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		if err := sink.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A full batch is committed and visible to other connections before
+	// Close, so an interrupted run keeps it.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := queryInts(t, db, "SELECT COUNT(*) FROM hosts"); got[0] != sqliteCommitEvery {
+		t.Errorf("got %d committed hosts, want %d", got[0], sqliteCommitEvery)
+	}
+}
+
+func TestSQLiteFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[22,443],"vulns":["CVE-2021-44228"]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	dir := t.TempDir()
+	status, _, stderr := runHostinfoStreams(t, dir, "-sqlite", "hosts.db", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(dir, "hosts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for query, want := range map[string]int{
+		"SELECT COUNT(*) FROM hosts WHERE country = 'US'":        1,
+		"SELECT COUNT(*) FROM ports WHERE ip = '192.0.2.1'":      2,
+		"SELECT COUNT(*) FROM vulns WHERE id = 'CVE-2021-44228'": 1,
+	} {
+		if got := queryInts(t, db, query); got[0] != want {
+			t.Errorf("%s = %d, want %d", query, got[0], want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// summaryTopPorts is the number of ports listed in the -summary report.
+const summaryTopPorts = 10
+
+// runSummary aggregates the records written during a run for -summary. A
+// nil *runSummary is a no-op.
+type runSummary struct {
+	ips       map[string]bool
+	countries map[string]int
+	ports     map[int]int
+	cves      map[string]bool
+}
+
+func newRunSummary() *runSummary {
+	if !argSummary {
+		return nil
+	}
+	return &runSummary{
+		ips:       map[string]bool{},
+		countries: map[string]int{},
+		ports:     map[int]int{},
+		cves:      map[string]bool{},
+	}
+}
+
+// Add records a written record.
+func (s *runSummary) Add(combined hostinfo.CombinedResponse) {
+	if s == nil {
+		return
+	}
+	if !s.ips[combined.IP] {
+		s.ips[combined.IP] = true
+		s.countries[cmp.Or(combined.Country, "unknown")]++
+		for _, port := range combined.Ports {
+			s.ports[port]++
+		}
+	}
+	for _, id := range hostinfo.VulnIDs(combined.Vulns) {
+		s.cves[id] = true
+	}
+}
+
+// Print writes the report for a run with the given stats. Countries and
+// ports are counted once per unique IP and listed most common first.
+func (s *runSummary) Print(w io.Writer, stats runStats) {
+	if s == nil {
+		return
+	}
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  targets:       %d (%d failed)\n", stats.targets, stats.failed)
+	fmt.Fprintf(w, "  unique IPs:    %d\n", len(s.ips))
+	fmt.Fprintf(w, "  countries:     %s\n", formatCounts(s.countries, 0))
+	fmt.Fprintf(w, "  top ports:     %s\n", formatCounts(s.ports, summaryTopPorts))
+	fmt.Fprintf(w, "  distinct CVEs: %d\n", len(s.cves))
+}
+
+// formatCounts lists counts as "key (n)" sorted by descending count, then by
+// key, keeping at most limit entries when limit is positive.
+func formatCounts[K cmp.Ordered](counts map[K]int, limit int) string {
+	keys := make([]K, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	if len(keys) == 0 {
+		return "-"
+	}
+
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = fmt.Sprintf("%v (%d)", key, counts[key])
+	}
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+func summaryHost(ip, country string, ports []int, cves ...string) hostinfo.CombinedResponse {
+	var r hostinfo.CombinedResponse
+	r.IP, r.Country, r.Ports = ip, country, ports
+	for _, id := range cves {
+		r.Vulns = append(r.Vulns, hostinfo.Vuln{ID: id})
+	}
+	return r
+}
+
+func TestFormatCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts map[string]int
+		limit  int
+		want   string
+	}{
+		{name: "empty", counts: map[string]int{}, want: "-"},
+		{name: "by count then key", counts: map[string]int{"US": 1, "DE": 3, "FR": 1}, want: "DE (3), FR (1), US (1)"},
+		{name: "limited", counts: map[string]int{"US": 1, "DE": 3, "FR": 2}, limit: 2, want: "DE (3), FR (2)"},
+		{name: "under the limit", counts: map[string]int{"US": 1}, limit: 2, want: "US (1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatCounts(tt.counts, tt.limit); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	setArg(t, &argSummary, true)
+	summary := newRunSummary()
+	for _, record := range []hostinfo.CombinedResponse{
+		summaryHost("192.0.2.1", "US", []int{22, 443}, "CVE-2021-44228"),
+		// A second record of an IP, e.g. from another hostname, counts its
+		// country and ports once.
+		summaryHost("192.0.2.1", "US", []int{22, 443}, "CVE-2021-44228", "CVE-2023-0001"),
+		summaryHost("192.0.2.2", "DE", []int{443}),
+		summaryHost("192.0.2.3", "", []int{80, 443}, "CVE-2023-0001"),
+	} {
+		summary.Add(record)
+	}
+
+	var buf strings.Builder
+	summary.Print(&buf, runStats{targets: 4, failed: 1})
+	want := `Summary:
+  targets:       4 (1 failed)
+  unique IPs:    3
+  countries:     DE (1), US (1), unknown (1)
+  top ports:     443 (3), 22 (1), 80 (1)
+  distinct CVEs: 2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunSummaryDisabled(t *testing.T) {
+	setArg(t, &argSummary, false)
+	summary := newRunSummary()
+	summary.Add(summaryHost("192.0.2.1", "US", []int{22}))
+	var buf strings.Builder
+	summary.Print(&buf, runStats{targets: 1})
+	if buf.Len() != 0 {
+		t.Errorf("got %q, want nothing", buf.String())
+	}
+}
+
+func TestSummaryFlag(t *testing.T) {
+	hosts := map[string]string{
+		"192.0.2.1": `{"ip":"192.0.2.1","ports":[22,443],"vulns":["CVE-2021-44228"]}`,
+		"192.0.2.2": `{"ip":"192.0.2.2","ports":[443],"vulns":["CVE-2021-44228","CVE-2023-0001"]}`,
+		"192.0.2.3": `{"ip":"192.0.2.3","ports":[80]}`,
+	}
+	countries := map[string]string{"192.0.2.1": "US", "192.0.2.2": "US", "192.0.2.3": "DE"}
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, hosts[strings.TrimPrefix(r.URL.Path, "/")])
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/json")
+		fmt.Fprintf(w, `{"ip":%q,"country":%q}`, ip, countries[ip])
+	}))
+	defer ipinfo.Close()
+
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-compact", "-summary", "-log-level", "error",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if strings.Contains(stdout, "Summary") || strings.Count(stdout, "\n") != 3 {
+		t.Errorf("got stdout %q, want the three records alone", stdout)
+	}
+	for _, want := range []string{
+		"targets:       3 (0 failed)",
+		"unique IPs:    3",
+		"countries:     US (2), DE (1)",
+		"top ports:     443 (2), 22 (1), 80 (1)",
+		"distinct CVEs: 2",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("summary is missing %q:\n%s", want, stderr)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// maxExpansionBits limits CIDR expansion to ranges of at most 2^16
+// addresses (a /16 for IPv4) unless -force is given.
+const maxExpansionBits = 16
+
+var inputFormats = []string{"lines", "ndjson", "csv"}
+
+// readInput reads targets from r in the -input-format encoding.
+func readInput(r io.Reader) ([]string, error) {
+	switch argInputFormat {
+	case "ndjson":
+		return readNDJSONTargets(r)
+	case "csv":
+		return readCSVTargets(r, argCSVColumn, argCSVHeader)
+	}
+	return readTargets(r)
+}
+
+// readTargets reads one target per line, trimming whitespace and skipping
+// blank lines and lines starting with '#'.
+func readTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
+
+// readNDJSONTargets reads one JSON object per line, such as earlier
+// hostinfo output, and takes each record's target field, or its ip field
+// when the target is empty. Blank lines are skipped.
+func readNDJSONTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record struct {
+			Target string `json:"target"`
+			IP     string `json:"ip"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON record: %w", lineNumber, err)
+		}
+		target := record.Target
+		if target == "" {
+			target = record.IP
+		}
+		if target == "" {
+			return nil, fmt.Errorf("line %d: record has no target or ip field", lineNumber)
+		}
+		targets = append(targets, target)
+	}
+	return targets, scanner.Err()
+}
+
+// readCSVTargets reads the targets in one column of a CSV file. column is
+// a 1-based index or, when the first row is a header, a column name. Rows
+// that can't be parsed or are too short are skipped with a warning, as are
+// empty cells.
+func readCSVTargets(r io.Reader, column string, header bool) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	index, err := strconv.Atoi(column)
+	index--
+	if header {
+		names, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+		if index < 0 {
+			index = slices.IndexFunc(names, func(name string) bool {
+				return strings.EqualFold(strings.TrimSpace(name), column)
+			})
+			if index < 0 {
+				return nil, fmt.Errorf("CSV header has no column %q", column)
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("CSV column %q is not a number; naming a column requires -csv-header", column)
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("invalid CSV column %q", column)
+	}
+
+	var targets []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			slog.Warn("skipping malformed CSV row", "err", err)
+			continue
+		}
+		if index >= len(record) {
+			line, _ := reader.FieldPos(0)
+			slog.Warn("skipping CSV row without target column", "line", line, "columns", len(record))
+			continue
+		}
+		if target := strings.TrimSpace(record[index]); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// collectTargets gathers the targets named by args. Arguments naming an
+// existing file are read with readInput; any other argument is taken as a
+// literal target. The result keeps argument order.
+func collectTargets(args []string) ([]string, error) {
+	var targets []string
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err != nil {
+			targets = append(targets, arg)
+			continue
+		}
+
+		fileTargets, err := readTargetsFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, fileTargets...)
+	}
+	return targets, nil
+}
+
+// readPrefixFile reads a file of IPs and CIDR ranges, one per line, with
+// the blank line and comment rules of target files.
+func readPrefixFile(path string) ([]netip.Prefix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines, err := readTargets(file)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, 0, len(lines))
+	for _, line := range lines {
+		prefix, err := hostinfo.ParsePrefix(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", line)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// fetchTargets downloads a target list from rawURL and reads it with
+// readInput.
+func fetchTargets(ctx context.Context, client *http.Client, rawURL string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", argUserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return readInput(resp.Body)
+}
+
+func readTargetsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	targets, err := readInput(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", path, err)
+	}
+	return targets, nil
+}
+
+// normalizedTarget returns target as -dry-run lists it: its host, with IPs
+// in canonical form and hostnames in punycode, normalized with
+// -normalize-hostname, and its port if it has one.
+func normalizedTarget(target string) string {
+	host, port := hostinfo.SplitTarget(target)
+	if ip, ok := normalizeIP(host); ok {
+		host = ip
+	} else {
+		if argNormalizeHost {
+			host = hostinfo.NormalizeHostname(host)
+		}
+		if ascii, err := hostinfo.ToASCIIHostname(host); err == nil {
+			host = ascii
+		}
+	}
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
+
+// normalizeIP returns the canonical form of an IP address. Unlike
+// net.ParseIP it also accepts IPv4 octets with leading zeros, reading them
+// as decimal.
+func normalizeIP(value string) (string, bool) {
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String(), true
+	}
+
+	octets := strings.Split(value, ".")
+	if len(octets) != net.IPv4len {
+		return "", false
+	}
+	ip := make(net.IP, net.IPv4len)
+	for i, octet := range octets {
+		if octet == "" || len(octet) > 3 {
+			return "", false
+		}
+		n, err := strconv.ParseUint(octet, 10, 8)
+		if err != nil {
+			return "", false
+		}
+		ip[i] = byte(n)
+	}
+	return ip.String(), true
+}
+
+// dedupTargets drops repeated targets in first-seen order. It runs after
+// expandTargets, so IP addresses are already canonical; with
+// -normalize-hostname hostnames are compared normalized.
+func dedupTargets(targets []string) []string {
+	seen := make(map[string]bool, len(targets))
+	var unique []string
+	for _, target := range targets {
+		key := dedupKey(target)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, target)
+	}
+	return unique
+}
+
+// dedupKey returns the form of target -dedup compares: the target itself,
+// or with -normalize-hostname its normalized host and port. URL targets are
+// compared as given.
+func dedupKey(target string) string {
+	if !argNormalizeHost || strings.Contains(target, "/") {
+		return target
+	}
+	host, port := hostinfo.SplitTarget(target)
+	host = hostinfo.NormalizeHostname(host)
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func expandCIDR(cidr string) ([]string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > maxExpansionBits && !argForce {
+		return nil, fmt.Errorf("range exceeds %d addresses (use -force to override)", 1<<maxExpansionBits)
+	}
+
+	start := ipNet.IP
+	if ip4 := start.To4(); ip4 != nil {
+		start = ip4
+	}
+	skipEdges := len(start) == net.IPv4len && hostBits >= 2 && !argIncludeNet
+
+	var hosts []string
+	for ip := start; ipNet.Contains(ip); ip = nextIP(ip) {
+		hosts = append(hosts, ip.String())
+		if nextIP(ip).IsUnspecified() {
+			break
+		}
+	}
+	if skipEdges {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// parseIPRange splits a start-end range such as 192.0.2.10-192.0.2.40.
+// ok is false when target isn't of that form.
+func parseIPRange(target string) (net.IP, net.IP, bool) {
+	startValue, endValue, found := strings.Cut(target, "-")
+	if !found {
+		return nil, nil, false
+	}
+	start := net.ParseIP(strings.TrimSpace(startValue))
+	end := net.ParseIP(strings.TrimSpace(endValue))
+	if start == nil || end == nil {
+		return nil, nil, false
+	}
+	return start, end, true
+}
+
+// expandRange lists every address from start to end inclusive, with the
+// same size limit as CIDR expansion.
+func expandRange(start, end net.IP) ([]string, error) {
+	if start4, end4 := start.To4(), end.To4(); start4 != nil || end4 != nil {
+		if start4 == nil || end4 == nil {
+			return nil, fmt.Errorf("range mixes IPv4 and IPv6 addresses")
+		}
+		start, end = start4, end4
+	}
+
+	first := new(big.Int).SetBytes(start)
+	last := new(big.Int).SetBytes(end)
+	if first.Cmp(last) > 0 {
+		return nil, fmt.Errorf("range start %s is after its end %s", start, end)
+	}
+	size := new(big.Int).Sub(last, first)
+	if size.Cmp(big.NewInt(1<<maxExpansionBits)) >= 0 && !argForce {
+		return nil, fmt.Errorf("range exceeds %d addresses (use -force to override)", 1<<maxExpansionBits)
+	}
+
+	var hosts []string
+	for ip := start; ; ip = nextIP(ip) {
+		hosts = append(hosts, ip.String())
+		if ip.Equal(end) {
+			break
+		}
+	}
+	return hosts, nil
+}
+
+// asnPattern matches autonomous system targets such as AS15169.
+var asnPattern = regexp.MustCompile(`(?i)^AS[0-9]+$`)
+
+// expandASN returns the announced prefixes of asn in the address family
+// being processed, IPv4 unless -6 is set.
+func expandASN(ctx context.Context, client *hostinfo.Client, asn string) ([]string, error) {
+	prefixes, err := client.LookupASNPrefixes(ctx, asn)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, prefix := range prefixes {
+		ip, _, err := net.ParseCIDR(prefix)
+		if err != nil {
+			continue
+		}
+		if (ip.To4() != nil) != argIPv6Only {
+			selected = append(selected, prefix)
+		}
+	}
+	return selected, nil
+}
+
+// expandTargets replaces CIDR ranges and start-end ranges with their hosts,
+// and ASNs with the hosts of the prefixes they announce. IP addresses are
+// put in their canonical form, so that 192.0.2.01 is processed as an IP
+// rather than resolved as a hostname.
+func expandTargets(ctx context.Context, client *hostinfo.Client, targets []string) []string {
+	var expanded []string
+	for _, target := range targets {
+		// -dry-run makes no network calls, so ASNs are listed unexpanded.
+		if asnPattern.MatchString(target) && !argDryRun {
+			prefixes, err := expandASN(ctx, client, target)
+			if err != nil {
+				slog.Error("expanding target failed", "target", target, "err", err)
+				continue
+			}
+			expanded = append(expanded, expandTargets(ctx, client, prefixes)...)
+			continue
+		}
+		if start, end, ok := parseIPRange(target); ok {
+			hosts, err := expandRange(start, end)
+			if err != nil {
+				slog.Error("expanding target failed", "target", target, "err", err)
+				continue
+			}
+			expanded = append(expanded, hosts...)
+			continue
+		}
+
+		if ip, ok := normalizeIP(target); ok {
+			expanded = append(expanded, ip)
+			continue
+		}
+		if !strings.Contains(target, "/") {
+			expanded = append(expanded, target)
+			continue
+		}
+		if _, _, err := net.ParseCIDR(target); err != nil {
+			expanded = append(expanded, target)
+			continue
+		}
+
+		hosts, err := expandCIDR(target)
+		if err != nil {
+			slog.Error("expanding target failed", "target", target, "err", err)
+			continue
+		}
+		expanded = append(expanded, hosts...)
+	}
+	return expanded
+}
+
+// newRand returns a generator seeded with seed, or with a random seed when
+// seed is zero.
+func newRand(seed uint64) *rand.Rand {
+	if seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
+
+// shuffleTargets returns targets in random order. The order is
+// reproducible for a given nonzero seed.
+func shuffleTargets(targets []string, seed uint64) []string {
+	shuffled := slices.Clone(targets)
+	newRand(seed).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// sampleTargets picks n targets at random, keeping them in input order. The
+// pick is reproducible for a given nonzero seed.
+func sampleTargets(targets []string, n int, seed uint64) []string {
+	if n >= len(targets) {
+		return targets
+	}
+
+	picked := newRand(seed).Perm(len(targets))[:n]
+	slices.Sort(picked)
+
+	sample := make([]string, n)
+	for i, index := range picked {
+		sample[i] = targets[index]
+	}
+	return sample
+}
+
+// sendTargets returns a channel that yields targets and is closed once
+// they have all been received or ctx is done.
+func sendTargets(ctx context.Context, targets []string) <-chan string {
+	stream := make(chan string)
+	go func() {
+		defer close(stream)
+		for _, target := range targets {
+			select {
+			case stream <- target:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return stream
+}
+
+// streamTargets reads targets from r for -stream: each line is parsed in
+// the -input-format encoding, expanded and deduplicated as it arrives, so
+// processing starts before r reaches EOF. -limit stops the stream early.
+// The channel is closed at EOF.
+func streamTargets(ctx context.Context, client *hostinfo.Client, r io.Reader) <-chan string {
+	stream := make(chan string)
+	go func() {
+		defer close(stream)
+		seen := map[string]bool{}
+		sent := 0
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			targets, err := readInput(strings.NewReader(scanner.Text()))
+			if err != nil {
+				slog.Error("reading stdin failed", "err", err)
+				continue
+			}
+			for _, target := range expandTargets(ctx, client, targets) {
+				if argDedup {
+					key := dedupKey(target)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				select {
+				case stream <- target:
+				case <-ctx.Done():
+					return
+				}
+				if sent++; argLimit > 0 && sent >= argLimit {
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			slog.Error("reading stdin failed", "err", err)
+		}
+	}()
+	return stream
+}
@@ -0,0 +1,1087 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+func TestExpandCIDR(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidr       string
+		force      bool
+		includeNet bool
+		want       []string
+		wantCount  int
+		wantErr    bool
+	}{
+		{name: "/30", cidr: "192.0.2.0/30", want: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "/30 with edges", cidr: "192.0.2.0/30", includeNet: true, want: []string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+		{name: "/31", cidr: "192.0.2.0/31", want: []string{"192.0.2.0", "192.0.2.1"}},
+		{name: "/32", cidr: "192.0.2.7/32", want: []string{"192.0.2.7"}},
+		{name: "unaligned base", cidr: "192.0.2.5/30", want: []string{"192.0.2.5", "192.0.2.6"}},
+		{name: "/24", cidr: "198.51.100.0/24", wantCount: 254},
+		{name: "/16", cidr: "10.1.0.0/16", wantCount: 65534},
+		{name: "IPv6 /126", cidr: "2001:db8::/126", want: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{name: "top of the address space", cidr: "255.255.255.252/30", want: []string{"255.255.255.253", "255.255.255.254"}},
+		{name: "oversized", cidr: "10.0.0.0/8", wantErr: true},
+		{name: "oversized IPv6", cidr: "2001:db8::/64", wantErr: true},
+		{name: "oversized with -force", cidr: "10.0.0.0/15", force: true, wantCount: 1<<17 - 2},
+		{name: "invalid", cidr: "192.0.2.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argForce, tt.force)
+			setArg(t, &argIncludeNet, tt.includeNet)
+			got, err := expandCIDR(tt.cidr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d hosts, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if tt.wantCount != 0 && len(got) != tt.wantCount {
+				t.Errorf("got %d hosts, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestExpandTargetsCIDR(t *testing.T) {
+	setArg(t, &argForce, false)
+	setArg(t, &argIncludeNet, false)
+	got := expandTargets(context.Background(), nil, []string{"example.com", "192.0.2.0/30", "10.0.0.0/8", "https://example.com/a/b"})
+	want := []string{"example.com", "192.0.2.1", "192.0.2.2", "https://example.com/a/b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExpandTargetsIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{name: "leading zero octets", targets: []string{"192.0.2.01", "192.000.002.001"}, want: []string{"192.0.2.1", "192.0.2.1"}},
+		{name: "IPv6 forms", targets: []string{"2001:0db8:0:0::1", "2001:DB8::1"}, want: []string{"2001:db8::1", "2001:db8::1"}},
+		{name: "hostnames kept", targets: []string{"Example.com", "192.0.2.1.example"}, want: []string{"Example.com", "192.0.2.1.example"}},
+		{name: "out of range octet", targets: []string{"192.0.2.256"}, want: []string{"192.0.2.256"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expandTargets(context.Background(), nil, tt.targets)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeadingZeroTarget(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"country":"US"}`)
+	// A lookup of the target as a hostname would fail.
+	status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-r", nxdomainResolver(t), "-template", "{{.IP}}",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.01")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if stdout != "192.0.2.1\n" {
+		t.Errorf("got %q, want the canonical IP", stdout)
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "empty", input: ""},
+		{name: "plain", input: "example.com\n192.0.2.1\n", want: []string{"example.com", "192.0.2.1"}},
+		{name: "no trailing newline", input: "example.com", want: []string{"example.com"}},
+		{name: "blank lines", input: "\nexample.com\n\n   \n\t\n192.0.2.1\n\n", want: []string{"example.com", "192.0.2.1"}},
+		{name: "comments", input: "# scope\nexample.com\n  # indented comment\n#192.0.2.1\n", want: []string{"example.com"}},
+		{name: "padded hosts", input: "  example.com  \n\t192.0.2.1\r\n", want: []string{"example.com", "192.0.2.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTargets(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetFile(t *testing.T) {
+	dir := t.TempDir()
+	content := "# production\n\n  first.test \n\n# staging\nsecond.test\n"
+	if err := os.WriteFile(filepath.Join(dir, "targets.txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Neither target resolves, so each is written as an inline error.
+	resolver := nxdomainResolver(t)
+	status, stdout, stderr := runHostinfoStreams(t, dir, "-errors-inline", "-r", resolver, "targets.txt")
+	if status != exitAllFailed {
+		t.Fatalf("got exit status %d, want %d; stderr:\n%s", status, exitAllFailed, stderr)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var record ErrorRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		got = append(got, record.Target)
+	}
+	slices.Sort(got)
+	if want := []string{"first.test", "second.test"}; !slices.Equal(got, want) {
+		t.Errorf("got records for %q, want %q", got, want)
+	}
+}
+
+func TestDedupTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{name: "empty"},
+		{
+			name:    "repeats keep first-seen order",
+			targets: []string{"b.example", "a.example", "b.example", "192.0.2.1", "a.example", "192.0.2.1", "b.example"},
+			want:    []string{"b.example", "a.example", "192.0.2.1"},
+		},
+		{name: "hostname case kept", targets: []string{"Example.com", "example.com"}, want: []string{"Example.com", "example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dedupTargets(tt.targets)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupFlag(t *testing.T) {
+	resolver := nxdomainResolver(t)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "without -dedup", want: []string{"a.test", "a.test", "b.test", "b.test", "b.test"}},
+		{name: "with -dedup", args: []string{"-dedup"}, want: []string{"a.test", "b.test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := "b.test\na.test\nb.test\na.test\nb.test\n"
+			if err := os.WriteFile(filepath.Join(dir, "targets.txt"), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// No target resolves, so each is written as an inline error.
+			args := append([]string{"-errors-inline", "-r", resolver}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, dir, append(args, "targets.txt")...)
+			if status != exitAllFailed {
+				t.Fatalf("got exit status %d, want %d; stderr:\n%s", status, exitAllFailed, stderr)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+				var record ErrorRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("line %q: %v", line, err)
+				}
+				got = append(got, record.Target)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got records for %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHostnameFlag(t *testing.T) {
+	resolver := stubResolver(t, map[string]string{"example.test.": "192.0.2.1"})
+	shodan, shodanRequests := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"country":"US"}`)
+	tests := []struct {
+		name         string
+		args         []string
+		want         string
+		wantRequests int32
+	}{
+		{
+			name: "dry run without -normalize-hostname",
+			args: []string{"-dry-run", "-dedup", "Example.TEST.", "example.test", "EXAMPLE.test:443", "example.test:443"},
+			want: "Example.TEST.\nexample.test\nEXAMPLE.test:443\nexample.test:443\n",
+		},
+		{
+			name: "dry run",
+			args: []string{"-dry-run", "-dedup", "-normalize-hostname", "Example.TEST.", "example.test", "EXAMPLE.test:443", "example.test:443"},
+			want: "example.test\nexample.test:443\n",
+		},
+		{
+			name:         "original target kept",
+			args:         []string{"-dedup", "-normalize-hostname", "-template", "{{.Target}} {{.IP}}", "Example.TEST.", "example.test"},
+			want:         "Example.TEST. 192.0.2.1\n",
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := shodanRequests.Load()
+			args := append([]string{"-r", resolver, "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got %q, want %q", stdout, tt.want)
+			}
+			if n := shodanRequests.Load() - before; n != tt.wantRequests {
+				t.Errorf("got %d Shodan requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCollectTargets(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	for path, content := range map[string]string{first: "a.example\nb.example\n", second: "192.0.2.1\n# comment\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "literals", args: []string{"8.8.8.8", "example.com"}, want: []string{"8.8.8.8", "example.com"}},
+		{name: "two files and a literal", args: []string{first, second, "8.8.8.8"}, want: []string{"a.example", "b.example", "192.0.2.1", "8.8.8.8"}},
+		{name: "argument order", args: []string{"8.8.8.8", second, first}, want: []string{"8.8.8.8", "192.0.2.1", "a.example", "b.example"}},
+		{name: "same file twice", args: []string{second, second}, want: []string{"192.0.2.1", "192.0.2.1"}},
+		{name: "missing file is a literal", args: []string{filepath.Join(dir, "missing.txt")}, want: []string{filepath.Join(dir, "missing.txt")}},
+		{name: "unreadable file", args: []string{dir}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argInputFormat, "lines")
+			got, err := collectTargets(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNDJSONTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", input: ""},
+		{
+			name:  "target field",
+			input: `{"target":"example.com","ip":"192.0.2.1"}` + "\n" + `{"target":"example.org"}` + "\n",
+			want:  []string{"example.com", "example.org"},
+		},
+		{
+			name:  "ip fallback",
+			input: `{"target":"","ip":"192.0.2.1","ports":[22]}` + "\n" + `{"ip":"192.0.2.2"}`,
+			want:  []string{"192.0.2.1", "192.0.2.2"},
+		},
+		{name: "blank lines", input: "\n" + `{"ip":"192.0.2.1"}` + "\n  \n", want: []string{"192.0.2.1"}},
+		{name: "plain line", input: `{"ip":"192.0.2.1"}` + "\nexample.com\n", wantErr: "line 2: invalid JSON record"},
+		{name: "no target", input: `{"ports":[22]}`, wantErr: "line 1: record has no target or ip field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readNDJSONTargets(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNDJSONInput(t *testing.T) {
+	var mu sync.Mutex
+	var looked []string
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		mu.Lock()
+		looked = append(looked, ip)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, ip)
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"country":"US"}`)
+	}))
+	defer ipinfo.Close()
+
+	tests := []struct {
+		name       string
+		input      string
+		wantStatus int
+		wantIPs    []string
+		wantStderr string
+	}{
+		{
+			name:    "earlier output",
+			input:   `{"ip":"192.0.2.1","ports":[22]}` + "\n" + `{"target":"192.0.2.2","ip":"192.0.2.2"}` + "\n",
+			wantIPs: []string{"192.0.2.1", "192.0.2.2"},
+		},
+		{
+			name:       "plain targets",
+			input:      "192.0.2.1\n",
+			wantStatus: exitError,
+			wantStderr: "line 1: invalid JSON record",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			looked = nil
+			mu.Unlock()
+			var stdout, stderr strings.Builder
+			cmd := hostinfoCommand(t, t.TempDir(), "-compact", "-input-format", "ndjson", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL)
+			cmd.Stdin = strings.NewReader(tt.input)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			status := 0
+			if err := cmd.Run(); err != nil {
+				status = cmd.ProcessState.ExitCode()
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("got exit status %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr is missing %q:\n%s", tt.wantStderr, stderr.String())
+			}
+			mu.Lock()
+			slices.Sort(looked)
+			got := slices.Clone(looked)
+			mu.Unlock()
+			if !slices.Equal(got, tt.wantIPs) {
+				t.Errorf("looked up %q, want %q", got, tt.wantIPs)
+			}
+			for _, ip := range tt.wantIPs {
+				if !strings.Contains(stdout.String(), `"ip":"`+ip+`"`) {
+					t.Errorf("stdout has no record for %s:\n%s", ip, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestReadCSVTargets(t *testing.T) {
+	const inventory = "name,address,owner\nweb,192.0.2.1,ops\ndb, 192.0.2.2 ,dba\n"
+	tests := []struct {
+		name    string
+		input   string
+		column  string
+		header  bool
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", input: "", column: "1"},
+		{name: "index", input: "192.0.2.1,a\n192.0.2.2,b\n", column: "1", want: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "header skipped", input: inventory, column: "2", header: true, want: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "header kept without -csv-header", input: inventory, column: "2", want: []string{"address", "192.0.2.1", "192.0.2.2"}},
+		{name: "header name", input: inventory, column: "Address", header: true, want: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "header only", input: "name,address\n", column: "address", header: true},
+		{
+			name:   "short and malformed rows skipped",
+			input:  "web,192.0.2.1\nshort\nbad\"row,192.0.2.9\nempty,\ndb,192.0.2.2\n",
+			column: "2",
+			want:   []string{"192.0.2.1", "192.0.2.2"},
+		},
+		{name: "quoted cell", input: "\"web, primary\",192.0.2.1\n", column: "2", want: []string{"192.0.2.1"}},
+		{name: "unknown header name", input: inventory, column: "ip", header: true, wantErr: `CSV header has no column "ip"`},
+		{name: "name without header", input: inventory, column: "address", wantErr: "naming a column requires -csv-header"},
+		{name: "zero column", input: inventory, column: "0", wantErr: `invalid CSV column "0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCSVTargets(strings.NewReader(tt.input), tt.column, tt.header)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVInput(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"country":"US"}`)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hosts.csv"), []byte("name,ip\nweb,192.0.2.1\nshort\ndb,192.0.2.2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := runHostinfoStreams(t, dir, "-input-format", "csv", "-csv-header", "-csv-column", "ip",
+		"-ordered", "-template", "{{.IP}}", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "hosts.csv")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := "192.0.2.1\n192.0.2.2\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	if !strings.Contains(stderr, "skipping CSV row without target column") {
+		t.Errorf("stderr has no warning for the short row:\n%s", stderr)
+	}
+}
+
+func TestFetchTargets(t *testing.T) {
+	setArg(t, &argUserAgent, "hostinfo/test")
+	tests := []struct {
+		name    string
+		format  string
+		status  int
+		body    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "lines",
+			body: "# inventory\n192.0.2.1\n\n  example.com  \n# retired: 192.0.2.9\n",
+			want: []string{"192.0.2.1", "example.com"},
+		},
+		{
+			name:   "ndjson",
+			format: "ndjson",
+			body:   `{"target":"example.com"}` + "\n" + `{"ip":"192.0.2.1"}` + "\n",
+			want:   []string{"example.com", "192.0.2.1"},
+		},
+		{name: "empty list", body: ""},
+		{name: "not found", status: http.StatusNotFound, wantErr: "server returned 404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.format != "" {
+				setArg(t, &argInputFormat, tt.format)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ua := r.Header.Get("User-Agent"); ua != "hostinfo/test" {
+					t.Errorf("got User-Agent %q", ua)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			got, err := fetchTargets(context.Background(), srv.Client(), srv.URL+"/targets.txt")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputURL(t *testing.T) {
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/targets.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "# shared list\n192.0.2.1\n192.0.2.2\n")
+	}))
+	defer list.Close()
+	shodan, _ := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, "{}")
+
+	tests := []struct {
+		name       string
+		url        string
+		args       []string
+		wantStatus int
+		want       string
+	}{
+		{name: "list", url: list.URL + "/targets.txt", want: "192.0.2.1\n192.0.2.2\n"},
+		{name: "with arguments", url: list.URL + "/targets.txt", args: []string{"192.0.2.3"}, want: "192.0.2.3\n192.0.2.1\n192.0.2.2\n"},
+		{name: "missing list", url: list.URL + "/missing.txt", wantStatus: exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-input-url", tt.url, "-ordered", "-template", "{{.IP}}",
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), args...)
+			if status != tt.wantStatus {
+				t.Fatalf("got exit status %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleTargets(t *testing.T) {
+	targets := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6", "192.0.2.7", "192.0.2.8"}
+	tests := []struct {
+		name string
+		n    int
+		want int
+	}{
+		{name: "subset", n: 3, want: 3},
+		{name: "all", n: len(targets), want: len(targets)},
+		{name: "more than there are", n: 20, want: len(targets)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sampleTargets(targets, tt.n, 1)
+			if len(got) != tt.want {
+				t.Fatalf("got %d targets, want %d", len(got), tt.want)
+			}
+			// A sample keeps the input order and never repeats a target.
+			last := -1
+			for _, target := range got {
+				i := slices.Index(targets, target)
+				if i <= last {
+					t.Fatalf("got %q, want an ordered subset of the input", got)
+				}
+				last = i
+			}
+			if again := sampleTargets(targets, tt.n, 1); !slices.Equal(again, got) {
+				t.Errorf("seed 1 picked %q, then %q", got, again)
+			}
+		})
+	}
+}
+
+func TestShuffleTargets(t *testing.T) {
+	var targets []string
+	for i := 1; i <= 20; i++ {
+		targets = append(targets, fmt.Sprintf("192.0.2.%d", i))
+	}
+	tests := []struct {
+		name    string
+		targets []string
+		seed    uint64
+	}{
+		{name: "seeded", targets: targets, seed: 42},
+		{name: "other seed", targets: targets, seed: 7},
+		{name: "random seed", targets: targets},
+		{name: "single", targets: targets[:1], seed: 42},
+		{name: "empty", seed: 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.targets)
+			got := shuffleTargets(tt.targets, tt.seed)
+			if !slices.Equal(tt.targets, input) {
+				t.Errorf("input changed to %q", tt.targets)
+			}
+			sorted := slices.Clone(got)
+			slices.Sort(sorted)
+			want := slices.Clone(input)
+			slices.Sort(want)
+			if !slices.Equal(sorted, want) {
+				t.Fatalf("got %q, want a permutation of %q", got, input)
+			}
+			if tt.seed == 0 {
+				return
+			}
+			if again := shuffleTargets(tt.targets, tt.seed); !slices.Equal(again, got) {
+				t.Errorf("seed %d gave %q, then %q", tt.seed, got, again)
+			}
+			if len(input) > 1 && slices.Equal(got, input) {
+				t.Errorf("seed %d kept the input order", tt.seed)
+			}
+		})
+	}
+	if a, b := shuffleTargets(targets, 42), shuffleTargets(targets, 7); slices.Equal(a, b) {
+		t.Errorf("seeds 42 and 7 both gave %q", a)
+	}
+}
+
+func TestRandomizeFlag(t *testing.T) {
+	targets := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6"}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "input order", args: []string{"-dry-run"}, want: targets},
+		{name: "shuffled", args: []string{"-dry-run", "-randomize", "-seed", "42"}, want: shuffleTargets(targets, 42)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), append(tt.args, targets...)...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if got := strings.Fields(stdout); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitAndSampleFlags(t *testing.T) {
+	var targets []string
+	for i := 1; i <= 8; i++ {
+		targets = append(targets, fmt.Sprintf("192.0.2.%d", i))
+	}
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		want   int
+		repeat bool
+	}{
+		{name: "limit", args: append([]string{"-limit", "5"}, targets...), want: 5},
+		{name: "limit above the targets", args: append([]string{"-limit", "20"}, targets...), want: 8},
+		{name: "sample", args: append([]string{"-sample", "3", "-seed", "1"}, targets...), want: 3, repeat: true},
+		{name: "streamed limit", args: []string{"-stream", "-limit", "2"}, stdin: strings.Join(targets, "\n"), want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func() []string {
+				shodan, requests := countingStub(t, `{"ports":[443]}`)
+				ipinfo, _ := countingStub(t, "{}")
+				var stdout, stderr strings.Builder
+				cmd := hostinfoCommand(t, t.TempDir(), append([]string{"-compact", "-ordered", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL}, tt.args...)...)
+				cmd.Stdin = strings.NewReader(tt.stdin)
+				cmd.Stdout, cmd.Stderr = &stdout, &stderr
+				if err := cmd.Run(); err != nil {
+					t.Fatalf("%v; stderr:\n%s", err, stderr.String())
+				}
+				if got := int(requests.Load()); got != tt.want {
+					t.Errorf("Shodan got %d requests, want %d", got, tt.want)
+				}
+				lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+				if len(lines) != tt.want {
+					t.Errorf("got %d records, want %d:\n%s", len(lines), tt.want, stdout.String())
+				}
+				return lines
+			}
+			first := run()
+			if tt.repeat {
+				if again := run(); !slices.Equal(again, first) {
+					t.Errorf("the same seed picked\n%q\nthen\n%q", first, again)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandTargetsASN(t *testing.T) {
+	ripe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") != "AS64500" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"prefixes":[{"prefix":"192.0.2.0/30"},{"prefix":"198.51.100.8/31"},{"prefix":"2001:db8::/127"}]}}`)
+	}))
+	defer ripe.Close()
+
+	tests := []struct {
+		name    string
+		targets []string
+		ipv6    bool
+		dryRun  bool
+		want    []string
+	}{
+		{name: "IPv4 prefixes", targets: []string{"AS64500"}, want: []string{"192.0.2.1", "192.0.2.2", "198.51.100.8", "198.51.100.9"}},
+		{name: "IPv6 prefixes", targets: []string{"as64500"}, ipv6: true, want: []string{"2001:db8::", "2001:db8::1"}},
+		{name: "unknown ASN skipped", targets: []string{"AS64511", "example.com"}, want: []string{"example.com"}},
+		{name: "dry run", targets: []string{"AS64500"}, dryRun: true, want: []string{"AS64500"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argIPv6Only, tt.ipv6)
+			setArg(t, &argDryRun, tt.dryRun)
+			setArg(t, &argIncludeNet, false)
+			client := &hostinfo.Client{RIPEStatURL: ripe.URL}
+			got := expandTargets(context.Background(), client, tt.targets)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		target    string
+		wantStart string
+		wantEnd   string
+		wantOK    bool
+	}{
+		{target: "192.0.2.10-192.0.2.40", wantStart: "192.0.2.10", wantEnd: "192.0.2.40", wantOK: true},
+		{target: "192.0.2.10 - 192.0.2.40", wantStart: "192.0.2.10", wantEnd: "192.0.2.40", wantOK: true},
+		{target: "2001:db8::1-2001:db8::3", wantStart: "2001:db8::1", wantEnd: "2001:db8::3", wantOK: true},
+		{target: "my-host.example.com"},
+		{target: "192.0.2.10-40"},
+		{target: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			start, end, ok := parseIPRange(tt.target)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (!start.Equal(net.ParseIP(tt.wantStart)) || !end.Equal(net.ParseIP(tt.wantEnd))) {
+				t.Errorf("got %s-%s, want %s-%s", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestExpandRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     string
+		end       string
+		force     bool
+		want      []string
+		wantCount int
+		wantErr   string
+	}{
+		{name: "small IPv4", start: "192.0.2.254", end: "192.0.3.1", want: []string{"192.0.2.254", "192.0.2.255", "192.0.3.0", "192.0.3.1"}},
+		{name: "single address", start: "192.0.2.7", end: "192.0.2.7", want: []string{"192.0.2.7"}},
+		{name: "small IPv6", start: "2001:db8::fffe", end: "2001:db8::1:0", want: []string{"2001:db8::fffe", "2001:db8::ffff", "2001:db8::1:0"}},
+		{name: "reversed", start: "192.0.2.40", end: "192.0.2.10", wantErr: "after its end"},
+		{name: "mixed families", start: "192.0.2.1", end: "2001:db8::1", wantErr: "mixes IPv4 and IPv6"},
+		{name: "at the limit", start: "10.0.0.0", end: "10.0.255.255", wantCount: 1 << maxExpansionBits},
+		{name: "over the limit", start: "10.0.0.0", end: "10.1.0.0", wantErr: "use -force"},
+		{name: "over the limit forced", start: "10.0.0.0", end: "10.1.0.0", force: true, wantCount: 1<<maxExpansionBits + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argForce, tt.force)
+			got, err := expandRange(net.ParseIP(tt.start), net.ParseIP(tt.end))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %d hosts, %v, want error %q", len(got), err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.wantCount > 0 && len(got) != tt.wantCount {
+				t.Errorf("got %d hosts, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestExpandTargetsRange(t *testing.T) {
+	setArg(t, &argForce, false)
+	got := expandTargets(context.Background(), nil, []string{"my-host.example.com", "192.0.2.10-192.0.2.12", "192.0.2.40-192.0.2.10"})
+	// The reversed range is reported and skipped.
+	want := []string{"my-host.example.com", "192.0.2.10", "192.0.2.11", "192.0.2.12"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadPrefixFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "addresses and ranges",
+			content: "# out of scope\n192.0.2.1\n\n198.51.100.0/24\n2001:db8::/32  \n",
+			want:    []string{"192.0.2.1/32", "198.51.100.0/24", "2001:db8::/32"},
+		},
+		{name: "empty", content: "# nothing yet\n"},
+		{name: "hostname", content: "192.0.2.1\nexample.com\n", wantErr: `invalid IP or CIDR "example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "deny.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			prefixes, err := readPrefixFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, prefix := range prefixes {
+				got = append(got, prefix.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := readPrefixFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
+
+func TestExcludeFileFlag(t *testing.T) {
+	var mu sync.Mutex
+	var looked []string
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		looked = append(looked, strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Unlock()
+		fmt.Fprint(w, `{"ports":[443]}`)
+	}))
+	defer shodan.Close()
+	ipinfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		looked = append(looked, strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Unlock()
+		fmt.Fprint(w, "{}")
+	}))
+	defer ipinfo.Close()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deny.txt"), []byte("192.0.2.0/30\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout, stderr := runHostinfoStreams(t, dir, "-exclude-file", "deny.txt", "-ordered", "-template", "{{.IP}}",
+		"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1", "192.0.2.5", "192.0.2.3")
+	if status != 0 {
+		t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+	}
+	if want := "192.0.2.5\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	if got := strings.Count(stderr, "skipping excluded IP"); got != 2 {
+		t.Errorf("got %d skip notices, want 2:\n%s", got, stderr)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range looked {
+		if !strings.HasPrefix(path, "192.0.2.5") {
+			t.Errorf("excluded IP looked up at %s", path)
+		}
+	}
+
+	if status, _, _ := runHostinfoStreams(t, dir, "-exclude-file", "missing.txt", "192.0.2.5"); status != exitError {
+		t.Errorf("got exit status %d for a missing exclude file, want %d", status, exitError)
+	}
+}
+
+func TestScopeFileFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ports":[443]}`)
+	ipinfo, _ := countingStub(t, "{}")
+	dir := t.TempDir()
+	for name, content := range map[string]string{"scope.txt": "192.0.2.0/29\n", "deny.txt": "192.0.2.2\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name           string
+		args           []string
+		want           string
+		wantOutOfScope int
+	}{
+		{name: "scope", args: []string{"-scope-file", "scope.txt"}, want: "192.0.2.1\n192.0.2.2\n", wantOutOfScope: 1},
+		{name: "scope and exclude", args: []string{"-scope-file", "scope.txt", "-exclude-file", "deny.txt"}, want: "192.0.2.1\n", wantOutOfScope: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "-ordered", "-template", "{{.IP}}", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL,
+				"192.0.2.1", "192.0.2.2", "192.0.2.200")
+			status, stdout, stderr := runHostinfoStreams(t, dir, args...)
+			if status != 0 {
+				t.Fatalf("exit status %d; stderr:\n%s", status, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got %q, want %q", stdout, tt.want)
+			}
+			if n := strings.Count(stderr, "skipping out-of-scope IP"); n != tt.wantOutOfScope {
+				t.Errorf("got %d out-of-scope notices, want %d:\n%s", n, tt.wantOutOfScope, stderr)
+			}
+		})
+	}
+}
+
+func TestStreamTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		dedup bool
+		limit int
+		want  []string
+	}{
+		{name: "lines", input: "192.0.2.1\n# comment\n\nexample.com\n", want: []string{"192.0.2.1", "example.com"}},
+		{name: "expanded", input: "192.0.2.0/31\n198.51.100.1-198.51.100.2\n", want: []string{"192.0.2.0", "192.0.2.1", "198.51.100.1", "198.51.100.2"}},
+		{name: "duplicates kept", input: "192.0.2.1\n192.0.2.1\n", want: []string{"192.0.2.1", "192.0.2.1"}},
+		{name: "deduplicated", input: "192.0.2.1\n::ffff:192.0.2.1\n192.0.2.0/31\n", dedup: true, want: []string{"192.0.2.1", "192.0.2.0"}},
+		{name: "limited", input: "192.0.2.0/28\n192.0.2.99\n", limit: 3, want: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setArg(t, &argDedup, tt.dedup)
+			setArg(t, &argLimit, tt.limit)
+			var got []string
+			for target := range streamTargets(context.Background(), &hostinfo.Client{}, strings.NewReader(tt.input)) {
+				got = append(got, target)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamTargetsIncremental(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	stream := streamTargets(context.Background(), &hostinfo.Client{}, r)
+	for _, target := range []string{"192.0.2.1", "192.0.2.2"} {
+		go io.WriteString(w, target+"\n")
+		select {
+		case got := <-stream:
+			if got != target {
+				t.Fatalf("got %q, want %q", got, target)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received before EOF", target)
+		}
+	}
+	w.Close()
+	if target, ok := <-stream; ok {
+		t.Errorf("got %q after EOF", target)
+	}
+}
+
+func TestStreamFlag(t *testing.T) {
+	shodan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ip":%q,"ports":[443]}`, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer shodan.Close()
+	ipinfo, _ := countingStub(t, "{}")
+
+	cmd := hostinfoCommand(t, t.TempDir(), "-stream", "-template", "{{.IP}}", "-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	// Each record is written while stdin is still open.
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		time.Sleep(20 * time.Millisecond)
+		if _, err := io.WriteString(stdin, ip+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case line := <-lines:
+			if line != ip {
+				t.Fatalf("got %q, want %q", line, ip)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no record for %s before EOF; stderr:\n%s", ip, stderr.String())
+		}
+	}
+	stdin.Close()
+	if line, ok := <-lines; ok {
+		t.Errorf("got %q after EOF", line)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("%v; stderr:\n%s", err, stderr.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// Build information, injected at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// buildInfo returns the version, commit and build date. Builds without
+// injected values, such as go install, report the module version and VCS
+// revision recorded by the toolchain instead.
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && c == "none":
+				c = setting.Value
+			case setting.Key == "vcs.time" && d == "unknown":
+				d = setting.Value
+			}
+		}
+	}
+	return v, c, d
+}
+
+// printVersion writes the build information.
+func printVersion(w io.Writer) {
+	v, c, d := buildInfo()
+	fmt.Fprintf(w, "hostinfo %s (commit %s, built %s)\n", v, c, d)
+}
+
+// defaultUserAgent is the -user-agent default, hostinfo/<version>.
+func defaultUserAgent() string {
+	v, _, _ := buildInfo()
+	return hostinfo.DefaultUserAgent + "/" + v
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintVersion(t *testing.T) {
+	setArg(t, &version, "v1.2.3")
+	setArg(t, &commit, "abc1234")
+	setArg(t, &date, "2024-05-01T12:00:00Z")
+	var out strings.Builder
+	printVersion(&out)
+	if want := "hostinfo v1.2.3 (commit abc1234, built 2024-05-01T12:00:00Z)\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+	if got := defaultUserAgent(); got != "hostinfo/v1.2.3" {
+		t.Errorf("got user agent %q, want hostinfo/v1.2.3", got)
+	}
+}
+
+func TestVersionLdflags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go toolchain")
+	}
+	binary := filepath.Join(t.TempDir(), "hostinfo")
+	build := exec.Command(gobin, "build", "-o", binary,
+		"-ldflags", "-X main.version=v9.8.7 -X main.commit=deadbeef -X main.date=2024-01-02", ".")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, output)
+	}
+
+	// -version must exit without waiting for targets on stdin.
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdinWriter.Close()
+	cmd := exec.Command(binary, "-version")
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir())
+	done := make(chan struct{})
+	timer := time.AfterFunc(10*time.Second, func() {
+		cmd.Process.Kill()
+		close(done)
+	})
+	output, err := cmd.CombinedOutput()
+	if !timer.Stop() {
+		<-done
+		t.Fatal("-version waited for stdin")
+	}
+	stdin.Close()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+	if want := "hostinfo v9.8.7 (commit deadbeef, built 2024-01-02)\n"; string(output) != want {
+		t.Errorf("got %q, want %q", output, want)
+	}
+}
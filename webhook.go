@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// webhookConcurrency is the number of webhook requests in flight at once.
+const webhookConcurrency = 4
+
+// webhookRetryDelay is the delay before the first retry of a failed
+// delivery; it doubles with every further attempt.
+var webhookRetryDelay = time.Second
+
+// webhookSink POSTs written records to -webhook as JSON, batching
+// -webhook-batch records per request. A single record is sent as an
+// object, batches as an array. Deliveries that still fail after -retries
+// are logged and dropped; once ctx is done, failed deliveries are no
+// longer retried. A nil *webhookSink is a no-op.
+type webhookSink struct {
+	ctx     context.Context
+	url     string
+	batch   int
+	retries int
+	client  *http.Client
+
+	pending []hostinfo.CombinedResponse
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	failed  atomic.Int32
+}
+
+func newWebhookSink(ctx context.Context, client *http.Client) *webhookSink {
+	if argWebhook == "" {
+		return nil
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhookSink{
+		ctx:     ctx,
+		url:     argWebhook,
+		batch:   max(argWebhookBatch, 1),
+		retries: argRetries,
+		client:  client,
+		sem:     make(chan struct{}, webhookConcurrency),
+	}
+}
+
+// Add queues a record, sending the batch once it is full.
+func (s *webhookSink) Add(combined hostinfo.CombinedResponse) {
+	if s == nil {
+		return
+	}
+	s.pending = append(s.pending, combined)
+	if len(s.pending) >= s.batch {
+		s.flush()
+	}
+}
+
+// Close sends the last partial batch, waits for every delivery and
+// returns the number of batches that couldn't be delivered.
+func (s *webhookSink) Close() int {
+	if s == nil {
+		return 0
+	}
+	if len(s.pending) > 0 {
+		s.flush()
+	}
+	s.wg.Wait()
+	return int(s.failed.Load())
+}
+
+func (s *webhookSink) flush() {
+	var payload any = s.pending
+	if s.batch == 1 {
+		payload = s.pending[0]
+	}
+	body, err := json.Marshal(payload)
+	records := len(s.pending)
+	s.pending = nil
+	if err != nil {
+		slog.Error("webhook delivery failed", "records", records, "err", err)
+		s.failed.Add(1)
+		return
+	}
+
+	s.sem <- struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.sem }()
+		if err := s.deliver(body); err != nil {
+			slog.Error("webhook delivery failed", "records", records, "err", err)
+			s.failed.Add(1)
+		}
+	}()
+}
+
+func (s *webhookSink) deliver(body []byte) error {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := s.post(body)
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+		slog.Debug("retrying webhook delivery", "attempt", attempt+1, "err", err)
+		if waitRetry(s.ctx, delay) != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// waitRetry waits delay before a retry, returning early with the error of
+// ctx once it is done.
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *webhookSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", argUserAgent)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
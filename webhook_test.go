@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cr4zyGoat/hostinfo/pkg/hostinfo"
+)
+
+// webhookReceiver records the bodies POSTed to it. The first failures
+// requests are answered with a 500.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	requests atomic.Int32
+}
+
+func newWebhookReceiver(t *testing.T, failures int32) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s request with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if receiver.requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.bodies = append(receiver.bodies, string(body))
+		receiver.mu.Unlock()
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func webhookRecords() []hostinfo.CombinedResponse {
+	records := make([]hostinfo.CombinedResponse, 3)
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		records[i] = sampleRecord()
+		records[i].IP = ip
+	}
+	return records
+}
+
+func TestWebhookSink(t *testing.T) {
+	records := webhookRecords()
+	tests := []struct {
+		name  string
+		batch int
+		want  []any
+	}{
+		{name: "one per request", batch: 1, want: []any{records[0], records[1], records[2]}},
+		{name: "batched", batch: 2, want: []any{records[:2], records[2:]}},
+		{name: "batch larger than the run", batch: 10, want: []any{records}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, 0)
+			setArg(t, &argWebhook, receiver.URL)
+			setArg(t, &argWebhookBatch, tt.batch)
+			sink := newWebhookSink(context.Background(), nil)
+			for _, record := range records {
+				sink.Add(record)
+			}
+			sink.Close()
+
+			var want []string
+			for _, payload := range tt.want {
+				body, err := json.Marshal(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, string(body))
+			}
+			got := receiver.received()
+			if !sameElements(got, want) {
+				t.Errorf("got payloads\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+// sameElements reports whether a and b hold the same strings in any order.
+func sameElements(a, b []string) bool {
+	count := map[string]int{}
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	setArg(t, &webhookRetryDelay, time.Millisecond)
+	tests := []struct {
+		name         string
+		failures     int32
+		retries      int
+		wantRequests int32
+		wantBodies   int
+		wantFailed   int
+	}{
+		{name: "delivered first time", retries: 2, wantRequests: 1, wantBodies: 1},
+		{name: "delivered on retry", failures: 2, retries: 2, wantRequests: 3, wantBodies: 1},
+		{name: "dropped after the retries", failures: 10, retries: 2, wantRequests: 3, wantFailed: 1},
+		{name: "no retries", failures: 1, wantRequests: 1, wantFailed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, tt.failures)
+			setArg(t, &argWebhook, receiver.URL)
+			setArg(t, &argWebhookBatch, 1)
+			setArg(t, &argRetries, tt.retries)
+			sink := newWebhookSink(context.Background(), nil)
+			sink.Add(sampleRecord())
+			if got := sink.Close(); got != tt.wantFailed {
+				t.Errorf("got %d failed deliveries, want %d", got, tt.wantFailed)
+			}
+			if got := receiver.requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+			if got := len(receiver.received()); got != tt.wantBodies {
+				t.Errorf("got %d deliveries, want %d", got, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestWebhookSinkCancel(t *testing.T) {
+	setArg(t, &webhookRetryDelay, time.Minute)
+	receiver := newWebhookReceiver(t, 100)
+	setArg(t, &argWebhook, receiver.URL)
+	setArg(t, &argWebhookBatch, 1)
+	setArg(t, &argRetries, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := newWebhookSink(ctx, nil)
+	sink.Add(sampleRecord())
+	for receiver.requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	start := time.Now()
+	if got := sink.Close(); got != 1 {
+		t.Errorf("got %d failed deliveries, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close waited %s for the backoff", elapsed)
+	}
+	if got := receiver.requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want the retries abandoned", got)
+	}
+}
+
+func TestWebhookSinkConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer receiver.Close()
+	setArg(t, &argWebhook, receiver.URL)
+	setArg(t, &argWebhookBatch, 1)
+
+	sink := newWebhookSink(context.Background(), nil)
+	for range 3 * webhookConcurrency {
+		sink.Add(sampleRecord())
+	}
+	sink.Close()
+	if got := peak.Load(); got > webhookConcurrency {
+		t.Errorf("got %d deliveries at once, want at most %d", got, webhookConcurrency)
+	}
+}
+
+func TestWebhookSinkNil(t *testing.T) {
+	setArg(t, &argWebhook, "")
+	sink := newWebhookSink(context.Background(), nil)
+	if sink != nil {
+		t.Fatalf("got %+v, want no sink without -webhook", sink)
+	}
+	sink.Add(sampleRecord())
+	sink.Close()
+}
+
+func TestWebhookFlag(t *testing.T) {
+	shodan, _ := countingStub(t, `{"ip":"192.0.2.1","ports":[443]}`)
+	ipinfo, _ := countingStub(t, `{"ip":"192.0.2.1","country":"US"}`)
+	tests := []struct {
+		name       string
+		failures   int32
+		wantStatus int
+	}{
+		{name: "delivered"},
+		// A failing receiver is logged and counts as an output failure.
+		{name: "receiver down", failures: 100, wantStatus: exitSomeFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, tt.failures)
+			status, stdout, stderr := runHostinfoStreams(t, t.TempDir(), "-compact", "-retries", "0", "-webhook", receiver.URL,
+				"-shodan-url", shodan.URL, "-ipinfo-url", ipinfo.URL, "192.0.2.1")
+			if status != tt.wantStatus {
+				t.Fatalf("exit status %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr)
+			}
+			got := receiver.received()
+			if tt.failures > 0 {
+				if len(got) != 0 || !strings.Contains(stderr, "webhook delivery failed") {
+					t.Errorf("got deliveries %q and stderr:\n%s", got, stderr)
+				}
+				return
+			}
+			var posted, written hostinfo.CombinedResponse
+			if len(got) != 1 || json.Unmarshal([]byte(got[0]), &posted) != nil || json.Unmarshal([]byte(stdout), &written) != nil {
+				t.Fatalf("got deliveries %q for stdout %q", got, stdout)
+			}
+			if !reflect.DeepEqual(posted, written) {
+				t.Errorf("posted %+v, wrote %+v", posted, written)
+			}
+		})
+	}
+}